@@ -194,3 +194,9 @@ func TestConfigEnvDurs(t *testing.T) {
 	set = config["a"].DurOr("b_c", time.Second*20)
 	assert.Equal(t, time.Second*20, set)
 }
+
+func TestParseDurationMilliseconds(t *testing.T) {
+	d, err := ParseDuration("1m30s250ms")
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second+250*time.Millisecond, d)
+}
@@ -8,13 +8,14 @@ import (
 )
 
 var (
-	biggerDurationsRE = regexp.MustCompile(`(?m)(\d+)([wdhms])`)
+	biggerDurationsRE = regexp.MustCompile(`(?m)(\d+)(ms|[wdhms])`)
 	conv              = map[string]time.Duration{
-		"s": time.Second,
-		"m": time.Minute,
-		"h": time.Hour,
-		"d": 24 * time.Hour,
-		"w": 7 * 24 * time.Hour,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
 	}
 )
 
@@ -0,0 +1,61 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// errSourceNotAllowlisted means that proxy has refused our source IP before
+// forwarding the request, which is different from the proxy being dead. Such
+// proxies are retried later, as they start working once our IP is allowlisted
+// with the provider.
+var errSourceNotAllowlisted = temporary("source IP is not allowlisted")
+
+type sourceNotAllowlisted struct {
+	egress string
+}
+
+func (e sourceNotAllowlisted) Error() string {
+	return fmt.Sprintf("%s: %s", errSourceNotAllowlisted, e.egress)
+}
+
+func (e sourceNotAllowlisted) Is(target error) bool {
+	return target == errSourceNotAllowlisted
+}
+
+func (e sourceNotAllowlisted) Temporary() bool {
+	return true
+}
+
+var allowlistRegex = regexp.MustCompile(`(?i)(white|allow)[- ]?list|` +
+	`ip (address )?(is )?not (allowed|authori[sz]ed|permitted)|` +
+	`unauthori[sz]ed (source|client) ip|access denied for ip`)
+
+// refusedSource tells if the proxy has rejected us at the handshake: SOCKS5
+// replies with "not allowed by ruleset", and HTTP proxies respond with 403
+// and a signature of their own instead of forwarding to the judge, either
+// to the request itself or to CONNECT of the tunnel.
+func refusedSource(res *http.Response, body string, err error) bool {
+	var connect pmux.ConnectError
+	if errors.As(err, &connect) {
+		return refusedSource(&http.Response{
+			StatusCode: connect.StatusCode,
+			Header:     connect.Header,
+		}, "", nil)
+	}
+	if err != nil {
+		return strings.Contains(err.Error(), "connection not allowed by ruleset")
+	}
+	if res == nil || res.StatusCode != http.StatusForbidden {
+		return false
+	}
+	if strings.HasPrefix(res.Header.Get("X-Squid-Error"), "ERR_ACCESS_DENIED") {
+		return true
+	}
+	return allowlistRegex.MatchString(body)
+}
@@ -0,0 +1,100 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceNotAllowlisted(t *testing.T) {
+	for i, tt := range []struct {
+		status  int
+		header  http.Header
+		body    string
+		err     error
+		refused bool
+	}{
+		{
+			status:  403,
+			header:  http.Header{"X-Squid-Error": {"ERR_ACCESS_DENIED 0"}},
+			body:    "<h1>Access Denied</h1>",
+			refused: true,
+		},
+		{
+			status:  403,
+			body:    "Your IP 255.0.0.1 is not whitelisted, add it in the dashboard",
+			refused: true,
+		},
+		{
+			status:  403,
+			body:    "IP address not authorized",
+			refused: true,
+		},
+		{
+			err:     fmt.Errorf("dial socks: socks connect tcp 1.2.3.4:1080->judge:80: unknown error connection not allowed by ruleset"),
+			refused: true,
+		},
+		{
+			status: 403,
+			body:   "Forbidden",
+		},
+		{
+			status: 200,
+			body:   "please allowlist us",
+		},
+		{
+			err: fmt.Errorf("connection refused"),
+		},
+		{
+			err: &url.Error{Op: "Get", URL: "https://judge.local/ip", Err: pmux.ConnectError{
+				StatusCode: 403,
+				Status:     "403 Forbidden",
+				Header:     http.Header{"X-Squid-Error": {"ERR_ACCESS_DENIED 0"}},
+			}},
+			refused: true,
+		},
+		{
+			err: pmux.ConnectError{
+				StatusCode: 403,
+				Status:     "403 Forbidden",
+			},
+		},
+		{
+			err: pmux.ConnectError{
+				StatusCode: 502,
+				Status:     "502 Bad Gateway",
+				Header:     http.Header{"X-Squid-Error": {"ERR_ACCESS_DENIED 0"}},
+			},
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			sc := &simple{
+				ip:   "255.0.0.1",
+				page: "http://judge.local/ip",
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &http.Response{
+						StatusCode: tt.status,
+						Header:     tt.header,
+						Body:       body(tt.body),
+					}, nil
+				}),
+			}
+			_, err := sc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			assert.Error(t, err)
+			assert.Equal(t, tt.refused, errors.Is(err, errSourceNotAllowlisted), err.Error())
+			if tt.refused {
+				assert.EqualError(t, err, "source IP is not allowlisted: 255.0.0.1")
+				assert.True(t, isTimeout(err), "retried later")
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package checker
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+var errALPN = fmt.Errorf("alpn mismatch")
+
+// alpnMismatch is the protocol, that the origin has negotiated through the
+// proxy, but checks have never offered, or no protocol when it's required
+type alpnMismatch struct {
+	offered    []string
+	negotiated string
+}
+
+func (e alpnMismatch) Error() string {
+	negotiated := e.negotiated
+	if negotiated == "" {
+		negotiated = "none"
+	}
+	return fmt.Sprintf("%s: negotiated %s, offered %s", errALPN, negotiated,
+		strings.Join(e.offered, ","))
+}
+
+func (e alpnMismatch) Is(target error) bool {
+	return target == errALPN
+}
+
+// alpn are protocols offered in TLS handshakes with judges
+type alpn struct {
+	protos  []string
+	require bool
+}
+
+// parseALPN parses comma-separated protocols in the order of preference,
+// e.g. "h2, http/1.1"
+func parseALPN(raw string) (out []string) {
+	for _, v := range strings.Split(raw, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// withALPN copies the transport of checks, so that handshakes with origins
+// offer the protocols both over CONNECT and through SOCKS tunnels. HTTP/2 is
+// spoken, once it's offered and negotiated.
+func withALPN(rt http.RoundTripper, protos []string) http.RoundTripper {
+	t, ok := rt.(*http.Transport)
+	if !ok || len(protos) == 0 {
+		return rt
+	}
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = pmux.DefaultTlsConfig.Clone()
+	}
+	t.TLSClientConfig.NextProtos = protos
+	if t.DialTLSContext != nil {
+		t.DialTLSContext = pmux.DialTLSWith(t.TLSClientConfig)
+	}
+	for _, v := range protos {
+		if v == "h2" {
+			t.ForceAttemptHTTP2 = true
+		}
+	}
+	return t
+}
+
+// verify records the negotiated protocol and checks, that it was offered
+func (a *alpn) verify(o *observation, res *http.Response) error {
+	if res.TLS == nil {
+		return nil
+	}
+	negotiated := res.TLS.NegotiatedProtocol
+	o.negotiated(negotiated)
+	if a == nil {
+		return nil
+	}
+	if negotiated == "" {
+		if a.require {
+			return alpnMismatch{a.protos, negotiated}
+		}
+		return nil
+	}
+	for _, v := range a.protos {
+		if v == negotiated {
+			return nil
+		}
+	}
+	return alpnMismatch{a.protos, negotiated}
+}
@@ -0,0 +1,78 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseALPN(t *testing.T) {
+	assert.Equal(t, []string{"h2", "http/1.1"}, parseALPN(" h2, http/1.1,"))
+	assert.Nil(t, parseALPN(""))
+}
+
+func TestWithALPN(t *testing.T) {
+	original := pmux.ContextualHttpTransport()
+	rt := withALPN(original, []string{"h2", "http/1.1"})
+	transport := rt.(*http.Transport)
+	assert.NotSame(t, original, transport)
+	assert.Equal(t, []string{"h2", "http/1.1"}, transport.TLSClientConfig.NextProtos)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.Equal(t, []string{"http/1.1"}, pmux.DefaultTlsConfig.NextProtos)
+	assert.Same(t, original, withALPN(original, nil))
+}
+
+func TestALPNVerify(t *testing.T) {
+	for i, tt := range []struct {
+		alpn       *alpn
+		negotiated string
+		err        string
+	}{
+		{nil, "h2", ""},
+		{&alpn{protos: []string{"h2", "http/1.1"}}, "h2", ""},
+		{&alpn{protos: []string{"http/1.1"}}, "h2", "alpn mismatch: negotiated h2, offered http/1.1"},
+		{&alpn{protos: []string{"h2"}}, "", ""},
+		{&alpn{protos: []string{"h2"}, require: true}, "", "alpn mismatch: negotiated none, offered h2"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			o := &observation{}
+			err := tt.alpn.verify(o, &http.Response{
+				TLS: &tls.ConnectionState{NegotiatedProtocol: tt.negotiated},
+			})
+			assert.Equal(t, tt.negotiated, o.negotiatedProtocol())
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+			assert.ErrorIs(t, err, errALPN)
+		})
+	}
+}
+
+func TestResultReportsALPN(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip:   "5.6.7.8",
+				page: "https://judge/ip",
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						Body:       body("1.2.3.4"),
+						TLS:        &tls.ConnectionState{NegotiatedProtocol: "h2"},
+					}, nil
+				}),
+			},
+		},
+	}
+	cc.use(checkerConfig{})
+	r := cc.Result(context.Background(), pmux.HttpProxy("127.0.0.1:23"))
+	assert.NoError(t, r.Err)
+	assert.Equal(t, "h2", r.ALPN)
+}
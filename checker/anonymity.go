@@ -0,0 +1,124 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AnonymityPolicy grades the proxy by the request headers, that the judge
+// has reported, as either Anonymous or Transparent, so that users could
+// decide on their own, whether headers like Via are tolerable. Responses
+// revealing this IP are transparent regardless of the policy.
+type AnonymityPolicy interface {
+	Grade(ip string, headers http.Header) string
+}
+
+// transparentByPolicy is the verdict of the policy, rather than IP leak
+type transparentByPolicy struct{}
+
+func (transparentByPolicy) Error() string {
+	return "transparent by anonymity policy"
+}
+
+func (transparentByPolicy) Is(target error) bool {
+	return target == ErrNotAnonymous
+}
+
+// AnonymityFunc adapts plain functions to AnonymityPolicy
+type AnonymityFunc func(ip string, headers http.Header) string
+
+func (f AnonymityFunc) Grade(ip string, headers http.Header) string {
+	return f(ip, headers)
+}
+
+// DefaultAnonymityPolicy tolerates any headers, that don't reveal this IP
+var DefaultAnonymityPolicy AnonymityPolicy = headerPolicy{}
+
+// headerPolicy is transparent, when any of the headers is present
+type headerPolicy struct {
+	transparent []string
+}
+
+func (p headerPolicy) Grade(_ string, headers http.Header) string {
+	for _, name := range p.transparent {
+		if headers.Get(name) != "" {
+			return Transparent
+		}
+	}
+	return Anonymous
+}
+
+var anonymityPolicies = struct {
+	sync.Mutex
+	byName map[string]AnonymityPolicy
+}{
+	byName: map[string]AnonymityPolicy{},
+}
+
+// RegisterAnonymityPolicy makes the policy available for anonymity_policy
+func RegisterAnonymityPolicy(name string, policy AnonymityPolicy) {
+	anonymityPolicies.Lock()
+	defer anonymityPolicies.Unlock()
+	anonymityPolicies.byName[name] = policy
+}
+
+// configurePolicy picks the registered policy by name, where the default
+// one is made transparent by transparent_headers, e.g. "Via, Forwarded"
+func configurePolicy(name, transparentHeaders string) (AnonymityPolicy, error) {
+	if name == "" || name == "default" {
+		var p headerPolicy
+		for _, header := range strings.Split(transparentHeaders, ",") {
+			header = strings.TrimSpace(header)
+			if header == "" {
+				continue
+			}
+			p.transparent = append(p.transparent, header)
+		}
+		if len(p.transparent) == 0 {
+			return DefaultAnonymityPolicy, nil
+		}
+		return p, nil
+	}
+	anonymityPolicies.Lock()
+	defer anonymityPolicies.Unlock()
+	policy, ok := anonymityPolicies.byName[name]
+	if !ok {
+		known := []string{"default"}
+		for k := range anonymityPolicies.byName {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("invalid anonymity policy: %s, known: %s", name,
+			strings.Join(known, ", "))
+	}
+	return policy, nil
+}
+
+// reportedHeaders parses headers from JSON objects or "key: value" lines,
+// that judges report them in, where underscores are dashes
+func reportedHeaders(body string) http.Header {
+	out := http.Header{}
+	body = strings.TrimSpace(body)
+	if strings.HasPrefix(body, "{") {
+		var raw map[string]interface{}
+		if json.Unmarshal([]byte(body), &raw) != nil {
+			return out
+		}
+		for k, v := range raw {
+			out.Add(strings.ReplaceAll(k, "_", "-"), fmt.Sprint(v))
+		}
+		return out
+	}
+	for _, line := range strings.Split(body, "\n") {
+		split := strings.SplitN(line, ":", 2)
+		if len(split) != 2 || strings.ContainsAny(split[0], " \t") {
+			continue
+		}
+		out.Add(strings.ReplaceAll(split[0], "_", "-"), strings.TrimSpace(split[1]))
+	}
+	return out
+}
@@ -0,0 +1,74 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportedHeaders(t *testing.T) {
+	h := reportedHeaders("ip_addr: 1.2.3.4\nuser_agent: curl/7.0\nvia: 1.1 squid\nreferer:\n")
+	assert.Equal(t, "1.1 squid", h.Get("Via"))
+	assert.Equal(t, "curl/7.0", h.Get("User-Agent"))
+	assert.Equal(t, "", h.Get("Referer"))
+
+	h = reportedHeaders(`{"ip": "1.2.3.4", "forwarded": "for=5.6.7.8", "port": 443}`)
+	assert.Equal(t, "for=5.6.7.8", h.Get("Forwarded"))
+	assert.Equal(t, "443", h.Get("Port"))
+
+	assert.Len(t, reportedHeaders("{nope"), 0)
+}
+
+func TestAnonymityPolicy(t *testing.T) {
+	RegisterAnonymityPolicy("no-agent", AnonymityFunc(func(ip string, headers http.Header) string {
+		if headers.Get("User-Agent") == "" {
+			return Transparent
+		}
+		return Anonymous
+	}))
+	for i, tt := range []struct {
+		policy    string
+		headers   string
+		body      string
+		expectErr string
+	}{
+		{body: "user_agent: x\nvia: 1.1 squid"},
+		{headers: "Via", body: "user_agent: x\nvia: 1.1 squid", expectErr: "transparent by anonymity policy"},
+		{headers: "Via, Forwarded", body: "user_agent: x\nforwarded: for=1.2.3.4", expectErr: "transparent by anonymity policy"},
+		{headers: "Via, Forwarded", body: "user_agent: x\nforwarded:"},
+		{headers: "Via", body: "user_agent: x\nforwarded: for=255.0.0.1", expectErr: "this IP address found"},
+		{policy: "no-agent", body: "user_agent: x"},
+		{policy: "no-agent", body: "ip_addr: 1.2.3.4\nuser_agent", expectErr: "no user_agent: found: ip_addr: ip user_agent"},
+		{policy: "no-agent", body: "ip_addr: 1.2.3.4\nuser_agent:", expectErr: "transparent by anonymity policy"},
+		{policy: "nope", expectErr: "invalid anonymity policy: nope, known: default, no-agent"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			policy, err := configurePolicy(tt.policy, tt.headers)
+			if err != nil {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			sc := &simple{
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: 200, Body: body(tt.body)}, nil
+				}),
+				page:   "https://judge/all",
+				valid:  "user_agent:",
+				ip:     "255.0.0.1",
+				policy: policy,
+			}
+			_, err = sc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+	assert.True(t, errors.Is(transparentByPolicy{}, ErrNotAnonymous))
+}
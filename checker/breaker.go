@@ -0,0 +1,116 @@
+package checker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+var errProxyCircuitOpen = temporary("proxy circuit is open")
+
+// circuitOpen is the cached failure, that is returned without checking the
+// proxy again until the cooldown elapses
+type circuitOpen struct {
+	last  error
+	until time.Time
+}
+
+func (e circuitOpen) Error() string {
+	return fmt.Sprintf("%s until %s: %s", errProxyCircuitOpen,
+		e.until.Format(time.RFC3339), e.last)
+}
+
+func (e circuitOpen) Is(target error) bool {
+	return target == errProxyCircuitOpen
+}
+
+func (e circuitOpen) Unwrap() error {
+	return e.last
+}
+
+// Temporary makes the scheduler retry the proxy later
+func (e circuitOpen) Temporary() bool {
+	return true
+}
+
+type breakerState struct {
+	failures int
+	last     error
+	until    time.Time
+	// failed is when the last failure was recorded
+	failed time.Time
+}
+
+// breakerRetention is the number of cooldowns, after which the state of the
+// proxy, that was not checked since, is forgotten, as proxies gone from the
+// pool never recover and would otherwise stay in the map forever
+const breakerRetention = 10
+
+// breakers protect judges and proxies from needless load of an eager
+// scheduler re-checking the proxy, that has just failed, in a tight loop
+type breakers struct {
+	sync.Mutex
+	states map[pmux.Proxy]breakerState
+	now    func() time.Time
+	swept  time.Time
+}
+
+func newBreakers() *breakers {
+	return &breakers{
+		states: map[pmux.Proxy]breakerState{},
+		now:    time.Now,
+	}
+}
+
+// open returns the cached failure, if the circuit of the proxy is open
+func (b *breakers) open(proxy pmux.Proxy) error {
+	b.Lock()
+	defer b.Unlock()
+	s, ok := b.states[proxy]
+	if !ok || !b.now().Before(s.until) {
+		return nil
+	}
+	return circuitOpen{s.last, s.until}
+}
+
+// record opens the circuit after consecutive failures. Once the cooldown
+// elapses, a single failure is enough to open it again. Temporary errors,
+// like timeouts or paced judges, are retried by the scheduler anyway and
+// don't count, so that only hard failures open the circuit.
+func (b *breakers) record(proxy pmux.Proxy, err error, failures int, cooldown time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	b.sweep(breakerRetention * cooldown)
+	if err == nil {
+		delete(b.states, proxy)
+		return
+	}
+	if isTimeout(err) {
+		return
+	}
+	s := b.states[proxy]
+	s.failures++
+	s.last = err
+	s.failed = b.now()
+	if s.failures >= failures {
+		s.until = b.now().Add(cooldown)
+	}
+	b.states[proxy] = s
+}
+
+// sweep forgets proxies, that have not failed within retention. It runs at
+// most once per retention, so that the map is scanned only occasionally.
+func (b *breakers) sweep(retention time.Duration) {
+	now := b.now()
+	if now.Sub(b.swept) < retention {
+		return
+	}
+	b.swept = now
+	for proxy, s := range b.states {
+		if now.Sub(s.failed) >= retention {
+			delete(b.states, proxy)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyCircuitBreaker(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	requests := 0
+	fail := true
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip: "255.0.0.1",
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					requests++
+					if fail {
+						return nil, fmt.Errorf("connection reset")
+					}
+					return &http.Response{StatusCode: 200, Body: body("1.2.3.4")}, nil
+				}),
+			},
+		},
+		breakers: newBreakers(),
+	}
+	cc.breakers.now = func() time.Time {
+		return now
+	}
+	cc.use(checkerConfig{
+		breakerFailures: 2,
+		breakerCooldown: time.Minute,
+	})
+	ctx := context.Background()
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	check := func() error {
+		_, err := cc.Check(ctx, proxy)
+		return err
+	}
+
+	assert.EqualError(t, check(), "connection reset")
+	assert.EqualError(t, check(), "connection reset")
+	err := check()
+	assert.True(t, errors.Is(err, errProxyCircuitOpen))
+	assert.EqualError(t, err, "proxy circuit is open until 2022-01-01T00:01:00Z: connection reset")
+	assert.True(t, isTimeout(err))
+	assert.Equal(t, 2, requests, "short-circuited")
+
+	// half-open after cooldown: single failure opens it again
+	now = now.Add(time.Minute)
+	assert.EqualError(t, check(), "connection reset")
+	assert.True(t, errors.Is(check(), errProxyCircuitOpen))
+	assert.Equal(t, 3, requests)
+
+	now = now.Add(time.Minute)
+	fail = false
+	assert.NoError(t, check())
+	assert.NoError(t, check())
+	assert.Equal(t, 5, requests)
+}
+
+func TestTemporaryErrorsDoNotOpenCircuit(t *testing.T) {
+	b := newBreakers()
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	for i := 0; i < 3; i++ {
+		b.record(proxy, errJudgePaced, 1, time.Minute)
+	}
+	assert.NoError(t, b.open(proxy))
+	assert.Empty(t, b.states)
+
+	b.record(proxy, fmt.Errorf("connection reset"), 2, time.Minute)
+	b.record(proxy, errJudgePaced, 2, time.Minute)
+	assert.NoError(t, b.open(proxy))
+	b.record(proxy, fmt.Errorf("connection reset"), 2, time.Minute)
+	assert.EqualError(t, b.open(proxy), "proxy circuit is open until "+
+		b.states[proxy].until.Format(time.RFC3339)+": connection reset")
+}
+
+func TestProxyCircuitBreakerIsDisabledByDefault(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				client: staticResponseClient{err: fmt.Errorf("nope")},
+			},
+		},
+		breakers: newBreakers(),
+	}
+	for i := 0; i < 5; i++ {
+		_, err := cc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+		assert.EqualError(t, err, "nope")
+	}
+}
+
+func TestBreakersForgetGoneProxies(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBreakers()
+	b.now = func() time.Time {
+		return now
+	}
+	gone := pmux.HttpProxy("127.0.0.1:1")
+	kept := pmux.HttpProxy("127.0.0.1:2")
+	b.record(gone, fmt.Errorf("nope"), 1, time.Minute)
+	assert.Error(t, b.open(gone))
+
+	now = now.Add(breakerRetention * time.Minute)
+	b.record(kept, fmt.Errorf("nope"), 1, time.Minute)
+	assert.NoError(t, b.open(gone))
+	assert.Error(t, b.open(kept))
+	assert.Len(t, b.states, 1)
+}
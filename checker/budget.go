@@ -0,0 +1,40 @@
+package checker
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+var errJudgeBudget = temporary("judge budget exhausted")
+
+// judgeBudget is what is left of max_judges_per_check for the check. It is
+// shared by all passes and fan-outs of the strategy, that run on the check.
+type judgeBudget struct {
+	left int64
+	max  int
+}
+
+// withBudget caps judge requests of the check, unless it's capped already
+func withBudget(ctx context.Context, max int) context.Context {
+	if max <= 0 || spent(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetKey, &judgeBudget{int64(max), max})
+}
+
+func spent(ctx context.Context) *judgeBudget {
+	b, _ := ctx.Value(budgetKey).(*judgeBudget)
+	return b
+}
+
+// spend takes one judge request from the budget of the check
+func spend(ctx context.Context) error {
+	b := spent(ctx)
+	if b == nil {
+		return nil
+	}
+	if atomic.AddInt64(&b.left, -1) < 0 {
+		return errJudgeBudget
+	}
+	return nil
+}
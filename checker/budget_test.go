@@ -0,0 +1,102 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJudgeBudget(t *testing.T) {
+	var requests int32
+	client := clientFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return &http.Response{
+			StatusCode: 200,
+			Body:       body("1.2.3.4"),
+		}, nil
+	})
+	judge := func(page string) federated {
+		return federated{judges: []*simple{{
+			client: client,
+			page:   page,
+			valid:  "1.2.3.4",
+			ip:     "255.0.0.1",
+		}}}
+	}
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"twopass": twoPass{
+				first:  judge("https://first/"),
+				second: judge("https://second/"),
+			},
+			"head": federated{judges: []*simple{{
+				client:    client,
+				page:      "https://head/",
+				ip:        "255.0.0.1",
+				headFirst: true,
+			}}},
+		},
+	}
+	ctx := context.Background()
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+
+	cc.use(checkerConfig{strategy: "twopass", maxJudges: 1})
+	_, err := cc.Check(ctx, proxy)
+	assert.NoError(t, err, "first pass verdict is returned")
+	assert.Equal(t, int32(1), requests)
+
+	cc.use(checkerConfig{strategy: "twopass"})
+	_, err = cc.Check(ctx, proxy)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), requests, "unlimited by default")
+
+	cc.use(checkerConfig{strategy: "head", maxJudges: 1})
+	_, err = cc.Check(ctx, proxy)
+	assert.Equal(t, errJudgeBudget, err)
+	assert.True(t, isTimeout(err), "checked again later")
+	assert.Equal(t, int32(4), requests)
+}
+
+func TestJudgeBudgetCoversProbes(t *testing.T) {
+	var pages []string
+	client := clientFunc(func(req *http.Request) (*http.Response, error) {
+		pages = append(pages, req.URL.Host)
+		raw := "1.2.3.4"
+		if req.URL.Host == "fingerprint" {
+			raw = `{"ttl": 64}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       body(raw),
+		}, nil
+	})
+	fc, err := newFingerprint(client, "https://fingerprint/tcp", "")
+	assert.NoError(t, err)
+	cc := (&configurableChecker{}).use(checkerConfig{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				client: client,
+				page:   "https://judge/ip",
+				ip:     "255.0.0.1",
+			},
+		},
+		fingerprint: fc,
+		hot:         &hotDestination{client: client, page: "https://hot/"},
+		maxJudges:   2,
+	})
+	r := cc.Result(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+	assert.True(t, r.Ok(), r.Failure)
+	assert.Equal(t, []string{"judge", "fingerprint"}, pages, "hot destination is over budget")
+
+	cc.use(checkerConfig{
+		strategies:  cc.current().strategies,
+		fingerprint: fc,
+		maxJudges:   1,
+	})
+	_, err = cc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+	assert.ErrorIs(t, err, errJudgeBudget)
+}
@@ -0,0 +1,50 @@
+package checker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/nfx/slrp/app"
+)
+
+// configureDirectCA loads direct_ca bundle, that direct calls trust on top
+// of system roots, which is needed in TLS-intercepting corporate networks.
+// Checks of candidate proxies never use it.
+func configureDirectCA(conf app.Config) (*tls.Config, error) {
+	pool, err := loadRoots(conf, "direct_ca")
+	if pool == nil || err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		RootCAs:    pool,
+		NextProtos: []string{"http/1.1"},
+	}, nil
+}
+
+// configureJudgeCA loads judge_ca bundle, that certificates of judges are
+// verified against through proxies, e.g. of the self-hosted judge
+func configureJudgeCA(conf app.Config) (*x509.CertPool, error) {
+	return loadRoots(conf, "judge_ca")
+}
+
+// loadRoots appends PEM bundle from the key to system roots, if configured
+func loadRoots(conf app.Config, key string) (*x509.CertPool, error) {
+	location := conf.StrOr(key, "")
+	if location == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("%s: no certificates in %s", key, location)
+	}
+	return pool, nil
+}
@@ -0,0 +1,60 @@
+package checker
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}), 0o600))
+
+	cc := configurableChecker{
+		ip:     "255.0.0.1",
+		client: &http.Client{},
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	err := cc.Configure(app.Config{})
+	assert.NoError(t, err)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	_, err = cc.current().direct.Do(req)
+	assert.Error(t, err, "intercepted calls fail without the bundle")
+
+	err = cc.Configure(app.Config{"direct_ca": bundle})
+	assert.NoError(t, err)
+	cfg := cc.current()
+	assert.NotEqual(t, cfg.client, cfg.direct, "candidates never use direct_ca")
+	res, err := cfg.direct.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+}
+
+func TestConfigureDirectCA(t *testing.T) {
+	tlsConfig, err := configureDirectCA(app.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	_, err = configureDirectCA(app.Config{"direct_ca": "nope.pem"})
+	assert.EqualError(t, err, "direct_ca: open nope.pem: no such file or directory")
+
+	junk := filepath.Join(t.TempDir(), "junk.pem")
+	assert.NoError(t, os.WriteFile(junk, []byte("junk"), 0o600))
+	_, err = configureDirectCA(app.Config{"direct_ca": junk})
+	assert.EqualError(t, err, "direct_ca: no certificates in "+junk)
+}
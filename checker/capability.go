@@ -0,0 +1,99 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Capability is a bitfield of what capability probes have verified
+// the proxy to be able to do
+type Capability uint32
+
+const (
+	// Chunked means all chunks of chunked response arrived intact
+	Chunked Capability = 1 << iota
+	// Streaming means chunks arrived as they were sent, not buffered
+	Streaming
+	// KeepAlive means requests within one connection reached the judge
+	// over the same upstream connection
+	KeepAlive
+	// Pipelining means requests sent back-to-back got responses in order
+	Pipelining
+	// Trailers means trailers of chunked response arrived intact
+	Trailers
+	// Informational means final response arrived intact after 1xx one
+	Informational
+	// EarlyHints means 103 Early Hints response was forwarded as well
+	EarlyHints
+	// SurvivesIdle means connection was reused after idle_duration
+	SurvivesIdle
+	// TLSExtensions means the judge has received TLS extensions of the
+	// ClientHello exactly as they were sent
+	TLSExtensions
+	// ConnectHostname means the proxy tunnels to targets by hostname
+	ConnectHostname
+	// ConnectIP means the proxy tunnels to targets by IP literal
+	ConnectIP
+)
+
+var capabilityNames = []string{
+	"chunked",
+	"streaming",
+	"keep_alive",
+	"pipelining",
+	"trailers",
+	"informational",
+	"early_hints",
+	"survives_idle",
+	"tls_extensions",
+	"connect_hostname",
+	"connect_ip",
+}
+
+func (c Capability) Has(other Capability) bool {
+	return c&other == other
+}
+
+func (c Capability) Names() (out []string) {
+	for i, name := range capabilityNames {
+		if c.Has(1 << i) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (c Capability) String() string {
+	return strings.Join(c.Names(), ",")
+}
+
+func (c Capability) MarshalJSON() ([]byte, error) {
+	names := c.Names()
+	if names == nil {
+		names = []string{}
+	}
+	return json.Marshal(names)
+}
+
+func (c *Capability) UnmarshalJSON(b []byte) error {
+	var names []string
+	err := json.Unmarshal(b, &names)
+	if err != nil {
+		return err
+	}
+	*c = 0
+	for _, name := range names {
+		known := false
+		for i, v := range capabilityNames {
+			if v == name {
+				*c |= 1 << i
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown capability: %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package checker
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var errCaptivePortal = fmt.Errorf("host network intercepts traffic")
+
+// captivePortal is the response, that the network of this host has served
+// instead of the judge, e.g. the login page of hotel Wi-Fi. Every proxy
+// would fail the same way, so it's reported as the problem of the host.
+type captivePortal struct {
+	reason string
+}
+
+func (e captivePortal) Error() string {
+	return fmt.Sprintf("%s: %s", errCaptivePortal, e.reason)
+}
+
+func (e captivePortal) Is(target error) bool {
+	return target == errCaptivePortal
+}
+
+// detectCaptivePortal compares the direct response with what the judge is
+// expected to serve: the same host, the certificate for it, and no network
+// authentication demanded
+func detectCaptivePortal(page string, res *http.Response, roots *x509.CertPool) error {
+	if res.StatusCode == http.StatusNetworkAuthenticationRequired {
+		return captivePortal{"network authentication required"}
+	}
+	if res.Request == nil {
+		return nil
+	}
+	expected, err := url.Parse(page)
+	if err != nil {
+		return err
+	}
+	if res.Request.URL.Hostname() != expected.Hostname() {
+		return captivePortal{fmt.Sprintf("redirected to %s", res.Request.URL.Hostname())}
+	}
+	err = verifyTLS(res, roots)
+	if err != nil {
+		return captivePortal{err.Error()}
+	}
+	return nil
+}
+
+// interceptedTLS tells if the request failed on the certificate, that the
+// system roots don't trust for the judge
+func interceptedTLS(err error) error {
+	var unknown x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknown), errors.As(err, &hostname), errors.As(err, &invalid):
+		return captivePortal{err.Error()}
+	}
+	return err
+}
+
+// lookupIP requests this IP from the judge, that reports nothing else
+func lookupIP(ctx context.Context, client httpClient, page string, roots *x509.CertPool) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", page, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", interceptedTLS(err)
+	}
+	defer res.Body.Close()
+	err = detectCaptivePortal(page, res, roots)
+	if err != nil {
+		return "", err
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(raw))
+	if net.ParseIP(ip) == nil {
+		return "", captivePortal{fmt.Sprintf("not an ip: %s", truncatedBody(ctx, ip))}
+	}
+	return ip, nil
+}
@@ -0,0 +1,164 @@
+package checker
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectCaptivePortal(t *testing.T) {
+	landed := func(page string) *http.Request {
+		u, _ := url.Parse(page)
+		return &http.Request{URL: u}
+	}
+	for i, tt := range []struct {
+		res *http.Response
+		err string
+	}{
+		{&http.Response{StatusCode: 200}, ""},
+		{&http.Response{StatusCode: 511}, "host network intercepts traffic: network authentication required"},
+		{&http.Response{
+			StatusCode: 200,
+			Request:    landed("http://login.hotel/portal"),
+		}, "host network intercepts traffic: redirected to login.hotel"},
+		{&http.Response{
+			StatusCode: 200,
+			Request:    landed("https://judge.example.com/ip"),
+		}, "host network intercepts traffic: tls stripped: no tls connection"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			err := detectCaptivePortal("https://judge.example.com/ip", tt.res, nil)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+			assert.ErrorIs(t, err, errCaptivePortal)
+		})
+	}
+}
+
+func TestLookupIP(t *testing.T) {
+	for i, tt := range []struct {
+		body string
+		ip   string
+		err  string
+	}{
+		{"1.2.3.4\n", "1.2.3.4", ""},
+		{"<html>Please log in</html>", "", "host network intercepts traffic: not an ip: Please log in"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			ip, err := lookupIP(context.Background(), srv.Client(), srv.URL, nil)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.ip, ip)
+		})
+	}
+}
+
+func TestLookupIPUntrustedCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("1.2.3.4"))
+	}))
+	defer srv.Close()
+	_, err := lookupIP(context.Background(), http.DefaultClient, srv.URL, nil)
+	assert.ErrorIs(t, err, errCaptivePortal)
+}
+
+func TestReadinessIntercepted(t *testing.T) {
+	cc := &configurableChecker{
+		ip: "255.0.0.1",
+		client: clientFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 511,
+				Body:       body("log in first"),
+			}, nil
+		}),
+		readiness: &readiness{},
+	}
+	cc.use(checkerConfig{minJudges: 0})
+	assert.Equal(t, 0, cc.ProbeJudges(context.Background()))
+	assert.False(t, cc.Ready())
+	_, err := cc.HttpGet(nil)
+	assert.EqualError(t, err, "checker is not ready: host network intercepts traffic: "+
+		"network authentication required")
+}
+
+func TestThisIPWithDirectCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("1.2.3.4"))
+	}))
+	defer srv.Close()
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}), 0o600))
+	defer func(prev string) {
+		thisIPJudge = prev
+	}(thisIPJudge)
+	thisIPJudge = srv.URL + "/ip"
+
+	cc := configurableChecker{
+		client: &http.Client{},
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	err := cc.Configure(app.Config{})
+	assert.ErrorIs(t, err, errCaptivePortal, "intercepted without the bundle")
+
+	err = cc.Configure(app.Config{"direct_ca": bundle})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", cc.current().ip)
+	assert.True(t, cc.Readiness().IP)
+}
+
+func TestThisIPWithPAC(t *testing.T) {
+	egress := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// only the egress proxy reaches the internet
+		rw.Write([]byte("5.6.7.8"))
+	}))
+	defer egress.Close()
+	path := filepath.Join(t.TempDir(), "proxy.pac")
+	assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`function FindProxyForURL(url, host) {
+		return "PROXY %s";
+	}`, egress.Listener.Addr())), 0o600))
+	defer func(prev string) {
+		thisIPJudge = prev
+	}(thisIPJudge)
+	thisIPJudge = "http://ifconfig.invalid/ip"
+
+	cc := configurableChecker{
+		client: &http.Client{},
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	err := cc.Configure(app.Config{})
+	assert.ErrorContains(t, err, "cannot get this IP")
+
+	err = cc.Configure(app.Config{"pac": path})
+	assert.NoError(t, err)
+	assert.Equal(t, "5.6.7.8", cc.current().ip)
+
+	err = cc.Configure(app.Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, "5.6.7.8", cc.current().ip, "previous IP is kept")
+}
@@ -1,20 +1,25 @@
 package checker
 
 import (
-	"bufio"
+	"bytes"
 	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/ipinfo"
 	"github.com/nfx/slrp/pmux"
 
-	"github.com/corpix/uarand"
 	"github.com/microcosm-cc/bluemonday"
 )
 
@@ -23,25 +28,12 @@ type Checker interface {
 }
 
 var (
-	firstPass = []string{
-		// these check for ext ip, but don't show headers
-		"https://ifconfig.me/ip", // okhttp
-		//"https://ifconfig.io/ip",
-		"https://myexternalip.com/raw", // okhttp
-		"https://ipv4.icanhazip.com/",  // okhttp
-		"https://ipinfo.io/ip",         // okhttp
-		"https://api.ipify.org/",       // okhttp
-		"https://wtfismyip.com/text",   // okhttp
-	}
-	secondPass = map[string]string{
-		// checks for X-Forwarded-For and alikes
-		"https://ifconfig.me/all":      "user_agent",
-		"https://ifconfig.io/all.json": "ifconfig_hostname",
-	}
 	ipRegex            = regexp.MustCompile(`(?m)^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}$`)
 	errCloudFlare      = temporary("cloudflare captcha")
 	errGoogleRatelimit = temporary("google ratelimit")
 	ErrNotAnonymous    = fmt.Errorf("this IP address found")
+	errDirectExit      = fmt.Errorf("exit IP is the same as proxy IP")
+	errRotatingExit    = fmt.Errorf("exit IP differs across passes")
 )
 
 var defaultClient httpClient = pmux.DefaultHttpClient
@@ -53,109 +45,709 @@ func init() {
 	}
 }
 
-func NewChecker() Checker {
-	ip, err := thisIP()
-	if err != nil {
-		panic(fmt.Errorf("cannot get this IP: %w", err))
-	}
+// NewChecker looks up this IP on Configure, so that it goes through the
+// configured direct client, like the rest of direct calls
+func NewChecker(ipLookup ipinfo.IpInfoGetter) Checker {
 	return &configurableChecker{
-		ip:     ip,
-		client: defaultClient,
+		ipLookup: ipLookup,
+		client:   defaultClient,
 		strategies: map[string]Checker{
-			"twopass": newTwoPass(ip, defaultClient),
-			"simple":  newFederated(firstPass, defaultClient, ip),
-			"headers": newFederated([]string{
-				"https://ifconfig.me/all",
-				"https://ifconfig.io/all.json",
-			}, defaultClient, ip),
+			"twopass": newTwoPass("", defaultClient),
+			"simple":  newFederated(ipOnly(), defaultClient, ""),
+			"headers": newFederated(judgesThat(reportsHeaders, 0), defaultClient, ""),
 		},
-		strategy: "simple",
+		readiness: &readiness{},
+		scoring:   newScoring(),
+		breakers:  newBreakers(),
+		trends:    newTrends(),
+		latencies: newLatencies(),
+		hours:     newHourlyLatency(),
+		metrics:   newMetrics(),
+		dead:      newDeadJudges(),
 	}
 }
 
 type configurableChecker struct {
-	ip         string
+	// ip is this IP, when it's known upfront, and is looked up otherwise
+	ip       string
+	ipLookup ipinfo.IpInfoGetter
+	// client and strategies are the base, that every Configure starts from
 	client     httpClient
 	strategies map[string]Checker
-	strategy   string
+	// config holds *checkerConfig, that is swapped on every Configure
+	config    atomic.Value
+	readiness *readiness
+	scoring   *scoring
+	breakers  *breakers
+	trends    *trends
+	latencies *latencies
+	hours     *hourlyLatency
+	metrics   *metrics
+	dead      *deadJudges
+}
+
+// checkerConfig is never modified once built, so that in-flight checks read
+// it once at start and reconfiguration never races with them
+type checkerConfig struct {
+	// ip is this IP, that judges must not report
+	ip     string
+	client httpClient
+	// direct is for calls without candidate proxies, e.g. to judges or APIs
+	direct      httpClient
+	strategies  map[string]Checker
+	strategy    string
+	fingerprint *fingerprint
+	probes      []capabilityProbe
+	reputation  *reputation
+	shadow      *shadow
+	results     ResultStore
+	postChecks  []namedPostCheck
+	geo         *geoConsistency
+	// warm keeps connections for direct judge probes
+	warm *warmPool
+	hot  *hotDestination
+	// judge is the base URL of self-hosted judge
+	judge string
+
+	rejectDirectExit bool
+	// reuse are strategies, that reuse connections within a check
+	reuse map[string]bool
+	// isolateHosts keeps reused connections to every judge host apart
+	isolateHosts bool
+
+	// directRoots verify judges of direct calls, where nil are system ones
+	directRoots *x509.CertPool
+
+	minJudges     int
+	probeInterval time.Duration
+	// deadFailures are direct probe failures in a row, that exclude
+	// the judge from selection
+	deadFailures int
+
+	breakerFailures int
+	breakerCooldown time.Duration
+
+	// history is the number of last checks to keep per proxy
+	history int
+	// outcomeFingerprint is reported with every result
+	outcomeFingerprint bool
+
+	// checks slower than outlierFactor times the median are cancelled
+	outlierFactor  int
+	outlierSamples int
+	// checks faster than minLatency have not reached remote judges
+	minLatency time.Duration
+	// maxJudges caps judge requests of every check
+	maxJudges int
+
+	dnsRetries    int
+	dnsRetryDelay time.Duration
+
+	// agents are sent by checks, where empty are the ones of uarand
+	agents userAgents
+	// sanitizeJSON is the inverse of preserve_json
+	sanitizeJSON bool
+	scorePolicy  scoringPolicy
+
+	// active is held by checks, so that the replaced config is retired
+	// only once checks holding it have drained
+	active *lease
+}
+
+// current returns the active configuration or defaults before Configure
+func (cc *configurableChecker) current() *checkerConfig {
+	cfg, ok := cc.config.Load().(*checkerConfig)
+	if ok {
+		return cfg
+	}
+	return &checkerConfig{
+		ip:            cc.ip,
+		client:        cc.client,
+		direct:        cc.client,
+		strategies:    cc.strategies,
+		strategy:      "simple",
+		minJudges:     1,
+		probeInterval: 5 * time.Minute,
+		scorePolicy:   defaultScoringPolicy,
+	}
+}
+
+type configKey struct{}
+
+// withConfig makes the config available to helpers deep in the check,
+// like randomAgent, that have no other way of reaching it
+func withConfig(ctx context.Context, cfg *checkerConfig) context.Context {
+	return context.WithValue(ctx, configKey{}, cfg)
+}
+
+// configured returns the config of the check or the empty one
+func configured(ctx context.Context) *checkerConfig {
+	cfg, ok := ctx.Value(configKey{}).(*checkerConfig)
+	if !ok {
+		return &checkerConfig{}
+	}
+	return cfg
+}
+
+// lease is read-locked by every check holding the config
+type lease struct {
+	sync.RWMutex
+	retired bool
+}
+
+// acquire holds the active config for the check until release is called
+func (cc *configurableChecker) acquire(ctx context.Context) (context.Context, *checkerConfig, func()) {
+	for {
+		cfg := cc.current()
+		if cfg.active == nil {
+			return withConfig(ctx, cfg), cfg, func() {}
+		}
+		cfg.active.RLock()
+		if !cfg.active.retired {
+			return withConfig(ctx, cfg), cfg, cfg.active.RUnlock
+		}
+		// Configure has just replaced it
+		cfg.active.RUnlock()
+	}
+}
+
+// retire waits for checks holding the config to finish, so that its
+// results store could be closed without losing their writes
+func (cfg *checkerConfig) retire() {
+	if cfg.active == nil {
+		return
+	}
+	cfg.active.Lock()
+	defer cfg.active.Unlock()
+	cfg.active.retired = true
 }
 
 func (cc *configurableChecker) Configure(conf app.Config) error {
-	cc.strategy = conf.StrOr("strategy", "simple")
-	_, invalidStrategy := cc.strategies[cc.strategy]
-	if !invalidStrategy {
-		return fmt.Errorf("invalid strategy: %s", cc.strategy)
+	cfg := &checkerConfig{
+		client:     cc.client,
+		strategies: map[string]Checker{},
+		active:     &lease{},
 	}
+	protos := parseALPN(conf.StrOr("alpn", ""))
 	original, ok := cc.client.(*http.Client)
 	if ok {
-		original.Timeout = conf.DurOr("timeout", 5*time.Second)
+		client := *original
+		client.Timeout = conf.DurOr("timeout", 5*time.Second)
+		client.CheckRedirect = redirectPolicy(conf.IntOr("max_redirects", 10),
+			conf.BoolOr("cross_scheme_redirects", true))
+		client.Transport = withALPN(client.Transport, protos)
+		cfg.client = &client
+	}
+	cfg.direct = cfg.client
+	ca, err := configureDirectCA(conf)
+	if err != nil {
+		return err
+	}
+	var p *pac
+	location := conf.StrOr("pac", "")
+	if location != "" {
+		p, err = configurePAC(context.Background(), cfg.client, location,
+			conf.StrOr("pac_credentials", ""))
+		if err != nil {
+			return err
+		}
+	}
+	if p != nil || ca != nil {
+		cfg.direct = p.directClient(conf.DurOr("timeout", 5*time.Second), ca)
+	}
+	if ca != nil {
+		cfg.directRoots = ca.RootCAs
 	}
+	cfg.ip, err = cc.thisIP(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot get this IP: %w", err)
+	}
+	judgeRoots, err := configureJudgeCA(conf)
+	if err != nil {
+		return err
+	}
+	cfg.warm = configureWarmPool(conf, p, ca)
+	for name, strategy := range cc.strategies {
+		cfg.strategies[name] = strategy
+	}
+	regions := configureRegions(conf, cfg.client, cfg.ip)
+	if len(regions) > 0 {
+		cfg.strategies["regional"] = regions
+	}
+	q := configureQuorum(conf, cfg.client, cfg.ip)
+	if len(q.judges) > 0 {
+		cfg.strategies["quorum"] = q
+	}
+	cov, err := configureCoverage(conf, cfg.client, cfg.ip)
+	if err != nil {
+		return err
+	}
+	cfg.strategies["coverage"] = cov
+	g := configureGolden(conf, cfg.client, cfg.ip, cfg.strategies["simple"])
+	if g != nil {
+		cfg.strategies["golden"] = *g
+	}
+	geo, err := configureGeo(conf, cc.ipLookup, regions)
+	if err != nil {
+		return err
+	}
+	cfg.geo = geo
+	tunnel, err := configureTunnel(conf)
+	if err != nil {
+		return err
+	}
+	if tunnel != nil {
+		cfg.strategies["tunnel"] = tunnel
+	}
+	cfg.strategy = conf.StrOr("strategy", "simple")
+	_, invalidStrategy := cfg.strategies[cfg.strategy]
+	if !invalidStrategy {
+		return fmt.Errorf("invalid strategy: %s", cfg.strategy)
+	}
+	cfg.reuse, err = parseReuse(conf.StrOr("reuse_connections", ""), cfg.strategies)
+	if err != nil {
+		return err
+	}
+	cfg.isolateHosts = !conf.BoolOr("coalesce_connections", true)
+	selection, err := parseSelection(conf.StrOr("selection", "random"))
+	if err != nil {
+		return err
+	}
+	for name, strategy := range cfg.strategies {
+		s, ok := strategy.(selectable)
+		if !ok {
+			continue
+		}
+		cfg.strategies[name] = s.withSelection(selection)
+	}
+	requireStableExit := conf.BoolOr("require_stable_exit", false)
+	concurrentPasses := conf.BoolOr("concurrent_passes", false)
+	for name, strategy := range cfg.strategies {
+		tp, ok := strategy.(twoPass)
+		if !ok {
+			continue
+		}
+		tp.requireStableExit = requireStableExit
+		tp.concurrent = concurrentPasses
+		cfg.strategies[name] = tp
+	}
+	cfg.rejectDirectExit = conf.BoolOr("reject_direct_exit", false)
+	cfg.minJudges = conf.IntOr("min_judges", 1)
+	cfg.probeInterval = conf.DurOr("probe_interval", 5*time.Minute)
+	cfg.deadFailures = conf.IntOr("dead_judge_failures", 3)
+	contentTypes, err := parseContentTypes(conf.StrOr("judge_content_types", ""))
+	if err != nil {
+		return err
+	}
+	logins, err := parseJudgeLogins(conf.StrOr("judge_logins", ""))
+	if err != nil {
+		return err
+	}
+	identities, err := parseJudgeIdentities(conf.StrOr("judge_identities", ""))
+	if err != nil {
+		return err
+	}
+	trust, err := parseJudgeTrust(conf.StrOr("judge_trust", ""))
+	if err != nil {
+		return err
+	}
+	judgeRegions, err := parseJudgeRegions(conf.StrOr("judge_regions", ""))
+	if err != nil {
+		return err
+	}
+	policy, err := configurePolicy(conf.StrOr("anonymity_policy", "default"),
+		conf.StrOr("transparent_headers", ""))
+	if err != nil {
+		return err
+	}
+	var offered *alpn
+	if len(protos) > 0 {
+		offered = &alpn{protos, conf.BoolOr("require_alpn", false)}
+	}
+	if cc.hours == nil {
+		cc.hours = newHourlyLatency()
+	}
+	if cc.metrics == nil {
+		cc.metrics = newMetrics()
+	}
+	if cc.dead == nil {
+		cc.dead = newDeadJudges()
+	}
+	var dead *deadJudges
+	if cfg.deadFailures > 0 {
+		dead = cc.dead
+	}
+	var hours *hourlyLatency
+	if selection == hourlySelection {
+		hours = cc.hours
+	}
+	cfg.configureJudges(original, judgeOptions{
+		interval:         conf.DurOr("judge_interval", 0),
+		ratelimitHeaders: conf.BoolOr("ratelimit_headers", true),
+		headFirst:        conf.BoolOr("head_first", false),
+		contentTypes:     contentTypes,
+		logins:           logins,
+		identities:       identities,
+		hours:            hours,
+		trust:            trust,
+		regions:          judgeRegions,
+		policy:           policy,
+		alpn:             offered,
+		metrics:          cc.metrics,
+		dead:             dead,
+		roots:            judgeRoots,
+		ip:               cfg.ip,
+	})
+	cfg.shadow, err = configureShadow(conf, cfg.strategies, cfg.strategy)
+	if err != nil {
+		return err
+	}
+	if cc.readiness == nil {
+		cc.readiness = &readiness{}
+	}
+	if cc.scoring == nil {
+		cc.scoring = newScoring()
+	}
+	cfg.scorePolicy = configureScoringPolicy(conf)
+	cfg.breakerFailures = conf.IntOr("breaker_failures", 0)
+	cfg.breakerCooldown = conf.DurOr("breaker_cooldown", time.Minute)
+	if cc.breakers == nil {
+		cc.breakers = newBreakers()
+	}
+	cfg.history = conf.IntOr("history", 0)
+	cfg.outcomeFingerprint = conf.BoolOr("outcome_fingerprint", false)
+	cfg.outlierFactor = conf.IntOr("outlier_factor", 0)
+	cfg.outlierSamples = conf.IntOr("outlier_samples", 20)
+	cfg.minLatency = conf.DurOr("min_latency", 0)
+	cfg.maxJudges = conf.IntOr("max_judges_per_check", 0)
+	cfg.dnsRetries = conf.IntOr("dns_retries", 0)
+	cfg.dnsRetryDelay = conf.DurOr("dns_retry_delay", 500*time.Millisecond)
+	if cc.latencies == nil {
+		cc.latencies = newLatencies()
+	}
+	if cc.trends == nil {
+		cc.trends = newTrends()
+	}
+	cfg.agents, err = parseUserAgents(conf.StrOr("user_agents", ""))
+	if err != nil {
+		return err
+	}
+	cfg.sanitizeJSON = !conf.BoolOr("preserve_json", true)
+	fingerprintJudge := conf.StrOr("fingerprint", "")
+	if fingerprintJudge != "" {
+		fc, err := newFingerprint(cfg.client, fingerprintJudge, conf.StrOr("fingerprint_os", ""))
+		if err != nil {
+			return fmt.Errorf("fingerprint: %w", err)
+		}
+		cfg.fingerprint = fc
+	}
+	cfg.judge = strings.TrimSuffix(conf.StrOr("judge", ""), "/")
+	cfg.probes, err = configureProbes(conf, cfg.client)
+	if err != nil {
+		return err
+	}
+	cfg.hot = configureHot(conf, cfg.client)
+	cfg.reputation, err = configureReputation(conf, cfg.direct)
+	if err != nil {
+		return err
+	}
+	cfg.postChecks, err = configurePostChecks(conf.StrOr("post_checks", ""))
+	if err != nil {
+		return err
+	}
+	prev := cc.current()
+	cfg.results, err = configureResults(conf, prev.results)
+	if err != nil {
+		return err
+	}
+	cc.config.Store(cfg)
+	prev.retire()
+	prev.shadow.wait()
+	closeResults(context.Background(), prev.results, cfg.results)
 	return nil
 }
 
 func (cc *configurableChecker) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
-	return cc.strategies[cc.strategy].Check(ctx, proxy)
+	ctx, cfg, release := cc.acquire(ctx)
+	defer release()
+	if cfg.results == nil {
+		return cc.checkWith(ctx, cfg, proxy)
+	}
+	ctx, o := observe(ctx)
+	t, err := cc.checkWith(ctx, cfg, proxy)
+	r := newResult(proxy, t, err)
+	r.Labels = labelsFrom(ctx)
+	r.observed(o)
+	cfg.store(ctx, r)
+	return t, r.Err
 }
 
-func newTwoPass(ip string, client httpClient) twoPass {
-	var res twoPass
-	for _, v := range firstPass {
-		res.first = append(res.first, &simple{
-			client: client,
-			page:   v,
-			ip:     ip,
-		})
+func (cc *configurableChecker) checkWith(ctx context.Context, cfg *checkerConfig, proxy pmux.Proxy) (time.Duration, error) {
+	ctx, o := observe(ctx)
+	defer cc.metrics.started()()
+	captchas := o.spent().captchas
+	if cfg.breakerFailures > 0 {
+		err := cc.breakers.open(proxy)
+		if err != nil {
+			return 0, redactErr(err)
+		}
 	}
-	for k, v := range secondPass {
-		res.second = append(res.second, &simple{
-			client: client,
-			page:   k,
-			valid:  v,
-			ip:     ip,
-		})
+	var t time.Duration
+	var err error
+	if cfg.outlierFactor > 0 {
+		bounded, classify := cc.latencies.bound(ctx, cfg.outlierFactor, cfg.outlierSamples)
+		t, err = cc.check(bounded, cfg, proxy)
+		err = classify(err)
+		if err == nil {
+			cc.latencies.record(t)
+		}
+	} else {
+		t, err = cc.check(ctx, cfg, proxy)
+	}
+	if err == nil && len(cfg.postChecks) > 0 {
+		// demoted proxies are scored and broken as any other failure
+		r := newResult(proxy, t, nil)
+		r.Labels = labelsFrom(ctx)
+		r.observed(o)
+		err = cfg.postCheck(ctx, proxy, r)
+	}
+	if cfg.breakerFailures > 0 {
+		cc.breakers.record(proxy, err, cfg.breakerFailures, cfg.breakerCooldown)
+	}
+	if cfg.history > 0 {
+		cc.trends.record(cfg.history, proxy, t, redactErr(err))
+	}
+	if cc.scoring != nil {
+		cc.scoring.record(cfg.scorePolicy, proxy, err == nil, o.passedJudges()...)
+		if o.spent().captchas > captchas {
+			cc.scoring.captcha(proxy)
+		}
+		if isCaptcha(err) && cc.scoring.captchaProne(cfg.scorePolicy, proxy) {
+			// it's the exit IP, that is flagged, so retries won't help
+			err = captchaProne{cc.scoring.get(proxy).CaptchaRate()}
+		}
+	}
+	cc.metrics.result(err)
+	// errors end up in logs, blacklist, and UI
+	return t, redactErr(err)
+}
+
+func (cc *configurableChecker) checkOnce(ctx context.Context, cfg *checkerConfig, proxy pmux.Proxy) (time.Duration, error) {
+	ctx, o := observe(ctx)
+	if cfg.reuse[cfg.strategy] {
+		var done func()
+		ctx, done = reuseConnections(ctx, cfg.client, cfg.isolateHosts)
+		defer done()
+	}
+	strategy := cfg.strategies[cfg.strategy]
+	if cfg.shadow != nil {
+		strategy = cfg.shadow
+	}
+	t, err := strategy.Check(ctx, proxy)
+	cc.metrics.strategy(cfg.strategy, err == nil)
+	if err != nil {
+		return t, err
+	}
+	if t < cfg.minLatency {
+		return t, implausiblyFast{t, cfg.minLatency}
+	}
+	if cfg.rejectDirectExit && isDirectExit(proxy, o.exitIPs()) {
+		return t, errDirectExit
+	}
+	if cfg.geo != nil && cfg.geo.require {
+		exits := o.exitIPs()
+		if len(exits) > 0 {
+			err = cfg.geo.verify(exits[0], o.latencies())
+			if err != nil {
+				return t, err
+			}
+		}
+	}
+	if cfg.fingerprint != nil {
+		err = cfg.fingerprint.Check(ctx, proxy)
+		if err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+func newTwoPass(ip string, client httpClient) twoPass {
+	return twoPass{
+		first:  newFederated(ipOnly(), client, ip),
+		second: newFederated(judgesThat(reportsHeaders, 0), client, ip),
 	}
-	return res
 }
 
 type twoPass struct {
 	first  federated
 	second federated
+	// requireStableExit fails the check, when passes report different exit
+	// IPs, as rotating exits break workloads relying on session affinity
+	requireStableExit bool
+	// concurrent runs passes at the same time, cancelling the second one,
+	// once the first one fails
+	concurrent bool
+}
+
+func (f twoPass) withSelection(s selection) Checker {
+	f.first = f.first.selectBy(s)
+	f.second = f.second.selectBy(s)
+	return f
 }
 
 func (f twoPass) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
-	t, err := f.first.Check(ctx, proxy)
+	parent := observed(ctx)
+	firstCtx, first := detach(ctx)
+	secondCtx, second := detach(ctx)
+	pass := func() (time.Duration, error) {
+		return f.second.Check(secondCtx, proxy)
+	}
+	if f.concurrent {
+		var cancel context.CancelFunc
+		secondCtx, cancel = context.WithCancel(secondCtx)
+		defer cancel()
+		pass = f.startSecond(secondCtx, proxy)
+	}
+	t, err := f.first.Check(firstCtx, proxy)
+	parent.merge(first)
 	if isTimeout(err) {
 		return t, err
 	}
 	if err != nil {
 		return t, fmt.Errorf("first: %w", err)
 	}
-	t, err = f.second.Check(ctx, proxy)
+	firstT := t
+	t, err = pass()
+	parent.merge(second)
+	if errors.Is(err, errJudgeBudget) {
+		// verdict of the first pass is all there is
+		return firstT, nil
+	}
 	if isTimeout(err) {
 		return t, err
 	}
 	if err != nil {
 		return t, fmt.Errorf("second: %w", err)
 	}
+	if isRotating(first.exitIPs(), second.exitIPs()) {
+		parent.rotatingExit()
+		if f.requireStableExit {
+			return t, errRotatingExit
+		}
+	}
 	return t, nil
 }
 
-type federated []*simple
+// startSecond runs the second pass alongside the first one and returns the
+// wait for its outcome. Failed first pass cancels it by the deferred cancel,
+// and its outcome is never waited for nor merged, like in sequential run.
+func (f twoPass) startSecond(ctx context.Context, proxy pmux.Proxy) func() (time.Duration, error) {
+	type outcome struct {
+		t   time.Duration
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		t, err := f.second.Check(ctx, proxy)
+		done <- outcome{t, err}
+	}()
+	return func() (time.Duration, error) {
+		v := <-done
+		return v.t, v.err
+	}
+}
+
+// isRotating tells if passes have seen completely different exits
+func isRotating(first, second []string) bool {
+	if len(first) == 0 || len(second) == 0 {
+		return false
+	}
+	for _, a := range first {
+		for _, b := range second {
+			if a == b {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// selection defines how federated strategies pick the judge for the check
+type selection string
+
+const (
+	randomSelection     selection = "random"
+	roundRobinSelection selection = "round-robin"
+	// fixedOrderSelection always starts from the first judge, so
+	// that failing checks reproduce identically in CI and debugging
+	fixedOrderSelection selection = "fixed-order"
+	// hourlySelection avoids judges, that are slow at this hour of the day
+	hourlySelection selection = "hourly"
+)
+
+type selectable interface {
+	withSelection(selection) Checker
+}
+
+func parseSelection(raw string) (selection, error) {
+	s := selection(raw)
+	switch s {
+	case randomSelection, roundRobinSelection, fixedOrderSelection, hourlySelection:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid selection: %s", raw)
+	}
+}
 
-func newFederated(sites []string, client httpClient, ip string) (out federated) {
-	for _, v := range firstPass {
-		out = append(out, &simple{
+type federated struct {
+	judges    []*simple
+	selection selection
+	next      *uint32
+}
+
+func newFederated(entries []judgeEntry, client httpClient, ip string) (out federated) {
+	for _, v := range entries {
+		out.judges = append(out.judges, &simple{
 			client: client,
-			page:   v,
+			page:   v.page,
+			valid:  v.valid,
 			ip:     ip,
 		})
 	}
+	out.next = new(uint32)
 	return out
 }
 
+func (f federated) selectBy(s selection) federated {
+	f.selection = s
+	if f.next == nil {
+		f.next = new(uint32)
+	}
+	return f
+}
+
+func (f federated) withSelection(s selection) Checker {
+	return f.selectBy(s)
+}
+
+func (f federated) pick() *simple {
+	f = f.alive()
+	switch f.selection {
+	case roundRobinSelection:
+		n := atomic.AddUint32(f.next, 1) - 1
+		return f.judges[n%uint32(len(f.judges))]
+	case fixedOrderSelection:
+		return f.judges[0]
+	case hourlySelection:
+		return f.pickHourly()
+	default:
+		return f.judges[rand.Intn(len(f.judges))]
+	}
+}
+
 func (f federated) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
-	choice := rand.Intn(len(f))
-	return f[choice].Check(ctx, proxy)
+	return f.pick().Check(ctx, proxy)
 }
 
 type httpClient interface {
@@ -167,40 +759,178 @@ type simple struct {
 	page   string
 	valid  string
 	ip     string
+	pacer  *pacer
+	// headFirst confirms the proxy with HEAD before escalating to GET
+	headFirst bool
+	// contentType is the expected media type of responses, if any
+	contentType string
+	// session is the login of private judge, if any
+	session *session
+	// identity is the pinned IP or DNS name of the judge certificate
+	identity string
+	// roots verify judge certificates, where nil are the system ones
+	roots *x509.CertPool
+	// hours is the latency of judges by hour for hourly selection
+	hours *hourlyLatency
+	// trust is the weight of the verdict of the judge in quorum
+	trust int
+	// region is where the judge is located, if known
+	region string
+	// policy grades headers reported by the judge
+	policy AnonymityPolicy
+	// alpn are protocols offered to the judge, if configured
+	alpn *alpn
+	// metrics record health of the judge
+	metrics *metrics
+	// dead are judges excluded from selection
+	dead *deadJudges
 }
 
 func (sc *simple) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+	var err error
+	if !shadowed(ctx) {
+		// shadow checks don't take slots of live ones
+		err = sc.pacer.wait(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
 	start := time.Now()
-	page := sc.page
-	if proxy.Proto() == pmux.HTTP {
-		page = strings.Replace(page, "https", "http", 1)
+	page := judgePage(proxy, sc.page)
+	if sc.identity != "" {
+		// pinned judges are reached over TLS even through HTTP proxies
+		page = sc.page
 	}
-	req, err := http.NewRequestWithContext(proxy.InContext(ctx), "GET", page, nil)
+	if sc.headFirst {
+		_, err = sc.exchange(ctx, proxy, "HEAD", page, sc.validateHead)
+		if err != nil {
+			return 0, err
+		}
+	}
+	body, err := sc.exchange(ctx, proxy, "GET", page, func(res *http.Response, body string) error {
+		return sc.validate(ctx, res.Header.Get("Content-Type"), body)
+	})
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("User-Agent", uarand.GetRandom())
-	res, err := sc.client.Do(req)
+	o := observed(ctx)
+	for _, ip := range reportedIPs(body) {
+		o.exit(ip)
+	}
+	o.passed(sc.page)
+	took := time.Now().Sub(start) // TODO: speed is always the same?...
+	if !shadowed(ctx) {
+		sc.hours.record(sc.page, took)
+	}
+	if sc.region != "" {
+		o.latency(sc.region, took)
+	}
+	return took, nil
+}
+
+// exchange makes the request to the judge and validates the response
+func (sc *simple) exchange(ctx context.Context, proxy pmux.Proxy, method, page string,
+	validate func(*http.Response, string) error) (string, error) {
+	ctx, record := traced(ctx, method, page)
+	start := time.Now()
+	res, body, err := sc.request(ctx, proxy, method, page)
+	switch {
+	case refusedSource(res, body, err):
+		err = sourceNotAllowlisted{sc.ip}
+	case err == nil:
+		err = verifyIdentity(sc.identity, res, sc.roots)
+		if err == nil && sc.identity == "" {
+			// pinned judges may be requested by other names
+			err = verifyTLS(res, sc.roots)
+		}
+		if err == nil {
+			err = sc.alpn.verify(observed(ctx), res)
+		}
+		if err == nil {
+			err = validate(res, body)
+		}
+	}
+	record(res, body, err)
+	if !shadowed(ctx) {
+		sc.metrics.request(sc.page, time.Since(start), err)
+	}
+	if isRateLimited(res, err) {
+		observed(ctx).count(checkCounters{rateLimited: 1})
+	}
+	if isCaptcha(err) {
+		observed(ctx).count(checkCounters{captchas: 1})
+	}
+	return body, err
+}
+
+func isRateLimited(res *http.Response, err error) bool {
+	if res != nil && res.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return isCaptcha(err)
+}
+
+func isCaptcha(err error) bool {
+	return errors.Is(err, errCloudFlare) || errors.Is(err, errGoogleRatelimit)
+}
+
+func (sc *simple) request(ctx context.Context, proxy pmux.Proxy, method, page string) (*http.Response, string, error) {
+	res, body, generation, err := sc.roundTrip(ctx, proxy, method, page)
+	if err == nil && sc.session.expired(res) {
+		// once per check, so that broken logins don't loop
+		sc.session.invalidate(generation)
+		observed(ctx).count(checkCounters{retries: 1})
+		res, body, _, err = sc.roundTrip(ctx, proxy, method, page)
+	}
+	return res, body, err
+}
+
+func (sc *simple) roundTrip(ctx context.Context, proxy pmux.Proxy, method, page string) (*http.Response, string, int, error) {
+	err := spend(ctx)
 	if err != nil {
-		return 0, err
+		return nil, "", 0, err
+	}
+	req, err := http.NewRequestWithContext(proxy.InContext(ctx), method, page, nil)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	req.Header.Set("User-Agent", randomAgent(req.Context()))
+	// login is direct, so the context is without proxy
+	generation, err := sc.session.attach(ctx, req)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	observed(ctx).count(checkCounters{attempts: 1})
+	res, err := reusedClient(ctx, sc.client, req.URL.Host).Do(req)
+	if err != nil {
+		return nil, "", 0, err
 	}
 	defer res.Body.Close()
+	if !shadowed(ctx) {
+		sc.pacer.observe(res.Header)
+	}
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return 0, err
+		return nil, "", 0, err
 	}
-	stringBody := string(body)
-	err = sc.validate(stringBody)
-	if isTimeout(err) {
-		return 0, err
+	return res, string(body), generation, nil
+}
+
+// validateHead confirms the proxy and status cheaply, before the body of
+// the judge is downloaded
+func (sc *simple) validateHead(res *http.Response, _ string) error {
+	switch res.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		// judge doesn't support HEAD, so fall through to GET
+		return nil
 	}
-	if err != nil {
-		return 0, err
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("head: status %d", res.StatusCode)
 	}
-	return time.Now().Sub(start), nil // TODO: speed is always the same?...
+	return nil
 }
 
-func (sc *simple) validate(body string) error {
+func (sc *simple) validate(ctx context.Context, contentType, body string) error {
 	// Maximum number of open connections reached
 	// Too Many Requests
 	if strings.Contains(body, "client does not have permission to get URL") {
@@ -209,23 +939,43 @@ func (sc *simple) validate(body string) error {
 	if strings.Contains(body, "Cloudflare") {
 		return errCloudFlare
 	}
+	err := checkContentType(sc.contentType, contentType)
+	if err != nil {
+		return err
+	}
 	if strings.Contains(body, sc.ip) {
 		return ErrNotAnonymous
 	}
 	if sc.valid == "" && !ipRegex.MatchString(body) {
-		return fmt.Errorf("not ip: %s", truncatedBody(body))
+		return fmt.Errorf("not ip: %s", truncatedResponse(ctx, contentType, body))
 	}
 	if !strings.Contains(body, sc.valid) {
-		return fmt.Errorf("no %s found: %s", sc.valid, truncatedBody(body))
+		return fmt.Errorf("no %s found: %s", sc.valid, truncatedResponse(ctx, contentType, body))
+	}
+	// only judges with valid markers report more than a bare IP
+	if sc.valid != "" && sc.policy != nil && sc.policy.Grade(sc.ip, reportedHeaders(body)) == Transparent {
+		return transparentByPolicy{}
 	}
 	return nil
 }
 
 var sanitize = bluemonday.StrictPolicy()
 
-func truncatedBody(body string) string {
-	body = sanitize.Sanitize(body)
-	body = app.Shrink(body)
+func truncatedBody(ctx context.Context, body string) string {
+	return truncatedResponse(ctx, "", body)
+}
+
+// truncatedResponse pretty-prints JSON instead of sanitizing it as HTML,
+// which strips braces and quotes from it, unless preserve_json is off
+func truncatedResponse(ctx context.Context, contentType, body string) string {
+	if !configured(ctx).sanitizeJSON && isJSON(contentType, body) {
+		var buf bytes.Buffer
+		json.Indent(&buf, []byte(strings.TrimSpace(body)), "", "  ")
+		body = buf.String()
+	} else {
+		body = sanitize.Sanitize(body)
+		body = app.Shrink(body)
+	}
 	cutoff := 512
 	if len(body) > cutoff {
 		return body[:cutoff] + fmt.Sprintf(" (%db more)", len(body)-cutoff)
@@ -233,15 +983,34 @@ func truncatedBody(body string) string {
 	return body
 }
 
-func thisIP() (string, error) {
-	r, err := http.Get("https://ifconfig.me/ip")
-	if err != nil {
-		return "", err
+func isJSON(contentType, body string) bool {
+	trimmed := strings.TrimSpace(body)
+	if !json.Valid([]byte(trimmed)) {
+		return false
+	}
+	if strings.Contains(contentType, "json") {
+		return true
+	}
+	return strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")
+}
+
+// thisIPJudge reports nothing else, than the IP
+var thisIPJudge = "https://ifconfig.me/ip"
+
+// thisIP is looked up on every Configure, as it may change over time, but
+// the previous one is kept, when the network is temporarily unavailable
+func (cc *configurableChecker) thisIP(cfg *checkerConfig) (string, error) {
+	if cc.ip != "" {
+		return cc.ip, nil
+	}
+	ip, err := lookupIP(withConfig(context.Background(), cfg), cfg.direct, thisIPJudge, cfg.directRoots)
+	prev := cc.current().ip
+	if err != nil && prev != "" {
+		log := app.Log.From(context.Background())
+		log.Warn().Err(err).Msg("cannot get this IP, keeping the previous one")
+		return prev, nil
 	}
-	defer r.Body.Close()
-	s := bufio.NewScanner(r.Body)
-	s.Scan()
-	return s.Text(), nil
+	return ip, err
 }
 
 type temporary string
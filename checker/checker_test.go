@@ -7,10 +7,12 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/ipinfo"
 	"github.com/nfx/slrp/pmux"
 	"github.com/stretchr/testify/assert"
 )
@@ -19,7 +21,7 @@ func TestFailure(t *testing.T) {
 	defaultClient = &staticResponseClient{
 		err: fmt.Errorf("fails"),
 	}
-	c := NewChecker()
+	c := NewChecker(ipinfo.NoopIpInfo{})
 
 	ctx := context.Background()
 	_, err := c.Check(ctx, pmux.HttpProxy("127.0.0.1:1"))
@@ -29,6 +31,7 @@ func TestFailure(t *testing.T) {
 func TestConfigurableChecker(t *testing.T) {
 	client := http.DefaultClient
 	c := configurableChecker{
+		ip:     "255.0.0.1",
 		client: client,
 		strategies: map[string]Checker{
 			"simple": &simple{}, // just for tests
@@ -36,8 +39,33 @@ func TestConfigurableChecker(t *testing.T) {
 	}
 	err := c.Configure(app.Config{})
 	assert.NoError(t, err)
-	assert.Equal(t, "simple", c.strategy)
-	assert.Equal(t, time.Second*5, client.Timeout)
+	assert.Equal(t, "simple", c.current().strategy)
+	assert.Equal(t, time.Second*5, c.current().client.(*http.Client).Timeout)
+	assert.Equal(t, time.Duration(0), client.Timeout, "original client is kept intact")
+}
+
+// use makes the checker run with cfg, as if it was configured
+func (cc *configurableChecker) use(cfg checkerConfig) *configurableChecker {
+	if cfg.ip == "" {
+		cfg.ip = cc.ip
+	}
+	if cfg.client == nil {
+		cfg.client = cc.client
+	}
+	if cfg.direct == nil {
+		cfg.direct = cfg.client
+	}
+	if cfg.strategies == nil {
+		cfg.strategies = cc.strategies
+	}
+	if cfg.strategy == "" {
+		cfg.strategy = "simple"
+	}
+	if cfg.scorePolicy == (scoringPolicy{}) {
+		cfg.scorePolicy = defaultScoringPolicy
+	}
+	cc.config.Store(&cfg)
+	return cc
 }
 
 type staticResponseClient struct {
@@ -85,44 +113,71 @@ func TestTwoPassCheck(t *testing.T) {
 		},
 	} {
 		t.Run(fmt.Sprint(i), func(t *testing.T) {
-			tp := twoPass{
-				first: federated{
-					&simple{
-						ip:    "XYZ",
-						valid: "..",
-						client: staticResponseClient{
-							Response: http.Response{
-								Body:       body(tt.firstBody),
-								StatusCode: 200,
+			for _, concurrent := range []bool{false, true} {
+				tp := twoPass{
+					first: federated{judges: []*simple{
+						{
+							ip:    "XYZ",
+							valid: "..",
+							client: staticResponseClient{
+								Response: http.Response{
+									Body:       body(tt.firstBody),
+									StatusCode: 200,
+								},
+								err: tt.firstErr,
 							},
-							err: tt.firstErr,
 						},
-					},
-				},
-				second: federated{
-					&simple{
-						ip:    "XYZ",
-						valid: "..",
-						client: staticResponseClient{
-							Response: http.Response{
-								Body:       body(tt.secondBody),
-								StatusCode: 200,
+					}},
+					second: federated{judges: []*simple{
+						{
+							ip:    "XYZ",
+							valid: "..",
+							client: staticResponseClient{
+								Response: http.Response{
+									Body:       body(tt.secondBody),
+									StatusCode: 200,
+								},
+								err: tt.secondErr,
 							},
-							err: tt.secondErr,
 						},
-					},
-				},
-			}
-			_, err := tp.Check(context.Background(), pmux.HttpProxy("127.0.0.1:23"))
-			if tt.expectErr != "" {
-				assert.EqualError(t, err, tt.expectErr)
-			} else {
-				assert.NoError(t, err)
+					}},
+					concurrent: concurrent,
+				}
+				_, err := tp.Check(context.Background(), pmux.HttpProxy("127.0.0.1:23"))
+				if tt.expectErr != "" {
+					assert.EqualError(t, err, tt.expectErr)
+				} else {
+					assert.NoError(t, err)
+				}
 			}
 		})
 	}
 }
 
+func TestConcurrentPassesCancelSecond(t *testing.T) {
+	cancelled := make(chan struct{})
+	tp := twoPass{
+		first: federated{judges: []*simple{{
+			client: staticResponseClient{err: fmt.Errorf("dead")},
+		}}},
+		second: federated{judges: []*simple{{
+			client: clientFunc(func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done()
+				close(cancelled)
+				return nil, req.Context().Err()
+			}),
+		}}},
+		concurrent: true,
+	}
+	_, err := tp.Check(context.Background(), pmux.HttpProxy("127.0.0.1:23"))
+	assert.EqualError(t, err, "first: dead")
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("second pass is not cancelled")
+	}
+}
+
 type failingReader string
 
 func (f failingReader) Read(p []byte) (n int, err error) {
@@ -215,3 +270,213 @@ func TestSimpleCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestFederatedSelection(t *testing.T) {
+	f := federated{judges: []*simple{
+		{page: "a"}, {page: "b"}, {page: "c"},
+	}}
+
+	fixed := f.selectBy(fixedOrderSelection)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "a", fixed.pick().page)
+	}
+
+	rr := f.selectBy(roundRobinSelection)
+	var seen []string
+	for i := 0; i < 4; i++ {
+		seen = append(seen, rr.pick().page)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a"}, seen)
+
+	_, err := parseSelection("sometimes")
+	assert.EqualError(t, err, "invalid selection: sometimes")
+}
+
+func TestConfigureSelection(t *testing.T) {
+	c := configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple":  federated{judges: []*simple{{page: "a"}}},
+			"twopass": twoPass{},
+		},
+	}
+	err := c.Configure(app.Config{
+		"selection": "fixed-order",
+	})
+	assert.NoError(t, err)
+	strategies := c.current().strategies
+	assert.Equal(t, fixedOrderSelection, strategies["simple"].(federated).selection)
+	assert.Equal(t, fixedOrderSelection, strategies["twopass"].(twoPass).second.selection)
+}
+
+func TestTwoPassRotatingExit(t *testing.T) {
+	pass := func(b, valid string) federated {
+		return federated{judges: []*simple{{
+			ip:    "255.0.0.1",
+			valid: valid,
+			client: clientFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: body(b)}, nil
+			}),
+		}}}
+	}
+	for i, tt := range []struct {
+		second    string
+		stable    bool
+		rotating  bool
+		expectErr string
+	}{
+		{
+			second: `{"ip": "1.2.3.4", "user_agent": "x"}`,
+		},
+		{
+			second:   `{"ip": "5.6.7.8", "user_agent": "x"}`,
+			rotating: true,
+		},
+		{
+			second:    `{"ip": "5.6.7.8", "user_agent": "x"}`,
+			stable:    true,
+			rotating:  true,
+			expectErr: "exit IP differs across passes",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			tp := twoPass{
+				first:             pass("1.2.3.4", ""),
+				second:            pass(tt.second, "user_agent"),
+				requireStableExit: tt.stable,
+			}
+			ctx, o := observe(context.Background())
+			_, err := tp.Check(ctx, pmux.HttpProxy("127.0.0.1:23"))
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.rotating, o.isRotating())
+		})
+	}
+}
+
+func TestTruncatedResponse(t *testing.T) {
+	for i, tt := range []struct {
+		contentType, body, expect string
+	}{
+		{"", "<b>blocked</b>", "blocked"},
+		{"", `{"ip":"1.2.3.4"}`, "{\n  \"ip\": \"1.2.3.4\"\n}"},
+		{"", ` [1, 2] `, "[\n  1,\n  2\n]"},
+		{"application/json", `"quoted"`, `"quoted"`},
+		{"application/json", `{"broken`, `{ broken`},
+		{"text/plain", `"quoted"`, `quoted`},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			assert.Equal(t, tt.expect, truncatedResponse(context.Background(), tt.contentType, tt.body))
+		})
+	}
+	ctx := withConfig(context.Background(), &checkerConfig{sanitizeJSON: true})
+	assert.Equal(t, "{ ip: ip }", truncatedBody(ctx, `{"ip":"1.2.3.4"}`))
+}
+
+func TestReconfigureUnderLoad(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	judge := func() federated {
+		return federated{judges: []*simple{{
+			ip:     "255.0.0.1",
+			page:   "http://judge.local/ip",
+			client: client,
+		}}, next: new(uint32)}
+	}
+	cc := &configurableChecker{
+		ip:     "255.0.0.1",
+		client: client,
+		strategies: map[string]Checker{
+			"simple":  judge(),
+			"twopass": twoPass{first: judge(), second: judge()},
+		},
+		readiness: &readiness{},
+		scoring:   newScoring(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				r := cc.Result(context.Background(), proxy)
+				assert.True(t, r.Ok(), r.Failure)
+			}
+		}()
+	}
+	strategies := []string{"simple", "twopass"}
+	selections := []string{"random", "round-robin", "fixed-order"}
+	for i := 0; i < 50; i++ {
+		err := cc.Configure(app.Config{
+			"strategy":       strategies[i%len(strategies)],
+			"selection":      selections[i%len(selections)],
+			"timeout":        fmt.Sprintf("%ds", i%3+1),
+			"min_judges":     fmt.Sprint(i),
+			"flap_penalty":   fmt.Sprint(i),
+			"user_agents":    "a\nb",
+			"preserve_json":  fmt.Sprint(i%2 == 0),
+			"judge_interval": "0s",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, i, cc.Readiness().Required)
+	}
+	cancel()
+	wg.Wait()
+	assert.Equal(t, "twopass", cc.current().strategy)
+}
+
+func TestHeadFirst(t *testing.T) {
+	for i, tt := range []struct {
+		headStatus int
+		methods    []string
+		expectErr  string
+	}{
+		{200, []string{"HEAD", "GET"}, ""},
+		{405, []string{"HEAD", "GET"}, ""},
+		{501, []string{"HEAD", "GET"}, ""},
+		{403, []string{"HEAD"}, "head: status 403"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var methods []string
+			sc := &simple{
+				ip:        "255.0.0.1",
+				page:      "http://judge.local/ip",
+				headFirst: true,
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					methods = append(methods, req.Method)
+					if req.Method == "HEAD" {
+						return &http.Response{StatusCode: tt.headStatus, Body: body("")}, nil
+					}
+					return &http.Response{StatusCode: 200, Body: body("1.2.3.4")}, nil
+				}),
+			}
+			_, err := sc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.methods, methods)
+		})
+	}
+}
+
+func TestConfigureHeadFirst(t *testing.T) {
+	c := configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": federated{judges: []*simple{{page: "a"}}},
+		},
+	}
+	err := c.Configure(app.Config{
+		"head_first": "true",
+	})
+	assert.NoError(t, err)
+	assert.True(t, c.current().strategies["simple"].(federated).judges[0].headFirst)
+	assert.False(t, c.strategies["simple"].(federated).judges[0].headFirst, "base is intact")
+}
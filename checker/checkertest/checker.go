@@ -0,0 +1,112 @@
+// Package checkertest provides synthetic checkers, so that the scheduler and
+// the pool could be load-tested with controlled timing and without network.
+package checkertest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+var (
+	ErrFailed    = errors.New("synthetic failure")
+	ErrTemporary = temporary("synthetic temporary failure")
+)
+
+type temporary string
+
+func (t temporary) Error() string {
+	return string(t)
+}
+
+// Temporary gets the proxy re-checked later by the probe
+func (t temporary) Temporary() bool {
+	return true
+}
+
+// Latency is the distribution of synthetic check durations
+type Latency func(r *rand.Rand) time.Duration
+
+func Fixed(d time.Duration) Latency {
+	return func(*rand.Rand) time.Duration {
+		return d
+	}
+}
+
+func Uniform(min, max time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(r.Int63n(int64(max-min)))
+	}
+}
+
+// Normal never returns negative durations
+func Normal(mean, stddev time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		d := mean + time.Duration(r.NormFloat64()*float64(stddev))
+		if d < 0 {
+			return 0
+		}
+		return d
+	}
+}
+
+// Checker waits for the sampled latency and fails at configured rates
+type Checker struct {
+	Latency Latency
+	// FailureRate is the share of checks failing with ErrFailed
+	FailureRate float64
+	// TemporaryRate is the share of checks failing with ErrTemporary
+	TemporaryRate float64
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// NewChecker returns the checker, that is reproducible for the same seed
+func NewChecker(latency Latency, seed int64) *Checker {
+	return &Checker{
+		Latency: latency,
+		random:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (c *Checker) sample() (time.Duration, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.random == nil {
+		c.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	var latency time.Duration
+	if c.Latency != nil {
+		latency = c.Latency(c.random)
+	}
+	return latency, c.random.Float64()
+}
+
+func (c *Checker) Check(ctx context.Context, _ pmux.Proxy) (time.Duration, error) {
+	latency, outcome := c.sample()
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	switch {
+	case outcome < c.FailureRate:
+		return 0, ErrFailed
+	case outcome < c.FailureRate+c.TemporaryRate:
+		return 0, ErrTemporary
+	default:
+		return latency, nil
+	}
+}
@@ -0,0 +1,63 @@
+package checkertest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatency(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i, tt := range []struct {
+		latency  Latency
+		min, max time.Duration
+	}{
+		{Fixed(time.Second), time.Second, time.Second},
+		{Uniform(time.Second, 2*time.Second), time.Second, 2 * time.Second},
+		{Uniform(time.Second, time.Second), time.Second, time.Second},
+		{Normal(10*time.Millisecond, time.Second), 0, time.Hour},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			for j := 0; j < 1000; j++ {
+				d := tt.latency(r)
+				assert.GreaterOrEqual(t, d, tt.min)
+				assert.LessOrEqual(t, d, tt.max)
+			}
+		})
+	}
+}
+
+func TestChecker(t *testing.T) {
+	c := NewChecker(nil, 1)
+	c.FailureRate = 0.2
+	c.TemporaryRate = 0.1
+	outcomes := map[error]int{}
+	for i := 0; i < 10000; i++ {
+		_, err := c.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+		outcomes[err]++
+	}
+	assert.InDelta(t, 7000, outcomes[nil], 300)
+	assert.InDelta(t, 2000, outcomes[ErrFailed], 300)
+	assert.InDelta(t, 1000, outcomes[ErrTemporary], 300)
+	assert.True(t, ErrTemporary.Temporary())
+}
+
+func TestCheckerLatency(t *testing.T) {
+	c := NewChecker(Fixed(20*time.Millisecond), 1)
+	start := time.Now()
+	speed, err := c.Check(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 20*time.Millisecond, speed)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	c.Latency = Fixed(time.Minute)
+	_, err = c.Check(ctx, 0)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -0,0 +1,101 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type connectionsKey struct{}
+
+// connections are shared by requests of a single check, that go through
+// the base client, for strategies reusing connections, e.g. for throughput.
+// Checks never share them, as the pool of tunnels isn't keyed by proxy.
+// Isolated judge hosts get connections of their own, as plain HTTP requests
+// through the same proxy share them otherwise.
+type connections struct {
+	sync.Mutex
+	base      httpClient
+	original  *http.Client
+	transport *http.Transport
+	isolate   bool
+	// clients are by judge host, or by empty one, unless isolated
+	clients map[string]*http.Client
+}
+
+// parseReuse parses comma-separated strategies, that reuse connections
+// within a check, where all the others get fresh connection per request
+func parseReuse(raw string, strategies map[string]Checker) (map[string]bool, error) {
+	out := map[string]bool{}
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		_, ok := strategies[name]
+		if !ok {
+			return nil, fmt.Errorf("reuse_connections: invalid strategy: %s", name)
+		}
+		out[name] = true
+	}
+	return out, nil
+}
+
+// reuseConnections prepares transports with keep-alives for the check and
+// returns the function to close idle connections, once it's done
+func reuseConnections(ctx context.Context, base httpClient, isolate bool) (context.Context, func()) {
+	original, ok := base.(*http.Client)
+	if !ok {
+		return ctx, func() {}
+	}
+	transport, ok := original.Transport.(*http.Transport)
+	if !ok {
+		return ctx, func() {}
+	}
+	c := &connections{
+		base:      base,
+		original:  original,
+		transport: transport,
+		isolate:   isolate,
+		clients:   map[string]*http.Client{},
+	}
+	return context.WithValue(ctx, connectionsKey{}, c), c.close
+}
+
+func (c *connections) clientFor(host string) *http.Client {
+	if !c.isolate {
+		host = ""
+	}
+	c.Lock()
+	defer c.Unlock()
+	client, ok := c.clients[host]
+	if ok {
+		return client
+	}
+	transport := c.transport.Clone()
+	transport.DisableKeepAlives = false
+	clone := *c.original
+	clone.Transport = transport
+	c.clients[host] = &clone
+	return &clone
+}
+
+func (c *connections) close() {
+	c.Lock()
+	defer c.Unlock()
+	for _, client := range c.clients {
+		client.CloseIdleConnections()
+	}
+}
+
+// reusedClient returns the client of the check for the judge host, if the
+// judge uses the base client
+func reusedClient(ctx context.Context, client httpClient, host string) httpClient {
+	c, _ := ctx.Value(connectionsKey{}).(*connections)
+	if c == nil || c.base != client {
+		return client
+	}
+	return c.clientFor(host)
+}
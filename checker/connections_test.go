@@ -0,0 +1,123 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReuse(t *testing.T) {
+	strategies := map[string]Checker{"simple": nil, "twopass": nil}
+	reuse, err := parseReuse(" twopass,", strategies)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"twopass": true}, reuse)
+	_, err = parseReuse("nope", strategies)
+	assert.EqualError(t, err, "reuse_connections: invalid strategy: nope")
+}
+
+func TestReuseConnectionsPerStrategy(t *testing.T) {
+	for i, tt := range []struct {
+		reuse       map[string]bool
+		connections int32
+	}{
+		{nil, 4},
+		{map[string]bool{"simple": true}, 2},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var connections int32
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.Write([]byte("1.2.3.4"))
+			}))
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&connections, 1)
+				}
+			}
+			srv.Start()
+			defer srv.Close()
+			client := &http.Client{
+				Transport: pmux.ContextualHttpTransport(),
+				Timeout:   5 * time.Second,
+			}
+			cc := &configurableChecker{
+				client: client,
+				strategies: map[string]Checker{
+					"simple": &simple{
+						ip:        "5.6.7.8",
+						page:      "http://judge.local/ip",
+						client:    client,
+						headFirst: true,
+					},
+				},
+			}
+			cc.use(checkerConfig{reuse: tt.reuse})
+			proxy := pmux.HttpProxy(srv.Listener.Addr().String())
+			for j := 0; j < 2; j++ {
+				_, err := cc.Check(context.Background(), proxy)
+				assert.NoError(t, err)
+			}
+			// checks never share connections
+			assert.Equal(t, tt.connections, atomic.LoadInt32(&connections))
+		})
+	}
+}
+
+func TestIsolateJudgeHosts(t *testing.T) {
+	for i, tt := range []struct {
+		isolate     bool
+		connections int32
+	}{
+		{false, 1},
+		{true, 2},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var connections int32
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.Write([]byte("1.2.3.4"))
+			}))
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&connections, 1)
+				}
+			}
+			srv.Start()
+			defer srv.Close()
+			client := &http.Client{
+				Transport: pmux.ContextualHttpTransport(),
+				Timeout:   5 * time.Second,
+			}
+			judge := func(page string) federated {
+				return federated{judges: []*simple{{
+					ip:     "5.6.7.8",
+					page:   page,
+					client: client,
+				}}}
+			}
+			cc := &configurableChecker{
+				client: client,
+				strategies: map[string]Checker{
+					"twopass": twoPass{
+						first:  judge("http://a.judge.local/ip"),
+						second: judge("http://b.judge.local/ip"),
+					},
+				},
+			}
+			cc.use(checkerConfig{
+				strategy:     "twopass",
+				reuse:        map[string]bool{"twopass": true},
+				isolateHosts: tt.isolate,
+			})
+			_, err := cc.Check(context.Background(), pmux.HttpProxy(srv.Listener.Addr().String()))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.connections, atomic.LoadInt32(&connections))
+		})
+	}
+}
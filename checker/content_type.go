@@ -0,0 +1,63 @@
+package checker
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+var errUnexpectedContentType = fmt.Errorf("unexpected content type")
+
+// unexpectedContentType usually means block or captive portal page, that
+// happens to contain IP-like substrings, instead of the judge response
+type unexpectedContentType struct {
+	expected string
+	actual   string
+}
+
+func (e unexpectedContentType) Error() string {
+	return fmt.Sprintf("%s: %s, expected %s", errUnexpectedContentType, e.actual, e.expected)
+}
+
+func (e unexpectedContentType) Is(target error) bool {
+	return target == errUnexpectedContentType
+}
+
+// parseContentTypes parses comma-separated pairs of judge page and
+// its expected media type, e.g. "https://ifconfig.me/ip text/plain"
+func parseContentTypes(raw string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, v := range strings.Split(raw, ",") {
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid judge content type: %s", strings.TrimSpace(v))
+		}
+		mediaType, _, err := mime.ParseMediaType(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid judge content type: %s: %w", fields[0], err)
+		}
+		out[fields[0]] = mediaType
+	}
+	return out, nil
+}
+
+// checkContentType compares media types, ignoring parameters like charset
+func checkContentType(expected, contentType string) error {
+	if expected == "" {
+		return nil
+	}
+	actual, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		actual = strings.TrimSpace(contentType)
+	}
+	if actual == expected {
+		return nil
+	}
+	if actual == "" {
+		actual = "none"
+	}
+	return unexpectedContentType{expected, actual}
+}
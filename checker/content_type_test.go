@@ -0,0 +1,85 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJudgeContentType(t *testing.T) {
+	for i, tt := range []struct {
+		expected    string
+		contentType string
+		body        string
+		expectErr   string
+	}{
+		{
+			body: "1.2.3.4",
+		},
+		{
+			expected:    "text/plain",
+			contentType: "text/plain; charset=utf-8",
+			body:        "1.2.3.4",
+		},
+		{
+			expected:    "text/plain",
+			contentType: "text/html",
+			body:        "<p>Please log in</p>\n1.2.3.4\n",
+			expectErr:   "unexpected content type: text/html, expected text/plain",
+		},
+		{
+			expected:  "text/plain",
+			body:      "1.2.3.4",
+			expectErr: "unexpected content type: none, expected text/plain",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			sc := &simple{
+				ip:          "255.0.0.1",
+				contentType: tt.expected,
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						Header:     http.Header{"Content-Type": {tt.contentType}},
+						Body:       body(tt.body),
+					}, nil
+				}),
+			}
+			_, err := sc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			if tt.expectErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.expectErr)
+			assert.True(t, errors.Is(err, errUnexpectedContentType))
+		})
+	}
+}
+
+func TestConfigureJudgeContentTypes(t *testing.T) {
+	cc := configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": federated{judges: []*simple{{page: "a"}, {page: "b"}}},
+		},
+	}
+	err := cc.Configure(app.Config{
+		"judge_content_types": "a text/plain, b Application/JSON;charset=utf-8",
+	})
+	assert.NoError(t, err)
+	judges := cc.current().strategies["simple"].(federated).judges
+	assert.Equal(t, "text/plain", judges[0].contentType)
+	assert.Equal(t, "application/json", judges[1].contentType)
+
+	err = cc.Configure(app.Config{
+		"judge_content_types": "a",
+	})
+	assert.EqualError(t, err, "invalid judge content type: a")
+}
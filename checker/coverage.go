@@ -0,0 +1,127 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// parseJudgeCapabilities parses comma- or space-separated capability names
+func parseJudgeCapabilities(raw string) (out []judgeCapability, err error) {
+	seen := map[judgeCapability]bool{}
+	for _, name := range strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		c, ok := judgeCapabilityNames[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid judge capability: %s", name)
+		}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// parseCoverageJudges parses comma-separated custom judges, each followed
+// by its capabilities, e.g. "https://judge.example.com/tls ip tls"
+func parseCoverageJudges(raw string) (out []judgeEntry, err error) {
+	for _, v := range strings.Split(raw, ",") {
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid coverage judge: %s", strings.TrimSpace(v))
+		}
+		capabilities, err := parseJudgeCapabilities(strings.Join(fields[1:], ","))
+		if err != nil {
+			return nil, fmt.Errorf("coverage judge %s: %w", fields[0], err)
+		}
+		entry := judgeEntry{page: fields[0]}
+		for _, c := range capabilities {
+			entry.capabilities |= c
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// coveredBy is the required capability along with judges reporting it
+type coveredBy struct {
+	capability judgeCapability
+	judges     federated
+}
+
+// coverage passes the proxy only when judges of every required capability
+// have passed it, so that the proxy isn't certified as anonymous, when just
+// IP-only judges were reachable and headers were never actually seen
+type coverage []coveredBy
+
+// configureCoverage composes judges for coverage_capabilities from the
+// registry and coverage_judges
+func configureCoverage(conf app.Config, client httpClient, ip string) (coverage, error) {
+	required, err := parseJudgeCapabilities(conf.StrOr("coverage_capabilities", "ip,headers"))
+	if err != nil {
+		return nil, err
+	}
+	custom, err := parseCoverageJudges(conf.StrOr("coverage_judges", ""))
+	if err != nil {
+		return nil, err
+	}
+	entries := append(custom, registry...)
+	var all judgeCapability
+	for _, c := range required {
+		all |= c
+	}
+	var out coverage
+	for _, c := range required {
+		// distinct judges cover each capability where possible, so that
+		// cheaper IP-only judges aren't substituted by the heavier ones
+		judges := entriesThat(entries, c, all&^c)
+		if len(judges) == 0 {
+			judges = entriesThat(entries, c, 0)
+		}
+		if len(judges) == 0 {
+			return nil, fmt.Errorf("coverage: no judges report %s", c)
+		}
+		out = append(out, coveredBy{
+			capability: c,
+			judges:     newFederated(judges, client, ip),
+		})
+	}
+	return out, nil
+}
+
+func (c coverage) withSelection(s selection) Checker {
+	out := make(coverage, len(c))
+	for i, v := range c {
+		out[i] = coveredBy{v.capability, v.judges.selectBy(s)}
+	}
+	return out
+}
+
+// Check returns the slowest latency across capabilities and fails on the
+// first one, that was not covered
+func (c coverage) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+	var slowest time.Duration
+	for _, v := range c {
+		t, err := v.judges.Check(ctx, proxy)
+		if isTimeout(err) {
+			return t, err
+		}
+		if err != nil {
+			return t, fmt.Errorf("%s: %w", v.capability, err)
+		}
+		if t > slowest {
+			slowest = t
+		}
+	}
+	return slowest, nil
+}
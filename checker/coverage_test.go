@@ -0,0 +1,100 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureCoverage(t *testing.T) {
+	for i, tt := range []struct {
+		conf      app.Config
+		expect    []string
+		expectErr string
+	}{
+		{conf: app.Config{}, expect: []string{"ip", "headers"}},
+		{conf: app.Config{"coverage_capabilities": "headers headers"}, expect: []string{"headers"}},
+		{conf: app.Config{"coverage_capabilities": "ip,bogus"},
+			expectErr: "invalid judge capability: bogus"},
+		{conf: app.Config{"coverage_capabilities": "ip,headers,tls"},
+			expectErr: "coverage: no judges report tls"},
+		{conf: app.Config{"coverage_judges": "https://judge/tls"},
+			expectErr: "invalid coverage judge: https://judge/tls"},
+		{conf: app.Config{"coverage_judges": "https://judge/tls ip sni"},
+			expectErr: "coverage judge https://judge/tls: invalid judge capability: sni"},
+		{conf: app.Config{
+			"coverage_capabilities": "ip,headers,tls",
+			"coverage_judges":       "https://judge/tls headers tls",
+		}, expect: []string{"ip", "headers", "tls"}},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			c, err := configureCoverage(tt.conf, nil, "")
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			var names []string
+			for _, v := range c {
+				names = append(names, v.capability.String())
+				assert.NotEmpty(t, v.judges.judges)
+			}
+			assert.Equal(t, tt.expect, names)
+		})
+	}
+}
+
+func TestCoverageUsesDistinctJudges(t *testing.T) {
+	c, err := configureCoverage(app.Config{}, nil, "")
+	assert.NoError(t, err)
+	for _, s := range c[0].judges.judges {
+		assert.NotContains(t, s.page, "/all")
+	}
+	for _, s := range c[1].judges.judges {
+		assert.Contains(t, s.page, "/all")
+	}
+}
+
+func TestCoverageCheck(t *testing.T) {
+	for i, tt := range []struct {
+		headers   bool
+		expectErr string
+	}{
+		{headers: true},
+		{expectErr: "headers: no ifconfig_hostname found: ip"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var pages []string
+			client := clientFunc(func(req *http.Request) (*http.Response, error) {
+				pages = append(pages, req.URL.Host+req.URL.Path)
+				reply := "1.2.3.4"
+				if strings.Contains(req.URL.Path, "/all") && tt.headers {
+					reply = "ip_addr: 1.2.3.4\nuser_agent: test\nifconfig_hostname: x"
+				}
+				return &http.Response{
+					StatusCode: 200,
+					Body:       body(reply),
+				}, nil
+			})
+			c, err := configureCoverage(app.Config{}, client, "5.6.7.8")
+			assert.NoError(t, err)
+			checker := c.withSelection(fixedOrderSelection)
+			_, err = checker.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			assert.Equal(t, []string{
+				"api.ipify.org/",
+				"ifconfig.io/all.json",
+			}, pages)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
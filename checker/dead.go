@@ -0,0 +1,77 @@
+package checker
+
+import (
+	"sort"
+	"sync"
+)
+
+// deadJudges are built-in judges, that have failed dead_judge_failures
+// direct probes in a row. Selection skips them until they pass a probe
+// again, so that a long-gone public judge doesn't fail every other check.
+type deadJudges struct {
+	sync.RWMutex
+	failures map[string]int
+	dead     map[string]bool
+}
+
+func newDeadJudges() *deadJudges {
+	return &deadJudges{
+		failures: map[string]int{},
+		dead:     map[string]bool{},
+	}
+}
+
+// probed records the direct probe and tells if the judge has died or
+// recovered because of it
+func (d *deadJudges) probed(page string, err error, threshold int) (changed bool) {
+	d.Lock()
+	defer d.Unlock()
+	if err == nil {
+		delete(d.failures, page)
+		changed = d.dead[page]
+		delete(d.dead, page)
+		return changed
+	}
+	d.failures[page]++
+	if d.failures[page] < threshold || d.dead[page] {
+		return false
+	}
+	d.dead[page] = true
+	return true
+}
+
+func (d *deadJudges) isDead(page string) bool {
+	if d == nil {
+		return false
+	}
+	d.RLock()
+	defer d.RUnlock()
+	return d.dead[page]
+}
+
+func (d *deadJudges) pages() (out []string) {
+	d.RLock()
+	defer d.RUnlock()
+	for page := range d.dead {
+		out = append(out, page)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// alive excludes dead judges, unless all of them are dead, as then it's
+// rather the network of this host, than the judges
+func (f federated) alive() federated {
+	var judges []*simple
+	for _, j := range f.judges {
+		if j.dead.isDead(j.page) {
+			continue
+		}
+		judges = append(judges, j)
+	}
+	if len(judges) == 0 {
+		return f
+	}
+	f.judges = judges
+	return f
+}
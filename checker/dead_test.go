@@ -0,0 +1,61 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadJudges(t *testing.T) {
+	up := false
+	dead := newDeadJudges()
+	cc := &configurableChecker{
+		ip: "255.0.0.1",
+		client: clientFunc(func(req *http.Request) (*http.Response, error) {
+			b := "255.0.0.1"
+			if req.URL.String() == "https://api.ipify.org/" && !up {
+				b = "gone"
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       body(b),
+			}, nil
+		}),
+		readiness: &readiness{},
+		dead:      dead,
+	}
+	cc.use(checkerConfig{deadFailures: 2})
+	f := federated{
+		judges: []*simple{
+			{page: "https://api.ipify.org/", dead: dead},
+			{page: "https://ifconfig.me/ip", dead: dead},
+		},
+		selection: fixedOrderSelection,
+	}
+
+	cc.ProbeJudges(context.Background())
+	assert.Empty(t, cc.Readiness().Dead, "one failure is not enough")
+	assert.Equal(t, "https://api.ipify.org/", f.pick().page)
+
+	cc.ProbeJudges(context.Background())
+	assert.Equal(t, []string{"https://api.ipify.org/"}, cc.Readiness().Dead)
+	assert.Equal(t, "https://ifconfig.me/ip", f.pick().page)
+
+	up = true
+	cc.ProbeJudges(context.Background())
+	assert.Empty(t, cc.Readiness().Dead)
+	assert.Equal(t, "https://api.ipify.org/", f.pick().page)
+}
+
+func TestAllJudgesDead(t *testing.T) {
+	dead := newDeadJudges()
+	assert.True(t, dead.probed("https://a/", assert.AnError, 1))
+	assert.False(t, dead.probed("https://a/", assert.AnError, 1), "already dead")
+	f := federated{
+		judges:    []*simple{{page: "https://a/", dead: dead}},
+		selection: fixedOrderSelection,
+	}
+	assert.Equal(t, "https://a/", f.pick().page)
+}
@@ -0,0 +1,42 @@
+package checker
+
+import (
+	"net/netip"
+	"sort"
+)
+
+// DedupByExit keeps the fastest passed result per exit IP, as proxies of
+// backconnect services often share a few exits, and sorts them by it.
+// Failed results are dropped, and passed ones without known exit are kept
+// in the end, as they cannot be told apart.
+func DedupByExit(results []CheckResult) (out []CheckResult) {
+	best := map[string]int{}
+	var unknown []CheckResult
+	for _, r := range results {
+		if !r.Ok() {
+			continue
+		}
+		if r.ExitIP == "" {
+			unknown = append(unknown, r)
+			continue
+		}
+		i, ok := best[r.ExitIP]
+		if !ok {
+			best[r.ExitIP] = len(out)
+			out = append(out, r)
+			continue
+		}
+		if r.Speed < out[i].Speed {
+			out[i] = r
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, errA := netip.ParseAddr(out[i].ExitIP)
+		b, errB := netip.ParseAddr(out[j].ExitIP)
+		if errA != nil || errB != nil {
+			return out[i].ExitIP < out[j].ExitIP
+		}
+		return a.Less(b)
+	})
+	return append(out, unknown...)
+}
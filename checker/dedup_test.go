@@ -0,0 +1,31 @@
+package checker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupByExit(t *testing.T) {
+	result := func(port int, exit string, speed time.Duration, err error) CheckResult {
+		r := newResult(pmux.HttpProxy(fmt.Sprintf("127.0.0.1:%d", port)), speed, err)
+		r.ExitIP = exit
+		return r
+	}
+	out := DedupByExit([]CheckResult{
+		result(1, "10.0.0.10", 300*time.Millisecond, nil),
+		result(2, "10.0.0.9", 200*time.Millisecond, nil),
+		result(3, "10.0.0.10", 100*time.Millisecond, nil),
+		result(4, "10.0.0.9", 50*time.Millisecond, fmt.Errorf("nope")),
+		result(5, "", 10*time.Millisecond, nil),
+		result(6, "10.0.0.10", 200*time.Millisecond, nil),
+	})
+	var ports []uint16
+	for _, r := range out {
+		ports = append(ports, r.Proxy.Port())
+	}
+	assert.Equal(t, []uint16{2, 3, 5}, ports)
+}
@@ -0,0 +1,45 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// isDNSError tells if the judge hostname failed to resolve, either locally
+// or remotely by the proxy, which is often a transient blip
+func isDNSError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	// remote resolution failures of proxies only come as text
+	msg := err.Error()
+	return strings.Contains(msg, "no such host") ||
+		strings.Contains(msg, "server misbehaving")
+}
+
+// check retries the whole check on DNS errors up to dnsRetries times,
+// sharing the judge budget between attempts
+func (cc *configurableChecker) check(ctx context.Context, cfg *checkerConfig, proxy pmux.Proxy) (time.Duration, error) {
+	ctx = withBudget(ctx, cfg.maxJudges)
+	for attempt := 0; ; attempt++ {
+		t, err := cc.checkOnce(ctx, cfg, proxy)
+		if attempt >= cfg.dnsRetries || !isDNSError(err) {
+			return t, err
+		}
+		select {
+		case <-ctx.Done():
+			return t, err
+		case <-time.After(cfg.dnsRetryDelay):
+		}
+		observed(ctx).count(checkCounters{retries: 1})
+	}
+}
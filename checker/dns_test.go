@@ -0,0 +1,59 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDNSError(t *testing.T) {
+	assert.False(t, isDNSError(nil))
+	assert.True(t, isDNSError(fmt.Errorf("get: %w", &net.DNSError{Err: "no such host", Name: "judge"})))
+	assert.True(t, isDNSError(fmt.Errorf("socks connect tcp judge:443: lookup judge: server misbehaving")))
+	assert.False(t, isDNSError(fmt.Errorf("connection refused")))
+}
+
+func TestDNSRetries(t *testing.T) {
+	for i, tt := range []struct {
+		failures  int
+		err       error
+		retries   int
+		attempts  int
+		expectErr string
+	}{
+		{failures: 2, err: &net.DNSError{Err: "no such host", Name: "judge"}, retries: 2, attempts: 3},
+		{failures: 3, err: &net.DNSError{Err: "no such host", Name: "judge"}, retries: 2, attempts: 3,
+			expectErr: "lookup judge: no such host"},
+		{failures: 1, err: fmt.Errorf("refused"), retries: 2, attempts: 1, expectErr: "refused"},
+		{failures: 1, err: &net.DNSError{Err: "no such host", Name: "judge"}, attempts: 1,
+			expectErr: "lookup judge: no such host"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			attempts := 0
+			cc := &configurableChecker{
+				strategies: map[string]Checker{
+					"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+						attempts++
+						if attempts <= tt.failures {
+							return 0, tt.err
+						}
+						return time.Millisecond, nil
+					}),
+				},
+			}
+			cc.use(checkerConfig{dnsRetries: tt.retries, dnsRetryDelay: time.Millisecond})
+			_, err := cc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			assert.Equal(t, tt.attempts, attempts)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
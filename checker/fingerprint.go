@@ -0,0 +1,152 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+var errFingerprintMismatch = fmt.Errorf("tcp fingerprint mismatch")
+
+// fingerprintMismatch is the TCP stack, that differs from the OS, that the
+// proxy is expected to run, e.g. when the proxy preserves SYN packets of
+// the client behind it
+type fingerprintMismatch struct {
+	expected string
+	observed TCPFingerprint
+}
+
+func (e fingerprintMismatch) Error() string {
+	return fmt.Sprintf("%s: expected %s, got %s", errFingerprintMismatch, e.expected, e.observed)
+}
+
+func (e fingerprintMismatch) Is(target error) bool {
+	return target == errFingerprintMismatch
+}
+
+// TCPFingerprint is the TCP-level view of the connection, as reported by
+// a p0f-like judge, that responds with JSON containing at least TTL and MSS
+// of the SYN packet it has observed. Full p0f signatures are out of scope.
+type TCPFingerprint struct {
+	TTL int    `json:"ttl"`
+	MSS int    `json:"mss"`
+	OS  string `json:"os,omitempty"`
+}
+
+func (f TCPFingerprint) String() string {
+	out := fmt.Sprintf("ttl %d, mss %d", f.TTL, f.MSS)
+	if f.OS != "" {
+		out += fmt.Sprintf(" (%s)", f.OS)
+	}
+	return out
+}
+
+// initialTTL guesses the TTL set by the sender, as every hop decrements it
+func (f TCPFingerprint) initialTTL() int {
+	for _, v := range []int{32, 64, 128} {
+		if f.TTL <= v {
+			return v
+		}
+	}
+	return 255
+}
+
+// osTTL are initial TTLs of OS families, that p0f-like judges name
+var osTTL = map[string]int{
+	"linux":   64,
+	"android": 64,
+	"freebsd": 64,
+	"openbsd": 64,
+	"mac":     64,
+	"ios":     64,
+	"windows": 128,
+	"solaris": 255,
+	"cisco":   255,
+}
+
+// osFamily is the known family in the OS name, e.g. "linux" of "Linux 3.11"
+func osFamily(name string) string {
+	name = strings.ToLower(name)
+	for family := range osTTL {
+		if strings.HasPrefix(name, family) {
+			return family
+		}
+	}
+	return ""
+}
+
+// matches tells if the fingerprint is likely of the family, where OS
+// reported by the judge is trusted over the TTL
+func (f TCPFingerprint) matches(family string) bool {
+	observed := osFamily(f.OS)
+	if observed != "" {
+		return observed == family
+	}
+	return f.initialTTL() == osTTL[family]
+}
+
+// fingerprint is an optional advanced check, that compares TCP fingerprint
+// seen by the judge through the proxy with the OS, that the proxy claims in
+// "os" label of the check or is expected to run by fingerprint_os. Without
+// either the fingerprint is only reported in the CheckResult.
+type fingerprint struct {
+	client httpClient
+	page   string
+	os     string
+}
+
+func newFingerprint(client httpClient, page, os string) (*fingerprint, error) {
+	if os != "" && osFamily(os) == "" {
+		return nil, fmt.Errorf("unknown os: %s", os)
+	}
+	return &fingerprint{
+		client: client,
+		page:   page,
+		os:     os,
+	}, nil
+}
+
+func (fc *fingerprint) observe(ctx context.Context, proxy pmux.Proxy) (TCPFingerprint, error) {
+	var observed TCPFingerprint
+	res, err := probeResponse(ctx, fc.client, proxy, "GET", fc.page, nil, nil)
+	if err != nil {
+		return observed, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return observed, err
+	}
+	if res.StatusCode != 200 {
+		// error pages of judges may still be valid JSON
+		return observed, fmt.Errorf("status %d: %s", res.StatusCode, truncatedBody(ctx, string(body)))
+	}
+	err = json.Unmarshal(body, &observed)
+	if err != nil {
+		return observed, fmt.Errorf("not fingerprint: %s", truncatedBody(ctx, string(body)))
+	}
+	if observed.TTL == 0 {
+		return observed, fmt.Errorf("no ttl: %s", truncatedBody(ctx, string(body)))
+	}
+	return observed, nil
+}
+
+func (fc *fingerprint) Check(ctx context.Context, proxy pmux.Proxy) error {
+	seen, err := fc.observe(ctx, proxy)
+	if err != nil {
+		return fmt.Errorf("fingerprint: %w", err)
+	}
+	observed(ctx).fingerprinted(seen)
+	expected := labelsFrom(ctx)["os"]
+	if osFamily(expected) == "" {
+		expected = fc.os
+	}
+	if expected == "" || seen.matches(osFamily(expected)) {
+		return nil
+	}
+	return fingerprintMismatch{expected, seen}
+}
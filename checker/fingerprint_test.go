@@ -0,0 +1,141 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+type clientFunc func(req *http.Request) (*http.Response, error)
+
+func (f clientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func proxiedOrDirect(proxied, direct string) clientFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		b := direct
+		if pmux.GetProxyFromContext(req.Context()) != 0 {
+			b = proxied
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       body(b),
+		}, nil
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	for i, tt := range []struct {
+		os        string
+		label     string
+		proxied   string
+		expectErr string
+	}{
+		{
+			// most proxies run the same OS as this host
+			os:      "linux",
+			proxied: `{"ttl": 51, "mss": 1460, "os": "Linux 3.11"}`,
+		},
+		{
+			os:        "linux",
+			proxied:   `{"ttl": 113, "mss": 1460, "os": "Windows 7"}`,
+			expectErr: "tcp fingerprint mismatch: expected linux, got ttl 113, mss 1460 (Windows 7)",
+		},
+		{
+			os:        "linux",
+			proxied:   `{"ttl": 113, "mss": 1380}`,
+			expectErr: "tcp fingerprint mismatch: expected linux, got ttl 113, mss 1380",
+		},
+		{
+			os:      "linux",
+			label:   "Windows",
+			proxied: `{"ttl": 113, "mss": 1380}`,
+		},
+		{
+			label:     "windows",
+			proxied:   `{"ttl": 51, "mss": 1460}`,
+			expectErr: "tcp fingerprint mismatch: expected windows, got ttl 51, mss 1460",
+		},
+		{
+			// unknown claims fall back to fingerprint_os
+			label:   "plan9",
+			proxied: `{"ttl": 51, "mss": 1460}`,
+		},
+		{
+			proxied: `{"ttl": 113, "mss": 1460, "os": "Windows 7"}`,
+		},
+		{
+			proxied:   `<html>blocked</html>`,
+			expectErr: "fingerprint: not fingerprint: blocked",
+		},
+		{
+			proxied:   `{}`,
+			expectErr: "fingerprint: no ttl: {}",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ctx, o := observe(context.Background())
+			if tt.label != "" {
+				ctx = WithLabels(ctx, map[string]string{"os": tt.label})
+			}
+			client := proxiedOrDirect(tt.proxied, "")
+			fc, err := newFingerprint(client, "https://localhost/tcp", tt.os)
+			assert.NoError(t, err)
+
+			err = fc.Check(ctx, pmux.HttpProxy("127.0.0.1:23"))
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, o.tcpFingerprint())
+		})
+	}
+	assert.True(t, errors.Is(fingerprintMismatch{}, errFingerprintMismatch))
+}
+
+func TestFingerprintOfFailedJudge(t *testing.T) {
+	var agent string
+	fc, err := newFingerprint(clientFunc(func(req *http.Request) (*http.Response, error) {
+		agent = req.Header.Get("User-Agent")
+		return &http.Response{
+			StatusCode: 503,
+			Body:       body(`{"ttl": 64, "error": "overloaded"}`),
+		}, nil
+	}), "https://localhost/tcp", "linux")
+	assert.NoError(t, err)
+	ctx, o := observe(context.Background())
+	err = fc.Check(ctx, pmux.HttpProxy("127.0.0.1:23"))
+	assert.EqualError(t, err, "fingerprint: status 503: {\n  \"ttl\": 64,\n  \"error\": \"overloaded\"\n}")
+	assert.Nil(t, o.tcpFingerprint())
+	assert.NotEmpty(t, agent)
+}
+
+func TestFingerprintUnknownOS(t *testing.T) {
+	_, err := newFingerprint(nil, "https://localhost/tcp", "plan9")
+	assert.EqualError(t, err, "unknown os: plan9")
+}
+
+func TestFingerprintInResult(t *testing.T) {
+	fc, err := newFingerprint(proxiedOrDirect(`{"ttl": 113, "mss": 1380, "os": "Windows"}`, ""),
+		"https://localhost/tcp", "linux")
+	assert.NoError(t, err)
+	cc := (&configurableChecker{}).use(checkerConfig{
+		strategies: map[string]Checker{
+			"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				return time.Second, nil
+			}),
+		},
+		fingerprint: fc,
+	})
+	r := cc.Result(context.Background(), pmux.HttpProxy("127.0.0.1:23"))
+	assert.ErrorIs(t, r.Err, errFingerprintMismatch)
+	assert.Equal(t, &TCPFingerprint{TTL: 113, MSS: 1380, OS: "Windows"}, r.TCPFingerprint)
+}
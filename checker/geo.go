@@ -0,0 +1,120 @@
+package checker
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+)
+
+var errGeoMismatch = fmt.Errorf("exit IP location is inconsistent with latency")
+
+// geoMismatch is the exit IP, that geo lookup places in the region, which
+// is either too slow to reach or much slower than other region
+type geoMismatch struct {
+	country string
+	region  string
+	reason  string
+}
+
+func (e geoMismatch) Error() string {
+	return fmt.Sprintf("%s: %s is in %s, but %s", errGeoMismatch, e.country, e.region, e.reason)
+}
+
+func (e geoMismatch) Is(target error) bool {
+	return target == errGeoMismatch
+}
+
+// geoConsistency compares the geo lookup of the exit IP with latencies,
+// that regional strategy has measured to judges of every region
+type geoConsistency struct {
+	lookup ipinfo.IpInfoGetter
+	// countries map ISO codes to regions of region_<name> judges
+	countries  map[string]string
+	maxLatency time.Duration
+	require    bool
+}
+
+// configureGeo parses geo_regions, where every comma-separated entry is
+// the region followed by ISO country codes, e.g. "us US CA, eu DE FR".
+func configureGeo(conf app.Config, lookup ipinfo.IpInfoGetter, regions regional) (*geoConsistency, error) {
+	raw := conf.StrOr("geo_regions", "")
+	if raw == "" {
+		return nil, nil
+	}
+	if lookup == nil {
+		return nil, fmt.Errorf("geo_regions: no ip lookup")
+	}
+	countries := map[string]string{}
+	for _, v := range strings.Split(raw, ",") {
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("geo_regions: no countries for %s", fields[0])
+		}
+		_, ok := regions[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("geo_regions: unknown region: %s", fields[0])
+		}
+		for _, country := range fields[1:] {
+			countries[strings.ToUpper(country)] = fields[0]
+		}
+	}
+	return &geoConsistency{
+		lookup:     lookup,
+		countries:  countries,
+		maxLatency: conf.DurOr("geo_max_latency", 300*time.Millisecond),
+		require:    conf.BoolOr("require_geo_consistency", false),
+	}, nil
+}
+
+// verify returns nil, when there's not enough data to tell: unknown exit,
+// country outside of configured regions, or judges of region not reached.
+// Another region being more than twice faster is also inconsistent.
+func (g *geoConsistency) verify(exitIP string, latencies map[string]time.Duration) error {
+	if g == nil || exitIP == "" || len(latencies) == 0 {
+		return nil
+	}
+	country := g.country(exitIP)
+	region, ok := g.countries[country]
+	if !ok {
+		return nil
+	}
+	home, ok := latencies[region]
+	if !ok {
+		return nil
+	}
+	if home > g.maxLatency {
+		return geoMismatch{country, region, fmt.Sprintf("took %s to reach",
+			home.Round(time.Millisecond))}
+	}
+	var fastest string
+	for other, t := range latencies {
+		if other == region || t*2 >= home {
+			continue
+		}
+		if fastest == "" || t < latencies[fastest] {
+			fastest = other
+		}
+	}
+	if fastest != "" {
+		return geoMismatch{country, region, fmt.Sprintf("%s is faster: %s vs %s", fastest,
+			latencies[fastest].Round(time.Millisecond), home.Round(time.Millisecond))}
+	}
+	return nil
+}
+
+func (g *geoConsistency) country(exitIP string) string {
+	ip := net.ParseIP(exitIP).To4()
+	if ip == nil {
+		// proxies, that lookups are keyed by, are IPv4-only
+		return ""
+	}
+	return g.lookup.Get(pmux.HttpProxy(net.JoinHostPort(ip.String(), "1"))).Country
+}
@@ -0,0 +1,79 @@
+package checker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoConsistency(t *testing.T) {
+	regions := regional{"us": federated{}, "eu": federated{}}
+	g, err := configureGeo(app.Config{
+		"geo_regions": "us US CA, eu de fr",
+	}, ipinfo.NoopIpInfo{Country: "US"}, regions)
+	assert.NoError(t, err)
+	for i, tt := range []struct {
+		exit      string
+		latencies map[string]time.Duration
+		expectErr string
+	}{
+		{
+			exit:      "1.2.3.4",
+			latencies: map[string]time.Duration{"us": 80 * time.Millisecond, "eu": 120 * time.Millisecond},
+		},
+		{
+			exit:      "1.2.3.4",
+			latencies: map[string]time.Duration{"us": 400 * time.Millisecond},
+			expectErr: "exit IP location is inconsistent with latency: US is in us, but took 400ms to reach",
+		},
+		{
+			exit:      "1.2.3.4",
+			latencies: map[string]time.Duration{"us": 200 * time.Millisecond, "eu": 30 * time.Millisecond},
+			expectErr: "exit IP location is inconsistent with latency: US is in us, but eu is faster: 30ms vs 200ms",
+		},
+		{
+			exit:      "1.2.3.4",
+			latencies: map[string]time.Duration{"eu": 30 * time.Millisecond},
+		},
+		{
+			exit:      "2001:db8::1",
+			latencies: map[string]time.Duration{"us": 400 * time.Millisecond},
+		},
+		{
+			latencies: map[string]time.Duration{"us": 400 * time.Millisecond},
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			err := g.verify(tt.exit, tt.latencies)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				assert.ErrorIs(t, err, errGeoMismatch)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConfigureGeo(t *testing.T) {
+	regions := regional{"us": federated{}}
+	for i, tt := range []struct {
+		raw       string
+		expectErr string
+	}{
+		{"us", "geo_regions: no countries for us"},
+		{"apac JP", "geo_regions: unknown region: apac"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			_, err := configureGeo(app.Config{"geo_regions": tt.raw}, ipinfo.NoopIpInfo{}, regions)
+			assert.EqualError(t, err, tt.expectErr)
+		})
+	}
+	g, err := configureGeo(app.Config{}, nil, regions)
+	assert.NoError(t, err)
+	assert.Nil(t, g)
+}
@@ -0,0 +1,75 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// golden gates the check with authoritative self-hosted judges and only
+// then cross-validates the proxy with public ones, so that proxies failing
+// the golden judge never cost public judge calls
+type golden struct {
+	golden federated
+	public Checker
+}
+
+// configureGolden reads comma-separated judges from golden_judges
+func configureGolden(conf app.Config, client httpClient, ip string, public Checker) *golden {
+	var f federated
+	for _, page := range strings.Split(conf.StrOr("golden_judges", ""), ",") {
+		page = strings.TrimSpace(page)
+		if page == "" {
+			continue
+		}
+		f.judges = append(f.judges, &simple{
+			client: client,
+			page:   page,
+			ip:     ip,
+		})
+	}
+	if len(f.judges) == 0 || public == nil {
+		return nil
+	}
+	f.next = new(uint32)
+	return &golden{
+		golden: f,
+		public: public,
+	}
+}
+
+func (g golden) withSelection(s selection) Checker {
+	g.golden = g.golden.selectBy(s)
+	sp, ok := g.public.(selectable)
+	if ok {
+		g.public = sp.withSelection(s)
+	}
+	return g
+}
+
+// Check returns the latency of the golden judge. Public judges can only
+// overturn its verdict by finding this IP, as their other failures are
+// rather about public judges than about the proxy.
+func (g golden) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+	t, err := g.golden.Check(ctx, proxy)
+	if isTimeout(err) {
+		return t, err
+	}
+	if err != nil {
+		return t, fmt.Errorf("golden: %w", err)
+	}
+	_, err = g.public.Check(ctx, proxy)
+	if errors.Is(err, ErrNotAnonymous) {
+		return t, fmt.Errorf("public: %w", err)
+	}
+	if err != nil {
+		log := app.Log.From(ctx)
+		log.Debug().Err(redactErr(err)).Msg("public judge failed after golden one")
+	}
+	return t, nil
+}
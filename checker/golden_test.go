@@ -0,0 +1,68 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoldenCheck(t *testing.T) {
+	for i, tt := range []struct {
+		golden    string
+		public    error
+		called    bool
+		expectErr string
+	}{
+		{golden: "1.2.3.4", called: true},
+		{golden: "1.2.3.4", public: fmt.Errorf("public is down"), called: true},
+		{golden: "1.2.3.4", public: ErrNotAnonymous, called: true,
+			expectErr: "public: this IP address found"},
+		{golden: "255.0.0.1", expectErr: "golden: this IP address found"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			called := false
+			g := configureGolden(app.Config{
+				"golden_judges": "https://golden/ip",
+			}, clientFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: 200,
+					Body:       body(tt.golden),
+				}, nil
+			}), "255.0.0.1", checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				called = true
+				return time.Second, tt.public
+			}))
+			_, err := g.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			assert.Equal(t, tt.called, called)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConfigureGoldenStrategy(t *testing.T) {
+	assert.Nil(t, configureGolden(app.Config{}, nil, "", federated{}))
+
+	c := configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	err := c.Configure(app.Config{
+		"strategy":      "golden",
+		"golden_judges": "https://golden/ip",
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, golden{}, c.current().strategies["golden"])
+}
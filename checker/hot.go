@@ -0,0 +1,60 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// hotDestination is the popular site, that proxies are often throttled on,
+// even when judges respond to them just fine
+type hotDestination struct {
+	client   httpClient
+	page     string
+	slowdown int
+}
+
+func configureHot(conf app.Config, client httpClient) *hotDestination {
+	page := conf.StrOr("hot_destination", "")
+	if page == "" {
+		return nil
+	}
+	return &hotDestination{
+		client:   client,
+		page:     page,
+		slowdown: conf.IntOr("hot_slowdown", 3),
+	}
+}
+
+// throttled requests the hot destination through the proxy, that passed
+// the check in judgeSpeed, and returns the reason, if it was throttled
+func (h *hotDestination) throttled(ctx context.Context, proxy pmux.Proxy, judgeSpeed time.Duration) (string, error) {
+	start := time.Now()
+	res, err := probeResponse(ctx, h.client, proxy, "GET", h.page, nil, nil)
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return "timed out", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("hot destination: %w", err)
+	}
+	defer res.Body.Close()
+	// only the time to the first meaningful bytes is compared
+	io.CopyN(ioutil.Discard, res.Body, 64<<10)
+	took := time.Since(start)
+	if res.StatusCode == http.StatusTooManyRequests {
+		return "status 429", nil
+	}
+	if judgeSpeed > 0 && took > judgeSpeed*time.Duration(h.slowdown) {
+		return fmt.Sprintf("%.1fx slower", float64(took)/float64(judgeSpeed)), nil
+	}
+	return "", nil
+}
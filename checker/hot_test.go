@@ -0,0 +1,57 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotDestination(t *testing.T) {
+	assert.Nil(t, configureHot(app.Config{}, nil))
+	for i, tt := range []struct {
+		status    int
+		delay     time.Duration
+		err       error
+		expect    string
+		expectErr string
+	}{
+		{status: 200},
+		{status: 429, expect: "status 429"},
+		{status: 200, delay: 50 * time.Millisecond, expect: "x slower"},
+		{err: &net.DNSError{IsTimeout: true}, expect: "timed out"},
+		{err: fmt.Errorf("refused"), expectErr: "hot destination: refused"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			h := configureHot(app.Config{
+				"hot_destination": "https://hot.example.com/",
+			}, clientFunc(func(req *http.Request) (*http.Response, error) {
+				time.Sleep(tt.delay)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &http.Response{
+					StatusCode: tt.status,
+					Body:       body("..."),
+				}, nil
+			}))
+			reason, err := h.throttled(context.Background(), pmux.HttpProxy("127.0.0.1:1"), 10*time.Millisecond)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.expect == "" {
+				assert.Equal(t, "", reason)
+				return
+			}
+			assert.Contains(t, reason, tt.expect)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package checker
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// hourlySamples are needed before the hour of the judge is trusted
+const hourlySamples = 5
+
+// hourlyLatency keeps the running latency of passed checks per judge and
+// hour of the day in UTC, so that judges could be avoided during the hours,
+// they are typically slammed or throttled in
+type hourlyLatency struct {
+	sync.Mutex
+	pages map[string]*[24]hourStat
+	now   func() time.Time
+}
+
+type hourStat struct {
+	mean    time.Duration
+	samples int
+}
+
+func newHourlyLatency() *hourlyLatency {
+	return &hourlyLatency{
+		pages: map[string]*[24]hourStat{},
+		now:   time.Now,
+	}
+}
+
+func (h *hourlyLatency) record(page string, t time.Duration) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	hours, ok := h.pages[page]
+	if !ok {
+		hours = &[24]hourStat{}
+		h.pages[page] = hours
+	}
+	stat := &hours[h.now().UTC().Hour()]
+	if stat.samples == 0 {
+		stat.mean = t
+	} else {
+		// recent days weigh more than older ones
+		stat.mean += (t - stat.mean) / 10
+	}
+	stat.samples++
+}
+
+// expected returns the latency of the judge at this hour or zero, if unknown
+func (h *hourlyLatency) expected(page string) time.Duration {
+	if h == nil {
+		return 0
+	}
+	h.Lock()
+	defer h.Unlock()
+	hours, ok := h.pages[page]
+	if !ok {
+		return 0
+	}
+	stat := hours[h.now().UTC().Hour()]
+	if stat.samples < hourlySamples {
+		return 0
+	}
+	return stat.mean
+}
+
+// pickHourly picks judges randomly, with the weight inversely proportional
+// to their latency at this hour. Judges without enough history get the
+// average weight, so that they are explored as well.
+func (f federated) pickHourly() *simple {
+	weights := make([]float64, len(f.judges))
+	var known float64
+	var count int
+	for i, j := range f.judges {
+		t := j.hours.expected(j.page)
+		if t <= 0 {
+			continue
+		}
+		weights[i] = 1 / t.Seconds()
+		known += weights[i]
+		count++
+	}
+	fallback := 1.0
+	if count > 0 {
+		fallback = known / float64(count)
+	}
+	var total float64
+	for i := range weights {
+		if weights[i] == 0 {
+			weights[i] = fallback
+		}
+		total += weights[i]
+	}
+	r := rand.Float64() * total
+	for i, w := range weights {
+		r -= w
+		if r < 0 {
+			return f.judges[i]
+		}
+	}
+	return f.judges[len(f.judges)-1]
+}
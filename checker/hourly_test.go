@@ -0,0 +1,60 @@
+package checker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHourlyLatency(t *testing.T) {
+	now := time.Date(2022, 1, 1, 14, 0, 0, 0, time.UTC)
+	h := newHourlyLatency()
+	h.now = func() time.Time { return now }
+	for i := 0; i < hourlySamples-1; i++ {
+		h.record("a", 100*time.Millisecond)
+	}
+	assert.Equal(t, time.Duration(0), h.expected("a"), "not enough samples")
+	h.record("a", 200*time.Millisecond)
+	assert.Equal(t, 110*time.Millisecond, h.expected("a"))
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), h.expected("a"), "other hour")
+	now = now.Add(23 * time.Hour)
+	assert.Equal(t, 110*time.Millisecond, h.expected("a"), "same hour next day")
+}
+
+func TestHourlySelection(t *testing.T) {
+	h := newHourlyLatency()
+	for i := 0; i < hourlySamples; i++ {
+		h.record("slow", time.Second)
+		h.record("fast", 10*time.Millisecond)
+	}
+	f := federated{judges: []*simple{
+		{page: "slow", hours: h},
+		{page: "fast", hours: h},
+		{page: "new", hours: h},
+	}}.selectBy(hourlySelection)
+	picked := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		picked[f.pick().page]++
+	}
+	assert.Less(t, picked["slow"], 50)
+	assert.Greater(t, picked["fast"], 550)
+	assert.Greater(t, picked["new"], 250, "unknown judges get the average weight")
+}
+
+func TestHourlySelectionIsConfigured(t *testing.T) {
+	cc := &configurableChecker{
+		ip: "255.0.0.1",
+		strategies: map[string]Checker{
+			"simple": federated{judges: []*simple{{page: "a"}}},
+		},
+	}
+	err := cc.Configure(app.Config{"selection": "hourly"})
+	assert.NoError(t, err)
+	f := cc.current().strategies["simple"].(federated)
+	assert.Equal(t, hourlySelection, f.selection)
+	assert.Equal(t, cc.hours, f.judges[0].hours)
+}
@@ -0,0 +1,134 @@
+package checker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	errJudgeIdentity = fmt.Errorf("judge identity mismatch")
+	errTLSStripped   = fmt.Errorf("tls stripped")
+)
+
+// judgeIdentityMismatch is the connection, that terminated somewhere else,
+// than the pinned judge, usually at the transparent intercepting proxy
+type judgeIdentityMismatch struct {
+	expected string
+	actual   string
+}
+
+func (e judgeIdentityMismatch) Error() string {
+	return fmt.Sprintf("%s: expected %s, got %s", errJudgeIdentity, e.expected, e.actual)
+}
+
+func (e judgeIdentityMismatch) Is(target error) bool {
+	return target == errJudgeIdentity
+}
+
+// parseJudgeIdentities parses comma-separated pairs of https judge page and
+// the IP or DNS name, that its certificate has to be issued for, e.g.
+// "https://judge.example.com/ip judge.example.com"
+func parseJudgeIdentities(raw string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, v := range strings.Split(raw, ",") {
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid judge identity: %s", strings.TrimSpace(v))
+		}
+		if !strings.HasPrefix(fields[0], "https://") {
+			return nil, fmt.Errorf("invalid judge identity: %s is not https", fields[0])
+		}
+		out[fields[0]] = fields[1]
+	}
+	return out, nil
+}
+
+// verifyIdentity checks the certificate of the judge, as proxies only
+// tunnel TLS and the peer of TCP connection is always the proxy itself.
+// Handshakes through proxies skip verification, so interceptors presenting
+// self-signed certificates for the right name are caught by the chain.
+func verifyIdentity(expected string, res *http.Response, roots *x509.CertPool) error {
+	if expected == "" {
+		return nil
+	}
+	if res.TLS == nil || len(res.TLS.PeerCertificates) == 0 {
+		return judgeIdentityMismatch{expected, "no certificate"}
+	}
+	leaf := res.TLS.PeerCertificates[0]
+	if leaf.VerifyHostname(expected) == nil {
+		err := verifyChain(res.TLS, expected, roots)
+		if err != nil {
+			return judgeIdentityMismatch{expected, fmt.Sprintf("untrusted certificate: %s", err)}
+		}
+		return nil
+	}
+	var names []string
+	names = append(names, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 {
+		names = append(names, leaf.Subject.CommonName)
+	}
+	return judgeIdentityMismatch{expected, fmt.Sprintf("certificate for %s",
+		strings.Join(names, ","))}
+}
+
+// tlsStripped is the response to https judge, that has arrived without
+// genuine TLS, e.g. when the proxy fetched the origin over plain HTTP
+type tlsStripped struct {
+	reason string
+}
+
+func (e tlsStripped) Error() string {
+	return fmt.Sprintf("%s: %s", errTLSStripped, e.reason)
+}
+
+func (e tlsStripped) Is(target error) bool {
+	return target == errTLSStripped
+}
+
+// verifyTLS checks, that response to https request came over completed
+// handshake with the trusted certificate for the requested host
+func verifyTLS(res *http.Response, roots *x509.CertPool) error {
+	if res.Request == nil || res.Request.URL.Scheme != "https" {
+		return nil
+	}
+	state := res.TLS
+	if state == nil || !state.HandshakeComplete {
+		return tlsStripped{"no tls connection"}
+	}
+	if len(state.PeerCertificates) == 0 {
+		return tlsStripped{"no certificate"}
+	}
+	host := res.Request.URL.Hostname()
+	if state.PeerCertificates[0].VerifyHostname(host) != nil {
+		return tlsStripped{fmt.Sprintf("certificate is not for %s", host)}
+	}
+	err := verifyChain(state, host, roots)
+	if err != nil {
+		return tlsStripped{fmt.Sprintf("untrusted certificate: %s", err)}
+	}
+	return nil
+}
+
+// verifyChain verifies certificates, that the peer has presented, against
+// roots, where nil are the system ones
+func verifyChain(state *tls.ConnectionState, name string, roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       name,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
@@ -0,0 +1,206 @@
+package checker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJudgeIdentity(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+	trusted := x509.NewCertPool()
+	trusted.AddCert(server.Certificate())
+	for i, tt := range []struct {
+		identity  string
+		roots     *x509.CertPool
+		expectErr string
+	}{
+		{identity: "127.0.0.1", roots: trusted},
+		{identity: "example.com", roots: trusted},
+		{
+			identity:  "judge.example.org",
+			roots:     trusted,
+			expectErr: "judge identity mismatch: expected judge.example.org, got certificate for example.com,*.example.com,127.0.0.1,::1",
+		},
+		{
+			// self-signed certificate of interceptor for the right name
+			identity:  "example.com",
+			expectErr: "judge identity mismatch: expected example.com, got untrusted certificate: x509: certificate signed by unknown authority",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			sc := &simple{
+				client:   server.Client(),
+				page:     server.URL,
+				ip:       "255.0.0.1",
+				identity: tt.identity,
+				roots:    tt.roots,
+			}
+			// pinned judges keep https for HTTP proxies
+			_, err := sc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				assert.True(t, errors.Is(err, errJudgeIdentity))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestJudgeIdentityWithoutTLS(t *testing.T) {
+	err := verifyIdentity("judge.example.org", &http.Response{}, nil)
+	assert.EqualError(t, err, "judge identity mismatch: expected judge.example.org, got no certificate")
+	assert.NoError(t, verifyIdentity("", &http.Response{}, nil))
+}
+
+func TestParseJudgeIdentities(t *testing.T) {
+	out, err := parseJudgeIdentities("https://a/ip a, https://1.2.3.4/ip 1.2.3.4,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"https://a/ip":       "a",
+		"https://1.2.3.4/ip": "1.2.3.4",
+	}, out)
+
+	_, err = parseJudgeIdentities("https://a/ip")
+	assert.EqualError(t, err, "invalid judge identity: https://a/ip")
+	_, err = parseJudgeIdentities("http://a/ip a")
+	assert.EqualError(t, err, "invalid judge identity: http://a/ip is not https")
+}
+
+func TestVerifyTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+	res, err := server.Client().Get(server.URL)
+	assert.NoError(t, err)
+	res.Body.Close()
+	genuine := res.TLS
+	trusted := x509.NewCertPool()
+	trusted.AddCert(server.Certificate())
+
+	issued, ca := issuedCertificate(t, "judge")
+	request := func(page string) *http.Request {
+		req, _ := http.NewRequest("GET", page, nil)
+		return req
+	}
+	for i, tt := range []struct {
+		res       *http.Response
+		roots     *x509.CertPool
+		expectErr string
+	}{
+		{res: &http.Response{}},
+		{res: &http.Response{Request: request("http://judge/ip")}},
+		{res: &http.Response{Request: request(server.URL), TLS: genuine}, roots: trusted},
+		{res: &http.Response{Request: request("https://judge/ip"), TLS: issued}, roots: ca},
+		{
+			res:       &http.Response{Request: request("https://judge/ip")},
+			expectErr: "tls stripped: no tls connection",
+		},
+		{
+			res:       &http.Response{Request: request("https://judge/ip"), TLS: genuine},
+			roots:     trusted,
+			expectErr: "tls stripped: certificate is not for judge",
+		},
+		{
+			// issued by the CA outside of the roots
+			res:       &http.Response{Request: request("https://judge/ip"), TLS: issued},
+			roots:     trusted,
+			expectErr: "tls stripped: untrusted certificate: x509: certificate signed by unknown authority",
+		},
+		{
+			res:       &http.Response{Request: request(server.URL), TLS: genuine},
+			expectErr: "tls stripped: untrusted certificate: x509: certificate signed by unknown authority",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			err := verifyTLS(tt.res, tt.roots)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				assert.True(t, errors.Is(err, errTLSStripped))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// issuedCertificate is the connection state with the leaf for names, that
+// is issued by the intermediate of the returned root
+func issuedCertificate(t *testing.T, names ...string) (*tls.ConnectionState, *x509.CertPool) {
+	issue := func(template, parent *x509.Certificate, signer *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		if parent == nil {
+			parent, signer = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+		assert.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		assert.NoError(t, err)
+		return cert, key
+	}
+	ca := func(name string, serial int64) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+		}
+	}
+	root, rootKey := issue(ca("root", 1), nil, nil)
+	intermediate, intermediateKey := issue(ca("intermediate", 2), root, rootKey)
+	leaf, _ := issue(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, intermediate, intermediateKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &tls.ConnectionState{
+		HandshakeComplete: true,
+		PeerCertificates:  []*x509.Certificate{leaf, intermediate},
+	}, roots
+}
+
+func TestTLSStrippedCheck(t *testing.T) {
+	sc := &simple{
+		client: clientFunc(func(req *http.Request) (*http.Response, error) {
+			// plain response to https request
+			return &http.Response{
+				StatusCode: 200,
+				Request:    req,
+				Body:       body("1.2.3.4"),
+			}, nil
+		}),
+		page: "https://judge/ip",
+		ip:   "255.0.0.1",
+	}
+	_, err := sc.Check(context.Background(), pmux.Socks5Proxy("127.0.0.1:1"))
+	assert.True(t, errors.Is(err, errTLSStripped))
+}
@@ -0,0 +1,285 @@
+package checker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nfx/slrp/app"
+)
+
+// Judge is a self-hosted judge, that reports back what it has received from
+// the proxy, so that capability probes can verify proxy behavior against
+// something trusted. It serves only when judge.addr is configured.
+type Judge struct {
+	http.Server
+	tlsAddr   string
+	tlsConfig *tls.Config
+	closed    chan struct{}
+}
+
+func NewJudge() *Judge {
+	j := &Judge{
+		closed: make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ip", j.ip)
+	mux.HandleFunc("/size", j.size)
+	mux.HandleFunc("/chunked", j.chunked)
+	mux.HandleFunc("/encoded", j.encoded)
+	mux.HandleFunc("/conn", j.conn)
+	mux.HandleFunc("/large", j.large)
+	mux.HandleFunc("/trailers", j.trailers)
+	mux.HandleFunc("/hints", j.hints)
+	mux.HandleFunc("/raw", j.raw)
+	mux.HandleFunc("/tls", j.extensions)
+	mux.HandleFunc("/method", j.method)
+	j.Handler = recordRaw(mux)
+	j.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+		return helloConnContext(rawConnContext(ctx, conn), conn)
+	}
+	return j
+}
+
+func (j *Judge) Configure(c app.Config) error {
+	j.Addr = c.StrOr("addr", "")
+	j.tlsAddr = c.StrOr("tls_addr", "")
+	if j.tlsAddr == "" {
+		return nil
+	}
+	cert, err := judgeCertificate(c.StrOr("tls_cert", ""), c.StrOr("tls_key", ""))
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	j.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"http/1.1"},
+	}
+	return nil
+}
+
+func (j *Judge) ListenAndServe() error {
+	if j.Addr == "" {
+		// not configured, so just wait for shutdown
+		<-j.closed
+		return http.ErrServerClosed
+	}
+	l, err := net.Listen("tcp", j.Addr)
+	if err != nil {
+		return err
+	}
+	if j.tlsAddr != "" {
+		tl, err := net.Listen("tcp", j.tlsAddr)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		// both listeners are closed along with the server
+		go j.Serve(tls.NewListener(helloListener{tl}, j.tlsConfig))
+	}
+	return j.Serve(rawListener{l})
+}
+
+func (j *Judge) Close() error {
+	close(j.closed)
+	return j.Server.Close()
+}
+
+func (j *Judge) ip(rw http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	rw.Header().Set("Content-Type", "text/plain")
+	rw.Write([]byte(host))
+}
+
+// received is what judge has observed in the request
+type received struct {
+	Header int `json:"header"`
+	Body   int `json:"body"`
+}
+
+func headerBytes(h http.Header) (n int) {
+	for k, vs := range h {
+		for _, v := range vs {
+			// "Key: Value\r\n"
+			n += len(k) + len(v) + 4
+		}
+	}
+	return n
+}
+
+func (j *Judge) size(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.Copy(ioutil.Discard, r.Body)
+	if err != nil {
+		rw.WriteHeader(400)
+		return
+	}
+	raw, _ := json.Marshal(received{
+		Header: headerBytes(r.Header),
+		Body:   int(body),
+	})
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(raw)
+}
+
+func intParam(r *http.Request, key string, def int) int {
+	v, err := strconv.Atoi(r.FormValue(key))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+func durParam(r *http.Request, key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(r.FormValue(key))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+// chunkLine is a predictable payload, so that clients can verify integrity
+func chunkLine(i int) string {
+	return fmt.Sprintf("%d:%s", i, strings.Repeat(string(rune('a'+i%26)), 64))
+}
+
+// chunked streams lines with a delay between them, flushing every one
+func (j *Judge) chunked(rw http.ResponseWriter, r *http.Request) {
+	n := intParam(r, "n", 8)
+	delay := durParam(r, "delay", 100*time.Millisecond)
+	flusher, _ := rw.(http.Flusher)
+	rw.Header().Set("Content-Type", "text/plain")
+	for i := 0; i < n; i++ {
+		fmt.Fprintln(rw, chunkLine(i))
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// encodedPayload is compressible and predictable, so that clients can verify
+// the exact bytes proxy has delivered
+var encodedPayload = []byte(strings.Repeat(chunkLine(0)+"\n", 64))
+
+// gzippedPayload is deterministic, as gzip header has no name or time set
+func gzippedPayload() []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(encodedPayload)
+	w.Close()
+	return buf.Bytes()
+}
+
+// encoded serves the payload with Content-Encoding from the encoding param,
+// regardless of what client accepts
+func (j *Judge) encoded(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain")
+	switch r.FormValue("encoding") {
+	case "gzip":
+		rw.Header().Set("Content-Encoding", "gzip")
+		rw.Write(gzippedPayload())
+	case "", "identity":
+		rw.Write(encodedPayload)
+	default:
+		rw.WriteHeader(400)
+	}
+}
+
+// conn reports the connection, that request came from, along with the
+// sequence number of it, so that clients can verify reuse and ordering
+func (j *Judge) conn(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(rw, "%d %s", intParam(r, "n", 0), r.RemoteAddr)
+}
+
+// largeByte is a predictable payload at any offset
+func largeByte(offset int64) byte {
+	return byte('a' + offset%26)
+}
+
+type largePayload struct {
+	offset int64
+}
+
+func (p *largePayload) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = largeByte(p.offset)
+		p.offset++
+	}
+	return len(b), nil
+}
+
+// maxLarge keeps public judge from serving unbounded responses
+const maxLarge = 64 << 20
+
+// large serves the payload of the requested size with known length
+func (j *Judge) large(rw http.ResponseWriter, r *http.Request) {
+	size := intParam(r, "size", 1<<20)
+	if size > maxLarge {
+		size = maxLarge
+	}
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Header().Set("Content-Length", strconv.Itoa(size))
+	io.CopyN(rw, &largePayload{}, int64(size))
+}
+
+// trailerToken is the trailer, that echoes the token query parameter back
+const trailerToken = "X-Judge-Token"
+
+// trailers sends the token in the trailer of chunked response, which is
+// where gRPC-Web and streaming APIs carry their status
+func (j *Judge) trailers(rw http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	rw.Header().Set("Trailer", trailerToken)
+	rw.Header().Set("Content-Type", "text/plain")
+	for i := 0; i < 4; i++ {
+		fmt.Fprintln(rw, chunkLine(i))
+	}
+	rw.Header().Set(trailerToken, token)
+}
+
+// method echoes the method of the request with the token, so that probes
+// could tell methods, that were rewritten on the way
+func (j *Judge) method(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(rw, "%s %s", r.Method, r.URL.Query().Get("token"))
+}
+
+// hints sends 103 Early Hints with the token in the Link header before the
+// final response. Connection is hijacked, as net/http of Go 1.18 cannot
+// send informational responses.
+func (j *Judge) hints(rw http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		rw.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	payload := token + "\n"
+	fmt.Fprintf(buf, "HTTP/1.1 103 Early Hints\r\nLink: </%s.css>; rel=preload; as=style\r\n\r\n", token)
+	fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n"+
+		"Connection: close\r\n\r\n%s", len(payload), payload)
+	buf.Flush()
+}
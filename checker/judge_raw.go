@@ -0,0 +1,127 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// maxRawHead is the most of the request head, that the judge echoes back
+const maxRawHead = 64 << 10
+
+type rawKey struct{}
+
+// rawConn records bytes read from the connection, so that the judge could
+// echo the request head exactly as it arrived, before net/http parses it
+type rawConn struct {
+	net.Conn
+	sync.Mutex
+	buf []byte
+}
+
+func (c *rawConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.Lock()
+	if len(c.buf) < maxRawHead {
+		c.buf = append(c.buf, b[:n]...)
+	}
+	c.Unlock()
+	return n, err
+}
+
+// head returns the request line and headers of the current request
+func (c *rawConn) head() []byte {
+	c.Lock()
+	defer c.Unlock()
+	end := bytes.Index(c.buf, []byte("\r\n\r\n"))
+	if end == -1 {
+		return append([]byte{}, c.buf...)
+	}
+	return append([]byte{}, c.buf[:end+4]...)
+}
+
+// reset forgets the request once it's served, so that the next one on the
+// same connection starts from scratch. Pipelined requests are not supported.
+func (c *rawConn) reset() {
+	c.Lock()
+	c.buf = nil
+	c.Unlock()
+}
+
+type rawListener struct {
+	net.Listener
+}
+
+func (l rawListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &rawConn{Conn: conn}, nil
+}
+
+func rawConnContext(ctx context.Context, conn net.Conn) context.Context {
+	rc, ok := conn.(*rawConn)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, rawKey{}, rc)
+}
+
+// recordRaw resets recorded bytes after every request
+func recordRaw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rc, ok := r.Context().Value(rawKey{}).(*rawConn)
+		if ok {
+			defer rc.reset()
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// raw echoes the request line and headers byte by byte
+func (j *Judge) raw(rw http.ResponseWriter, r *http.Request) {
+	rc, ok := r.Context().Value(rawKey{}).(*rawConn)
+	if !ok {
+		rw.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Write(rc.head())
+}
+
+// RawEcho sends the request to self-hosted judge through the proxy and
+// returns the request line and headers exactly as the judge received them,
+// which shows how the proxy has normalized or rewritten the request
+func (cc *configurableChecker) RawEcho(ctx context.Context, proxy pmux.Proxy) (string, error) {
+	cfg := cc.current()
+	if cfg.judge == "" {
+		return "", fmt.Errorf("judge is not configured")
+	}
+	ctx = withConfig(ctx, cfg)
+	page := judgePage(proxy, cfg.judge+"/raw")
+	req, err := http.NewRequestWithContext(proxy.InContext(ctx), "GET", page, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", randomAgent(req.Context()))
+	res, err := cfg.client.Do(req)
+	if err != nil {
+		return "", redactErr(err)
+	}
+	defer res.Body.Close()
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("status %d: %s", res.StatusCode, truncatedBody(ctx, string(raw)))
+	}
+	return string(raw), nil
+}
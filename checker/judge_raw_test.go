@@ -0,0 +1,48 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawEcho(t *testing.T) {
+	j := NewJudge()
+	srv := httptest.NewUnstartedServer(j.Handler)
+	srv.Listener = rawListener{srv.Listener}
+	srv.Config.ConnContext = j.ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	cc := &configurableChecker{}
+	cc.use(checkerConfig{
+		client: &http.Client{
+			Transport: pmux.ContextualHttpTransport(),
+			Timeout:   5 * time.Second,
+		},
+		judge: "http://judge.local",
+	})
+	raw, err := cc.RawEcho(context.Background(), pmux.HttpProxy(srv.Listener.Addr().String()))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, "GET http://judge.local/raw HTTP/1.1\r\nHost: judge.local\r\n"), raw)
+	assert.Contains(t, raw, "\r\nUser-Agent: ")
+	assert.True(t, strings.HasSuffix(raw, "\r\n\r\n"))
+}
+
+func TestRawEchoWithoutRecorder(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	cc := &configurableChecker{}
+	cc.use(checkerConfig{client: client})
+	_, err := cc.RawEcho(context.Background(), proxy)
+	assert.EqualError(t, err, "judge is not configured")
+
+	cc.use(checkerConfig{client: client, judge: "http://judge.local"})
+	_, err = cc.RawEcho(context.Background(), proxy)
+	assert.EqualError(t, err, "status 501: ")
+}
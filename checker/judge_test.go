@@ -0,0 +1,37 @@
+package checker
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJudgeIsIdleWithoutAddr(t *testing.T) {
+	j := NewJudge()
+	err := j.Configure(app.Config{})
+	assert.NoError(t, err)
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- j.ListenAndServe()
+	}()
+	j.Close()
+	assert.Equal(t, http.ErrServerClosed, <-stopped)
+}
+
+func TestJudgeGeneratesCertificate(t *testing.T) {
+	j := NewJudge()
+	err := j.Configure(app.Config{
+		"tls_addr": "127.0.0.1:0",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, j.tlsConfig.Certificates, 1)
+
+	err = j.Configure(app.Config{
+		"tls_addr": "127.0.0.1:0",
+		"tls_cert": "nope.pem",
+	})
+	assert.EqualError(t, err, "tls: open nope.pem: no such file or directory")
+}
@@ -0,0 +1,216 @@
+package checker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxHello is the most of the handshake, that the judge buffers to find
+// the ClientHello in
+const maxHello = 64 << 10
+
+var errShortHello = fmt.Errorf("incomplete client hello")
+
+type helloKey struct{}
+
+// helloConn records bytes read from the connection until the ClientHello
+// is complete, as crypto/tls of Go 1.18 doesn't expose its extensions
+type helloConn struct {
+	net.Conn
+	sync.Mutex
+	buf        []byte
+	done       bool
+	extensions []uint16
+	err        error
+}
+
+func (c *helloConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.Lock()
+	defer c.Unlock()
+	if c.done {
+		return n, err
+	}
+	c.buf = append(c.buf, b[:n]...)
+	c.extensions, c.err = clientHelloExtensions(c.buf)
+	if c.err != errShortHello || len(c.buf) > maxHello {
+		c.done = true
+		c.buf = nil
+	}
+	return n, err
+}
+
+func (c *helloConn) hello() ([]uint16, error) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.done {
+		return nil, errShortHello
+	}
+	return c.extensions, c.err
+}
+
+type helloListener struct {
+	net.Listener
+}
+
+func (l helloListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &helloConn{Conn: conn}, nil
+}
+
+func helloConnContext(ctx context.Context, conn net.Conn) context.Context {
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return ctx
+	}
+	hc, ok := tc.NetConn().(*helloConn)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, helloKey{}, hc)
+}
+
+// clientHelloExtensions returns extension types of the ClientHello in the
+// order they were sent. Handshake message may span several TLS records.
+func clientHelloExtensions(raw []byte) ([]uint16, error) {
+	var msg []byte
+	for len(raw) > 0 {
+		if len(raw) < 5 {
+			return nil, errShortHello
+		}
+		if raw[0] != 0x16 {
+			return nil, fmt.Errorf("not a handshake record: %d", raw[0])
+		}
+		size := int(binary.BigEndian.Uint16(raw[3:5]))
+		if len(raw) < 5+size {
+			return nil, errShortHello
+		}
+		msg = append(msg, raw[5:5+size]...)
+		raw = raw[5+size:]
+		if len(msg) >= 4 && len(msg) >= 4+handshakeSize(msg) {
+			break
+		}
+	}
+	if len(msg) < 4 {
+		return nil, errShortHello
+	}
+	if msg[0] != 1 {
+		return nil, fmt.Errorf("not a client hello: %d", msg[0])
+	}
+	size := handshakeSize(msg)
+	if len(msg) < 4+size {
+		return nil, errShortHello
+	}
+	hello := msg[4 : 4+size]
+	// version and random
+	skip := 2 + 32
+	for _, width := range []int{1, 2, 1} {
+		// session id, cipher suites, and compression methods
+		if len(hello) < skip+width {
+			return nil, fmt.Errorf("malformed client hello")
+		}
+		n := 0
+		for _, b := range hello[skip : skip+width] {
+			n = n<<8 | int(b)
+		}
+		skip += width + n
+	}
+	if len(hello) == skip {
+		// no extensions at all
+		return nil, nil
+	}
+	if len(hello) < skip+2 {
+		return nil, fmt.Errorf("malformed client hello")
+	}
+	exts := hello[skip+2:]
+	if len(exts) != int(binary.BigEndian.Uint16(hello[skip:])) {
+		return nil, fmt.Errorf("malformed client hello")
+	}
+	var out []uint16
+	for len(exts) > 0 {
+		if len(exts) < 4 {
+			return nil, fmt.Errorf("malformed client hello")
+		}
+		size := int(binary.BigEndian.Uint16(exts[2:4]))
+		if len(exts) < 4+size {
+			return nil, fmt.Errorf("malformed client hello")
+		}
+		out = append(out, binary.BigEndian.Uint16(exts))
+		exts = exts[4+size:]
+	}
+	return out, nil
+}
+
+func handshakeSize(msg []byte) int {
+	return int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+}
+
+func formatExtensions(extensions []uint16) string {
+	var out []string
+	for _, v := range extensions {
+		out = append(out, strconv.Itoa(int(v)))
+	}
+	return strings.Join(out, ",")
+}
+
+// extensions reports comma-separated types of TLS extensions, that the judge
+// has seen in the ClientHello of this connection
+func (j *Judge) extensions(rw http.ResponseWriter, r *http.Request) {
+	hc, ok := r.Context().Value(helloKey{}).(*helloConn)
+	if !ok {
+		rw.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	extensions, err := hc.hello()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(rw, formatExtensions(extensions))
+}
+
+// judgeCertificate loads the certificate of TLS listener or generates
+// a self-signed one, as probes never verify it
+func judgeCertificate(certFile, keyFile string) (tls.Certificate, error) {
+	if certFile != "" || keyFile != "" {
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "slrp judge"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
@@ -0,0 +1,126 @@
+package checker
+
+import (
+	"crypto/x509"
+	"net/http"
+	"time"
+)
+
+// judgeOptions are configured for every judge of every strategy
+type judgeOptions struct {
+	interval         time.Duration
+	ratelimitHeaders bool
+	headFirst        bool
+	// contentTypes are expected media types by judge page
+	contentTypes map[string]string
+	// logins are requests for session cookies by judge page
+	logins map[string]judgeLogin
+	// identities are pinned certificate names by judge page
+	identities map[string]string
+	// hours are recorded only for hourly selection
+	hours *hourlyLatency
+	// trust are quorum weights by judge page
+	trust map[string]int
+	// regions are locations of judges by page
+	regions map[string]string
+	policy  AnonymityPolicy
+	alpn    *alpn
+	metrics *metrics
+	dead    *deadJudges
+	// roots verify judge certificates through proxies
+	roots *x509.CertPool
+	// ip is this IP, that judges must not report
+	ip string
+}
+
+// configureJudges copies every judge of every strategy, so that in-flight
+// checks keep the previous ones. Judges get the client with configured
+// timeout and share a pacer between all strategies using the same page.
+func (cfg *checkerConfig) configureJudges(original *http.Client, opts judgeOptions) {
+	pacers := map[string]*pacer{}
+	sessions := map[string]*session{}
+	for name, strategy := range cfg.strategies {
+		cfg.strategies[name] = mapJudges(strategy, func(s *simple) *simple {
+			judge := *s
+			if original != nil && s.client == httpClient(original) {
+				judge.client = cfg.client
+			}
+			p, ok := pacers[s.page]
+			if !ok {
+				p = newPacer(opts.interval, opts.ratelimitHeaders)
+				pacers[s.page] = p
+			}
+			judge.pacer = p
+			judge.headFirst = opts.headFirst
+			judge.contentType = opts.contentTypes[s.page]
+			judge.identity = opts.identities[s.page]
+			judge.hours = opts.hours
+			judge.trust = opts.trust[s.page]
+			judge.region = opts.regions[s.page]
+			judge.policy = opts.policy
+			judge.alpn = opts.alpn
+			judge.metrics = opts.metrics
+			judge.dead = opts.dead
+			judge.roots = opts.roots
+			judge.ip = opts.ip
+			login, ok := opts.logins[s.page]
+			if ok {
+				if sessions[s.page] == nil {
+					sessions[s.page] = newSession(cfg.direct, login)
+				}
+				judge.session = sessions[s.page]
+			}
+			return &judge
+		})
+	}
+}
+
+// mapJudges rebuilds the strategy with judges replaced by cb
+func mapJudges(c Checker, cb func(*simple) *simple) Checker {
+	switch x := c.(type) {
+	case federated:
+		judges := make([]*simple, len(x.judges))
+		for i, s := range x.judges {
+			judges[i] = cb(s)
+		}
+		x.judges = judges
+		return x
+	case twoPass:
+		x.first = mapJudges(x.first, cb).(federated)
+		x.second = mapJudges(x.second, cb).(federated)
+		return x
+	case regional:
+		out := regional{}
+		for k, f := range x {
+			out[k] = mapJudges(f, cb).(federated)
+		}
+		return out
+	case quorum:
+		judges := make([]*simple, len(x.judges))
+		for i, s := range x.judges {
+			judges[i] = cb(s)
+		}
+		return quorum{judges}
+	case coverage:
+		out := make(coverage, len(x))
+		for i, v := range x {
+			out[i] = coveredBy{v.capability, mapJudges(v.judges, cb).(federated)}
+		}
+		return out
+	case golden:
+		x.golden = mapJudges(x.golden, cb).(federated)
+		x.public = mapJudges(x.public, cb)
+		return x
+	default:
+		return c
+	}
+}
+
+func (cfg *checkerConfig) eachJudge(cb func(*simple)) {
+	for _, strategy := range cfg.strategies {
+		mapJudges(strategy, func(s *simple) *simple {
+			cb(s)
+			return s
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package checker
+
+import (
+	"context"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+type labelsKey struct{}
+
+// CheckRequest is the proxy to check along with opaque labels, like batch
+// ID or source, that come back untouched in the CheckResult
+type CheckRequest struct {
+	Proxy  pmux.Proxy
+	Labels map[string]string
+}
+
+// WithLabels attaches labels to checks with the context, so that they are
+// echoed in results of Result, CheckStream, and stored results of Check
+func WithLabels(ctx context.Context, labels map[string]string) context.Context {
+	return context.WithValue(ctx, labelsKey{}, labels)
+}
+
+func labelsFrom(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsKey{}).(map[string]string)
+	return labels
+}
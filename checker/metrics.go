@@ -0,0 +1,178 @@
+package checker
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// recentResults is how many of the latest verdicts Metrics counts
+const recentResults = 1000
+
+// Metrics is the snapshot of judge health and check outcomes, so that
+// the dashboard renders from a single call
+type Metrics struct {
+	Readiness Readiness
+	// InFlight is the number of checks running right now
+	InFlight   int
+	Judges     []JudgeMetrics
+	Strategies map[string]StrategyMetrics
+	// Recent counts the latest verdicts by Anonymous, Transparent,
+	// "temporary", and "failed"
+	Recent map[string]int
+}
+
+// JudgeMetrics is the health of the judge in requests through proxies and
+// direct probes, where failures through proxies are mostly due to proxies
+type JudgeMetrics struct {
+	Page      string
+	Requests  int
+	Failures  int
+	ErrorRate float64
+	// Latency is the mean of successful requests
+	Latency   time.Duration
+	LastError string `json:",omitempty"`
+	// Reachable is the verdict of the latest direct probe
+	Reachable bool
+}
+
+type StrategyMetrics struct {
+	Checks      int
+	Passed      int
+	SuccessRate float64
+}
+
+// metrics aggregates stats, that are not kept anywhere else
+type metrics struct {
+	sync.Mutex
+	inFlight   int64
+	judges     map[string]*JudgeMetrics
+	strategies map[string]*StrategyMetrics
+	recent     [recentResults]byte
+	results    int
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		judges:     map[string]*JudgeMetrics{},
+		strategies: map[string]*StrategyMetrics{},
+	}
+}
+
+// started counts the check as in flight until the returned func is called
+func (m *metrics) started() func() {
+	if m == nil {
+		return func() {}
+	}
+	atomic.AddInt64(&m.inFlight, 1)
+	return func() {
+		atomic.AddInt64(&m.inFlight, -1)
+	}
+}
+
+// judge is keyed by the redacted page, as metrics are exposed to the UI
+func (m *metrics) judge(page string) *JudgeMetrics {
+	page = redact(page)
+	j, ok := m.judges[page]
+	if !ok {
+		j = &JudgeMetrics{Page: page}
+		m.judges[page] = j
+	}
+	return j
+}
+
+func (m *metrics) request(page string, took time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	j := m.judge(page)
+	j.Requests++
+	if err != nil {
+		j.Failures++
+		j.LastError = redactErr(err).Error()
+	} else {
+		passed := j.Requests - j.Failures
+		j.Latency += (took - j.Latency) / time.Duration(passed)
+	}
+	j.ErrorRate = float64(j.Failures) / float64(j.Requests)
+}
+
+func (m *metrics) probed(page string, err error) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.judge(page).Reachable = err == nil
+}
+
+func (m *metrics) strategy(name string, ok bool) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	s, found := m.strategies[name]
+	if !found {
+		s = &StrategyMetrics{}
+		m.strategies[name] = s
+	}
+	s.Checks++
+	if ok {
+		s.Passed++
+	}
+	s.SuccessRate = float64(s.Passed) / float64(s.Checks)
+}
+
+func (m *metrics) result(err error) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.recent[m.results%recentResults] = anonymityLevel(err)
+	m.results++
+}
+
+func (m *metrics) snapshot() Metrics {
+	out := Metrics{
+		Strategies: map[string]StrategyMetrics{},
+		Recent:     map[string]int{},
+	}
+	if m == nil {
+		return out
+	}
+	out.InFlight = int(atomic.LoadInt64(&m.inFlight))
+	m.Lock()
+	defer m.Unlock()
+	for _, j := range m.judges {
+		out.Judges = append(out.Judges, *j)
+	}
+	sort.Slice(out.Judges, func(i, j int) bool {
+		return out.Judges[i].Page < out.Judges[j].Page
+	})
+	for name, s := range m.strategies {
+		out.Strategies[name] = *s
+	}
+	n := m.results
+	if n > recentResults {
+		n = recentResults
+	}
+	for _, level := range m.recent[:n] {
+		out.Recent[outcomeNames[level]]++
+	}
+	return out
+}
+
+// Metrics returns the snapshot of judge health, strategy success rates,
+// checks in flight, and the latest verdicts
+func (cc *configurableChecker) Metrics() Metrics {
+	out := cc.metrics.snapshot()
+	if cc.readiness != nil {
+		out.Readiness = cc.Readiness()
+	}
+	return out
+}
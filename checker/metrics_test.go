@@ -0,0 +1,95 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics()
+	m.request("https://a/ip", 100*time.Millisecond, nil)
+	m.request("https://a/ip", 300*time.Millisecond, nil)
+	m.request("https://a/ip", time.Second, fmt.Errorf("nope"))
+	m.probed("https://b/ip", nil)
+	m.strategy("simple", true)
+	m.strategy("simple", false)
+	for _, err := range []error{nil, nil, ErrNotAnonymous, errCloudFlare, fmt.Errorf("dead")} {
+		m.result(err)
+	}
+	done := m.started()
+	snapshot := m.snapshot()
+	done()
+	assert.Equal(t, Metrics{
+		InFlight: 1,
+		Judges: []JudgeMetrics{
+			{
+				Page:      "https://a/ip",
+				Requests:  3,
+				Failures:  1,
+				ErrorRate: 1.0 / 3,
+				Latency:   200 * time.Millisecond,
+				LastError: "nope",
+			},
+			{
+				Page:      "https://b/ip",
+				Reachable: true,
+			},
+		},
+		Strategies: map[string]StrategyMetrics{
+			"simple": {Checks: 2, Passed: 1, SuccessRate: 0.5},
+		},
+		Recent: map[string]int{
+			Anonymous:   2,
+			Transparent: 1,
+			"temporary": 1,
+			"failed":    1,
+		},
+	}, snapshot)
+	assert.Equal(t, 0, m.snapshot().InFlight)
+}
+
+func TestMetricsKeepRecentResults(t *testing.T) {
+	m := newMetrics()
+	m.result(fmt.Errorf("dead"))
+	for i := 0; i < recentResults; i++ {
+		m.result(nil)
+	}
+	assert.Equal(t, map[string]int{Anonymous: recentResults}, m.snapshot().Recent)
+}
+
+func TestCheckRecordsMetrics(t *testing.T) {
+	metrics := newMetrics()
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip:   "5.6.7.8",
+				page: "https://judge/ip",
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						Body:       body("1.2.3.4"),
+					}, nil
+				}),
+				metrics: metrics,
+			},
+		},
+		readiness: &readiness{},
+		metrics:   metrics,
+	}
+	cc.use(checkerConfig{})
+	_, err := cc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+	assert.NoError(t, err)
+	raw, err := cc.HttpGetByID("metrics", nil)
+	assert.NoError(t, err)
+	m := raw.(Metrics)
+	assert.Equal(t, 1, m.Judges[0].Requests)
+	assert.Equal(t, StrategyMetrics{Checks: 1, Passed: 1, SuccessRate: 1}, m.Strategies["simple"])
+	assert.Equal(t, map[string]int{Anonymous: 1}, m.Recent)
+	assert.False(t, m.Readiness.Ready)
+}
@@ -0,0 +1,276 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+type ckey int
+
+const (
+	observationKey ckey = iota
+	budgetKey
+)
+
+// observation collects what strategies have seen during a single check,
+// so that the outcome could be reported in the CheckResult
+type observation struct {
+	sync.Mutex
+	exits    []string
+	regions  map[string]time.Duration
+	rotating bool
+	tracing  bool
+	events   []TraceEvent
+	counters checkCounters
+	// connect is the response to CONNECT of the latest tunnel
+	connect http.Header
+	// judges are pages of judges, that the proxy has passed
+	judges []string
+	// protocol is the ALPN protocol, that the latest judge has negotiated
+	protocol string
+	// tcp is what the fingerprint judge has seen
+	tcp *TCPFingerprint
+}
+
+// checkCounters is how much judge traffic the check has cost
+type checkCounters struct {
+	attempts    int
+	rateLimited int
+	retries     int
+	// captchas are responses with anti-bot challenges
+	captchas int
+}
+
+func (c *checkCounters) add(other checkCounters) {
+	c.attempts += other.attempts
+	c.rateLimited += other.rateLimited
+	c.retries += other.retries
+	c.captchas += other.captchas
+}
+
+// observe makes sure there's an observation for the check in the context
+func observe(ctx context.Context) (context.Context, *observation) {
+	o := observed(ctx)
+	if o != nil {
+		return ctx, o
+	}
+	o = &observation{}
+	return o.attach(ctx), o
+}
+
+// attach puts the observation into the context along with the dial trace,
+// that records CONNECT responses of tunnels to judges
+func (o *observation) attach(ctx context.Context) context.Context {
+	ctx = pmux.WithDialTrace(ctx, &pmux.DialTrace{
+		Connected: o.connected,
+	})
+	return context.WithValue(ctx, observationKey, o)
+}
+
+// detach starts a separate observation, e.g. for a single pass of twopass
+// strategy, that has to be merged into the parent one afterwards
+func detach(ctx context.Context) (context.Context, *observation) {
+	o := &observation{tracing: observed(ctx).isTracing()}
+	return o.attach(ctx), o
+}
+
+func (o *observation) merge(other *observation) {
+	if o == nil {
+		return
+	}
+	for _, v := range other.exitIPs() {
+		o.exit(v)
+	}
+	for k, v := range other.latencies() {
+		o.latency(k, v)
+	}
+	for _, e := range other.timeline() {
+		o.event(e)
+	}
+	o.count(other.spent())
+	for _, page := range other.passedJudges() {
+		o.passed(page)
+	}
+	h := other.connectHeaders()
+	if h != nil {
+		o.connected(h)
+	}
+	protocol := other.negotiatedProtocol()
+	if protocol != "" {
+		o.negotiated(protocol)
+	}
+	tcp := other.tcpFingerprint()
+	if tcp != nil {
+		o.fingerprinted(*tcp)
+	}
+}
+
+// observed returns nil, if the check is not observed
+func observed(ctx context.Context) *observation {
+	o, _ := ctx.Value(observationKey).(*observation)
+	return o
+}
+
+func (o *observation) exit(ip string) {
+	if o == nil || ip == "" {
+		return
+	}
+	o.Lock()
+	defer o.Unlock()
+	for _, v := range o.exits {
+		if v == ip {
+			return
+		}
+	}
+	o.exits = append(o.exits, ip)
+}
+
+func (o *observation) exitIPs() []string {
+	o.Lock()
+	defer o.Unlock()
+	return append([]string{}, o.exits...)
+}
+
+func (o *observation) rotatingExit() {
+	if o == nil {
+		return
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.rotating = true
+}
+
+func (o *observation) isRotating() bool {
+	o.Lock()
+	defer o.Unlock()
+	return o.rotating
+}
+
+func (o *observation) latency(region string, t time.Duration) {
+	if o == nil {
+		return
+	}
+	o.Lock()
+	defer o.Unlock()
+	if o.regions == nil {
+		o.regions = map[string]time.Duration{}
+	}
+	o.regions[region] = t
+}
+
+func (o *observation) latencies() map[string]time.Duration {
+	o.Lock()
+	defer o.Unlock()
+	if o.regions == nil {
+		return nil
+	}
+	out := map[string]time.Duration{}
+	for k, v := range o.regions {
+		out[k] = v
+	}
+	return out
+}
+
+func (o *observation) count(c checkCounters) {
+	if o == nil {
+		return
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.counters.add(c)
+}
+
+func (o *observation) spent() checkCounters {
+	o.Lock()
+	defer o.Unlock()
+	return o.counters
+}
+
+func (o *observation) passed(page string) {
+	if o == nil {
+		return
+	}
+	o.Lock()
+	defer o.Unlock()
+	for _, v := range o.judges {
+		if v == page {
+			return
+		}
+	}
+	o.judges = append(o.judges, page)
+}
+
+func (o *observation) passedJudges() []string {
+	o.Lock()
+	defer o.Unlock()
+	return append([]string{}, o.judges...)
+}
+
+func (o *observation) connected(h http.Header) {
+	if o == nil {
+		return
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.connect = h.Clone()
+}
+
+func (o *observation) connectHeaders() http.Header {
+	o.Lock()
+	defer o.Unlock()
+	return o.connect.Clone()
+}
+
+var anyIPRegex = regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}\b`)
+
+// reportedIPs finds distinct IP addresses, that judge has reported in the
+// body, where the ones on their own line go first
+func reportedIPs(body string) (out []string) {
+	seen := map[string]bool{}
+	found := append(ipRegex.FindAllString(body, -1), anyIPRegex.FindAllString(body, -1)...)
+	for _, ip := range found {
+		ip = strings.TrimSpace(ip)
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		out = append(out, ip)
+	}
+	return out
+}
+
+func (o *observation) negotiated(protocol string) {
+	if o == nil {
+		return
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.protocol = protocol
+}
+
+func (o *observation) negotiatedProtocol() string {
+	o.Lock()
+	defer o.Unlock()
+	return o.protocol
+}
+
+func (o *observation) fingerprinted(f TCPFingerprint) {
+	if o == nil {
+		return
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.tcp = &f
+}
+
+func (o *observation) tcpFingerprint() *TCPFingerprint {
+	o.Lock()
+	defer o.Unlock()
+	return o.tcp
+}
@@ -0,0 +1,89 @@
+package checker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"time"
+)
+
+// known levels of anonymity in check results
+const (
+	Anonymous   = "anonymous"
+	Transparent = "transparent"
+)
+
+// levels of anonymity in outcome fingerprints
+const (
+	outcomeAnonymous byte = iota
+	outcomeTransparent
+	outcomeTemporary
+	outcomeFailed
+)
+
+// outcomeNames are how levels are reported in metrics and summaries
+var outcomeNames = map[byte]string{
+	outcomeAnonymous:   Anonymous,
+	outcomeTransparent: Transparent,
+	outcomeTemporary:   "temporary",
+	outcomeFailed:      "failed",
+}
+
+// outcomeFingerprint is a stable hash of what's meaningful in the check
+// outcome, so that proxies, whose behavior has shifted between sweeps, are
+// found by comparing a single value. Exact exit IPs and latencies change
+// all the time, so only their subnets and rough buckets are included.
+func outcomeFingerprint(r CheckResult) string {
+	var flags byte
+	for i, v := range []bool{r.DirectExit, r.Rotating, r.AltersEncoding, r.AltersTLSExtensions} {
+		if v {
+			flags |= 1 << i
+		}
+	}
+	buf := make([]byte, 7)
+	buf[0] = anonymityLevel(r.Err)
+	buf[1] = flags
+	buf[2] = latencyBucket(r.Speed)
+	binary.BigEndian.PutUint32(buf[3:], uint32(r.Capabilities))
+	buf = append(buf, exitSubnet(r.ExitIP)...)
+	h := fnv.New64a()
+	h.Write(buf)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func anonymityLevel(err error) byte {
+	switch {
+	case err == nil:
+		return outcomeAnonymous
+	case errors.Is(err, ErrNotAnonymous):
+		return outcomeTransparent
+	case isTimeout(err):
+		return outcomeTemporary
+	default:
+		return outcomeFailed
+	}
+}
+
+// latencyBucket doubles from 250ms, so that jitter rarely changes it
+func latencyBucket(speed time.Duration) byte {
+	var bucket byte
+	for limit := 250 * time.Millisecond; speed >= limit && bucket < 8; limit *= 2 {
+		bucket++
+	}
+	return bucket
+}
+
+// exitSubnet is /24 for IPv4 and /48 for IPv6 exits
+func exitSubnet(ip string) []byte {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil
+	}
+	v4 := parsed.To4()
+	if v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32))
+	}
+	return parsed.Mask(net.CIDRMask(48, 128))
+}
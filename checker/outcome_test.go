@@ -0,0 +1,74 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutcomeFingerprint(t *testing.T) {
+	base := CheckResult{
+		Speed:        300 * time.Millisecond,
+		ExitIP:       "1.2.3.4",
+		Capabilities: Chunked,
+	}
+	same := base
+	same.Speed = 400 * time.Millisecond
+	same.ExitIP = "1.2.3.200"
+	same.Proxy = pmux.HttpProxy("127.0.0.1:1")
+	same.Confidence = 0.5
+	assert.Equal(t, outcomeFingerprint(base), outcomeFingerprint(same))
+	assert.Len(t, outcomeFingerprint(base), 16)
+
+	for i, shift := range []func(r *CheckResult){
+		func(r *CheckResult) { r.Speed = 2 * time.Second },
+		func(r *CheckResult) { r.ExitIP = "1.2.4.4" },
+		func(r *CheckResult) { r.Capabilities |= Streaming },
+		func(r *CheckResult) { r.Rotating = true },
+		func(r *CheckResult) { r.Err = ErrNotAnonymous },
+		func(r *CheckResult) { r.Err = fmt.Errorf("first: %w", errCloudFlare) },
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			shifted := base
+			shift(&shifted)
+			assert.NotEqual(t, outcomeFingerprint(base), outcomeFingerprint(shifted))
+		})
+	}
+}
+
+func TestLatencyBucket(t *testing.T) {
+	assert.Equal(t, byte(0), latencyBucket(100*time.Millisecond))
+	assert.Equal(t, byte(1), latencyBucket(250*time.Millisecond))
+	assert.Equal(t, byte(3), latencyBucket(time.Second))
+	assert.Equal(t, byte(8), latencyBucket(time.Hour))
+}
+
+func TestExitSubnet(t *testing.T) {
+	assert.Equal(t, []byte{1, 2, 3, 0}, exitSubnet("1.2.3.4"))
+	assert.Equal(t, exitSubnet("2001:db8:1::1"), exitSubnet("2001:db8:1:ffff::2"))
+	assert.Nil(t, exitSubnet(""))
+}
+
+func TestResultOutcome(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip:     "255.0.0.1",
+				page:   "http://judge.local/ip",
+				client: client,
+			},
+		},
+	}
+	r := cc.Result(context.Background(), proxy)
+	assert.Empty(t, r.Outcome)
+
+	cc.use(checkerConfig{outcomeFingerprint: true})
+	r = cc.Result(context.Background(), proxy)
+	assert.True(t, r.Ok(), r.Failure)
+	assert.Equal(t, outcomeFingerprint(r), r.Outcome)
+}
@@ -0,0 +1,110 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// window of the latest passed checks, that the median is taken from
+const latencyWindow = 256
+
+var errSlowOutlier = temporary("slow outlier")
+
+// slowOutlier is the check cancelled well before the timeout, as it has
+// taken much longer, than the typical passed check at the moment
+type slowOutlier struct {
+	limit time.Duration
+}
+
+func (e slowOutlier) Error() string {
+	return fmt.Sprintf("%s: cancelled after %s", errSlowOutlier, e.limit)
+}
+
+func (e slowOutlier) Is(target error) bool {
+	return target == errSlowOutlier
+}
+
+// Temporary gets slow-but-working proxies re-checked later
+func (e slowOutlier) Temporary() bool {
+	return true
+}
+
+var errImplausiblyFast = fmt.Errorf("implausibly fast")
+
+// implausiblyFast is the check, that has passed faster than any remote judge
+// could be reached, which means something local has answered instead
+type implausiblyFast struct {
+	took  time.Duration
+	floor time.Duration
+}
+
+func (e implausiblyFast) Error() string {
+	return fmt.Sprintf("%s: took %s, expected at least %s", errImplausiblyFast, e.took, e.floor)
+}
+
+func (e implausiblyFast) Is(target error) bool {
+	return target == errImplausiblyFast
+}
+
+// latencies is the running distribution of speeds of passed checks
+type latencies struct {
+	sync.Mutex
+	ring []time.Duration
+	next int
+}
+
+func newLatencies() *latencies {
+	return &latencies{}
+}
+
+func (l *latencies) record(speed time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.ring) < latencyWindow {
+		l.ring = append(l.ring, speed)
+		return
+	}
+	l.ring[l.next] = speed
+	l.next = (l.next + 1) % latencyWindow
+}
+
+// median is zero until there are enough samples to trust it
+func (l *latencies) median(samples int) time.Duration {
+	l.Lock()
+	if len(l.ring) == 0 || len(l.ring) < samples {
+		l.Unlock()
+		return 0
+	}
+	sorted := append([]time.Duration{}, l.ring...)
+	l.Unlock()
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted[len(sorted)/2]
+}
+
+// bound cancels the check, that runs longer than factor times the median
+func (l *latencies) bound(ctx context.Context, factor, samples int) (context.Context, func(error) error) {
+	median := l.median(samples)
+	if factor <= 0 || median == 0 {
+		return ctx, func(err error) error {
+			return err
+		}
+	}
+	limit := time.Duration(factor) * median
+	bounded, cancel := context.WithTimeout(ctx, limit)
+	return bounded, func(err error) error {
+		defer cancel()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if errors.Is(bounded.Err(), context.DeadlineExceeded) {
+			return slowOutlier{limit}
+		}
+		return err
+	}
+}
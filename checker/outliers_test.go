@@ -0,0 +1,84 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatenciesMedian(t *testing.T) {
+	l := newLatencies()
+	assert.Equal(t, time.Duration(0), l.median(1))
+	for i := 1; i <= latencyWindow+10; i++ {
+		l.record(time.Duration(i) * time.Millisecond)
+	}
+	assert.Len(t, l.ring, latencyWindow)
+	// oldest samples are evicted
+	assert.Equal(t, 139*time.Millisecond, l.median(20))
+	assert.Equal(t, time.Duration(0), l.median(latencyWindow+1))
+}
+
+func TestSlowOutliersAreCancelled(t *testing.T) {
+	slow := pmux.HttpProxy("127.0.0.1:2")
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				if proxy != slow {
+					return 10 * time.Millisecond, nil
+				}
+				select {
+				case <-ctx.Done():
+					return 0, fmt.Errorf("first: %w", ctx.Err())
+				case <-time.After(5 * time.Second):
+					return 5 * time.Second, nil
+				}
+			}),
+		},
+		latencies: newLatencies(),
+	}
+	cc.use(checkerConfig{
+		outlierFactor:  3,
+		outlierSamples: 5,
+	})
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_, err := cc.Check(ctx, pmux.HttpProxy("127.0.0.1:1"))
+		assert.NoError(t, err)
+	}
+	start := time.Now()
+	_, err := cc.Check(ctx, slow)
+	assert.EqualError(t, err, "slow outlier: cancelled after 30ms")
+	assert.True(t, errors.Is(err, errSlowOutlier))
+	assert.True(t, isTimeout(err))
+	assert.Less(t, time.Since(start), time.Second)
+
+	// cancellations by the caller are not outliers
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = cc.Check(ctx, slow)
+	assert.EqualError(t, err, "first: context canceled")
+}
+
+func TestImplausiblyFast(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				return time.Duration(proxy.Port()) * time.Millisecond, nil
+			}),
+		},
+	}
+	cc.use(checkerConfig{minLatency: 5 * time.Millisecond})
+	ctx := context.Background()
+	_, err := cc.Check(ctx, pmux.HttpProxy("127.0.0.1:1"))
+	assert.EqualError(t, err, "implausibly fast: took 1ms, expected at least 5ms")
+	assert.True(t, errors.Is(err, errImplausiblyFast))
+	assert.False(t, isTimeout(err))
+
+	_, err = cc.Check(ctx, pmux.HttpProxy("127.0.0.1:20"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,215 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// pacUtils are the pure functions, that PAC files expect from the browser
+const pacUtils = `
+function isPlainHostName(host) {
+	return host.indexOf('.') === -1;
+}
+function dnsDomainIs(host, domain) {
+	return host.length >= domain.length &&
+		host.substring(host.length - domain.length) === domain;
+}
+function localHostOrDomainIs(host, hostdom) {
+	return host === hostdom ||
+		(host.indexOf('.') === -1 && hostdom.indexOf(host + '.') === 0);
+}
+function dnsDomainLevels(host) {
+	return host.split('.').length - 1;
+}
+function shExpMatch(str, exp) {
+	exp = exp.replace(/[.+^${}()|[\]\\]/g, '\\$&')
+		.replace(/\*/g, '.*')
+		.replace(/\?/g, '.');
+	return new RegExp('^' + exp + '$').test(str);
+}`
+
+// pac routes direct calls, like judge validation or reputation lookups,
+// through the upstream proxy, that proxy auto-config script picks for the
+// destination. Checks of candidate proxies never use it.
+type pac struct {
+	sync.Mutex
+	vm          *goja.Runtime
+	find        goja.Callable
+	credentials *url.Userinfo
+}
+
+func configurePAC(ctx context.Context, client httpClient, location, credentials string) (*pac, error) {
+	script, err := loadPAC(ctx, client, location)
+	if err != nil {
+		return nil, fmt.Errorf("pac: %w", err)
+	}
+	p, err := newPAC(script)
+	if err != nil {
+		return nil, fmt.Errorf("pac: %w", err)
+	}
+	if credentials != "" {
+		split := strings.SplitN(credentials, ":", 2)
+		if len(split) != 2 {
+			return nil, fmt.Errorf("pac_credentials must be user:password")
+		}
+		p.credentials = url.UserPassword(split[0], split[1])
+	}
+	return p, nil
+}
+
+func loadPAC(ctx context.Context, client httpClient, location string) (string, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		raw, err := os.ReadFile(location)
+		return string(raw), err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("status %d", res.StatusCode)
+	}
+	return string(raw), nil
+}
+
+func newPAC(script string) (*pac, error) {
+	vm := goja.New()
+	vm.Set("dnsResolve", func(host string) goja.Value {
+		ip := resolveIPv4(host)
+		if ip == "" {
+			return goja.Null()
+		}
+		return vm.ToValue(ip)
+	})
+	vm.Set("isResolvable", func(host string) bool {
+		return resolveIPv4(host) != ""
+	})
+	vm.Set("isInNet", func(host, pattern, mask string) bool {
+		ip := net.ParseIP(resolveIPv4(host)).To4()
+		network := net.ParseIP(pattern).To4()
+		m := net.ParseIP(mask).To4()
+		if ip == nil || network == nil || m == nil {
+			return false
+		}
+		return ip.Mask(net.IPMask(m)).Equal(network.Mask(net.IPMask(m)))
+	})
+	vm.Set("myIpAddress", func() string {
+		// nothing is sent over UDP, but it reveals the outbound interface
+		conn, err := net.Dial("udp", "192.0.2.1:80")
+		if err != nil {
+			return "127.0.0.1"
+		}
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).IP.String()
+	})
+	_, err := vm.RunString(pacUtils)
+	if err != nil {
+		return nil, err
+	}
+	_, err = vm.RunString(script)
+	if err != nil {
+		return nil, err
+	}
+	find, ok := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	if !ok {
+		return nil, fmt.Errorf("no FindProxyForURL function")
+	}
+	return &pac{
+		vm:   vm,
+		find: find,
+	}, nil
+}
+
+func resolveIPv4(host string) string {
+	ip := net.ParseIP(host)
+	if ip != nil && ip.To4() != nil {
+		return ip.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		return ""
+	}
+	return ips[0].String()
+}
+
+// proxyFor is the http.Transport.Proxy, that returns nil for DIRECT
+func (p *pac) proxyFor(req *http.Request) (*url.URL, error) {
+	target := req.URL.String()
+	if req.URL.Scheme == "https" {
+		// browsers strip path and query of https destinations
+		target = fmt.Sprintf("https://%s/", req.URL.Host)
+	}
+	p.Lock()
+	v, err := p.find(goja.Undefined(), p.vm.ToValue(target), p.vm.ToValue(req.URL.Hostname()))
+	p.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("pac: %w", err)
+	}
+	return parsePACResult(v.String(), p.credentials)
+}
+
+// parsePACResult takes the first of "PROXY host:port; SOCKS host:port; DIRECT"
+func parsePACResult(result string, credentials *url.Userinfo) (*url.URL, error) {
+	first := strings.TrimSpace(strings.Split(result, ";")[0])
+	fields := strings.Fields(first)
+	if len(fields) == 0 || strings.ToUpper(fields[0]) == "DIRECT" {
+		return nil, nil
+	}
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("pac: invalid result: %s", first)
+	}
+	var scheme string
+	switch strings.ToUpper(fields[0]) {
+	case "PROXY", "HTTP":
+		scheme = "http"
+	case "HTTPS":
+		scheme = "https"
+	case "SOCKS", "SOCKS5":
+		scheme = "socks5"
+	default:
+		return nil, fmt.Errorf("pac: invalid result: %s", first)
+	}
+	return &url.URL{
+		Scheme: scheme,
+		Host:   fields[1],
+		User:   credentials,
+	}, nil
+}
+
+// directClient is for calls, that go to judges and APIs without proxies.
+// Without PAC they are made directly.
+func (p *pac) directClient(timeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	transport := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: timeout,
+	}
+	if p != nil {
+		transport.Proxy = p.proxyFor
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
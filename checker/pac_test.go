@@ -0,0 +1,121 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPAC = `function FindProxyForURL(url, host) {
+	if (isPlainHostName(host) || dnsDomainIs(host, ".corp.example.com")) {
+		return "DIRECT";
+	}
+	if (isInNet(host, "10.0.0.0", "255.0.0.0")) {
+		return "SOCKS 10.0.0.1:1080";
+	}
+	if (shExpMatch(url, "https://*.example.org/")) {
+		return "HTTPS secure.example.com:8443; DIRECT";
+	}
+	return "PROXY egress.example.com:3128; DIRECT";
+}`
+
+func TestPAC(t *testing.T) {
+	p, err := newPAC(testPAC)
+	assert.NoError(t, err)
+	p.credentials = url.UserPassword("a", "b")
+	for i, tt := range []struct {
+		page   string
+		expect string
+	}{
+		{"http://intranet/ip", ""},
+		{"https://judge.corp.example.com/ip", ""},
+		{"http://10.1.2.3/ip", "socks5://a:b@10.0.0.1:1080"},
+		{"https://api.example.org/v1?key=secret", "https://a:b@secure.example.com:8443"},
+		{"https://ifconfig.me/ip", "http://a:b@egress.example.com:3128"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.page, nil)
+			assert.NoError(t, err)
+			u, err := p.proxyFor(req)
+			assert.NoError(t, err)
+			if tt.expect == "" {
+				assert.Nil(t, u)
+				return
+			}
+			assert.Equal(t, tt.expect, u.String())
+		})
+	}
+}
+
+func TestParsePACResult(t *testing.T) {
+	for i, tt := range []struct {
+		result    string
+		expect    string
+		expectErr string
+	}{
+		{result: "", expect: ""},
+		{result: "DIRECT", expect: ""},
+		{result: "SOCKS5 1.2.3.4:1080", expect: "socks5://1.2.3.4:1080"},
+		{result: "PROXY", expectErr: "pac: invalid result: PROXY"},
+		{result: "QUIC 1.2.3.4:443", expectErr: "pac: invalid result: QUIC 1.2.3.4:443"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			u, err := parsePACResult(tt.result, nil)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.expect == "" {
+				assert.Nil(t, u)
+				return
+			}
+			assert.Equal(t, tt.expect, u.String())
+		})
+	}
+}
+
+func TestConfigurePAC(t *testing.T) {
+	ctx := context.Background()
+	_, err := newPAC("function nope() {}")
+	assert.EqualError(t, err, "no FindProxyForURL function")
+
+	path := filepath.Join(t.TempDir(), "proxy.pac")
+	assert.NoError(t, os.WriteFile(path, []byte(testPAC), 0o600))
+	_, err = configurePAC(ctx, http.DefaultClient, path, "nope")
+	assert.EqualError(t, err, "pac_credentials must be user:password")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(testPAC))
+	}))
+	defer srv.Close()
+
+	cc := configurableChecker{
+
+		ip:     "255.0.0.1",
+		client: &http.Client{},
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	err = cc.Configure(app.Config{"pac": srv.URL + "/proxy.pac"})
+	assert.NoError(t, err)
+	cfg := cc.current()
+	assert.NotEqual(t, cfg.client, cfg.direct, "candidates never use pac")
+	transport := cfg.direct.(*http.Client).Transport.(*http.Transport)
+	req, _ := http.NewRequest("GET", "https://ifconfig.me/ip", nil)
+	u, err := transport.Proxy(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://egress.example.com:3128", u.String())
+
+	err = cc.Configure(app.Config{"pac": filepath.Join(t.TempDir(), "nope.pac")})
+	assert.Error(t, err)
+}
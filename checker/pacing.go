@@ -0,0 +1,96 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errJudgePaced = temporary("judge is paced")
+
+// pacer spaces out requests to a single judge, so that public judges are not
+// hammered. It slows down on IETF draft RateLimit-* headers before the judge
+// outright blocks us.
+type pacer struct {
+	sync.Mutex
+	interval time.Duration
+	headers  bool
+	next     time.Time
+	now      func() time.Time
+}
+
+func newPacer(interval time.Duration, headers bool) *pacer {
+	return &pacer{
+		interval: interval,
+		headers:  headers,
+		now:      time.Now,
+	}
+}
+
+// wait reserves the next slot for the judge and sleeps until it comes. Checks
+// that cannot get the slot before the deadline are retried later.
+func (p *pacer) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.Lock()
+	now := p.now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	deadline, ok := ctx.Deadline()
+	if ok && at.After(deadline) {
+		p.Unlock()
+		return errJudgePaced
+	}
+	p.next = at.Add(p.interval)
+	p.Unlock()
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// observe spreads the remaining quota evenly over the reset window
+func (p *pacer) observe(h http.Header) {
+	if p == nil || !p.headers {
+		return
+	}
+	remaining, err := strconv.Atoi(strings.TrimSpace(h.Get("RateLimit-Remaining")))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.Atoi(strings.TrimSpace(h.Get("RateLimit-Reset")))
+	if err != nil || reset < 0 {
+		return
+	}
+	window := time.Duration(reset) * time.Second
+	p.Lock()
+	defer p.Unlock()
+	now := p.now()
+	var at time.Time
+	if remaining <= 0 {
+		at = now.Add(window)
+	} else {
+		spread := window / time.Duration(remaining)
+		if spread <= p.interval {
+			return
+		}
+		at = now.Add(spread)
+	}
+	if at.After(p.next) {
+		p.next = at
+	}
+}
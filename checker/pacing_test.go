@@ -0,0 +1,87 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacerObservesRateLimitHeaders(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, tt := range []struct {
+		remaining, reset string
+		headers          bool
+		expect           time.Duration
+	}{
+		{"0", "30", true, 30 * time.Second},
+		{"10", "20", true, 2 * time.Second},
+		{"100", "10", true, 0},
+		{"0", "30", false, 0},
+		{"", "30", true, 0},
+		{"1", "abc", true, 0},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			p := newPacer(time.Second, tt.headers)
+			p.now = func() time.Time {
+				return now
+			}
+			p.observe(http.Header{
+				"Ratelimit-Remaining": {tt.remaining},
+				"Ratelimit-Reset":     {tt.reset},
+			})
+			if tt.expect == 0 {
+				assert.True(t, p.next.IsZero())
+				return
+			}
+			assert.Equal(t, now.Add(tt.expect), p.next)
+		})
+	}
+}
+
+func TestPacerWait(t *testing.T) {
+	p := newPacer(50*time.Millisecond, true)
+	ctx := context.Background()
+	start := time.Now()
+	assert.NoError(t, p.wait(ctx))
+	assert.NoError(t, p.wait(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	p.observe(http.Header{
+		"Ratelimit-Remaining": {"0"},
+		"Ratelimit-Reset":     {"60"},
+	})
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	assert.Equal(t, errJudgePaced, p.wait(ctx))
+}
+
+func TestConfigureSharesPacers(t *testing.T) {
+	cc := &configurableChecker{
+		ip:     "255.0.0.1",
+		client: &http.Client{},
+		strategies: map[string]Checker{
+			"twopass": newTwoPass("", nil),
+			"simple":  newFederated(ipOnly(), nil, ""),
+		},
+	}
+	err := cc.Configure(app.Config{
+		"judge_interval": "1s",
+	})
+	assert.NoError(t, err)
+	pacers := map[string]*pacer{}
+	cc.current().eachJudge(func(s *simple) {
+		assert.NotNil(t, s.pacer)
+		assert.Equal(t, time.Second, s.pacer.interval)
+		p, ok := pacers[s.page]
+		if ok {
+			assert.Same(t, p, s.pacer, s.page)
+		}
+		pacers[s.page] = s.pacer
+	})
+	assert.Len(t, pacers, len(judges()))
+}
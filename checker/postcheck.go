@@ -0,0 +1,95 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// PostCheck validates the proxy, that has passed built-in checks, in the
+// way specific to the application, e.g. by calling its API through the
+// proxy. The error fails the check, where temporary errors are retried.
+type PostCheck func(ctx context.Context, proxy pmux.Proxy, r CheckResult) error
+
+var errPostCheck = fmt.Errorf("post check failed")
+
+// postCheckFailed is the error of the hook, that demoted the passed proxy
+type postCheckFailed struct {
+	name string
+	err  error
+}
+
+func (e postCheckFailed) Error() string {
+	return fmt.Sprintf("%s: %s: %s", errPostCheck, e.name, e.err)
+}
+
+func (e postCheckFailed) Is(target error) bool {
+	return target == errPostCheck
+}
+
+func (e postCheckFailed) Unwrap() error {
+	return e.err
+}
+
+func (e postCheckFailed) Temporary() bool {
+	return isTimeout(e.err)
+}
+
+var postChecks = struct {
+	sync.Mutex
+	byName map[string]PostCheck
+}{
+	byName: map[string]PostCheck{},
+}
+
+// RegisterPostCheck makes the hook available for post_checks
+func RegisterPostCheck(name string, hook PostCheck) {
+	postChecks.Lock()
+	defer postChecks.Unlock()
+	postChecks.byName[name] = hook
+}
+
+type namedPostCheck struct {
+	name string
+	hook PostCheck
+}
+
+// configurePostChecks picks comma-separated registered hooks in the order,
+// that they have to run in
+func configurePostChecks(raw string) (out []namedPostCheck, err error) {
+	postChecks.Lock()
+	defer postChecks.Unlock()
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		hook, ok := postChecks.byName[name]
+		if !ok {
+			var known []string
+			for k := range postChecks.byName {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("invalid post check: %s, known: %s", name,
+				strings.Join(known, ", "))
+		}
+		out = append(out, namedPostCheck{name, hook})
+	}
+	return out, nil
+}
+
+// postCheck runs hooks on the passed result and returns the first error
+func (cfg *checkerConfig) postCheck(ctx context.Context, proxy pmux.Proxy, r CheckResult) error {
+	for _, v := range cfg.postChecks {
+		err := v.hook(ctx, proxy, r)
+		if err != nil {
+			return postCheckFailed{v.name, err}
+		}
+	}
+	return nil
+}
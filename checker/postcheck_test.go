@@ -0,0 +1,122 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostChecks(t *testing.T) {
+	var seen []string
+	RegisterPostCheck("api", func(ctx context.Context, proxy pmux.Proxy, r CheckResult) error {
+		seen = append(seen, "api:"+r.Anonymity)
+		if proxy.String() == "http://127.0.0.2:1" {
+			return fmt.Errorf("status 403")
+		}
+		if proxy.String() == "http://127.0.0.3:1" {
+			return temporary("api is slow")
+		}
+		return nil
+	})
+	RegisterPostCheck("after", func(ctx context.Context, proxy pmux.Proxy, r CheckResult) error {
+		seen = append(seen, "after")
+		return nil
+	})
+	for i, tt := range []struct {
+		proxy     string
+		strategy  error
+		seen      []string
+		expectErr string
+		temporary bool
+		anonymity string
+	}{
+		{proxy: "127.0.0.1:1", seen: []string{"api:anonymous", "after"}},
+		{proxy: "127.0.0.2:1", seen: []string{"api:anonymous"},
+			expectErr: "post check failed: api: status 403"},
+		{proxy: "127.0.0.3:1", seen: []string{"api:anonymous"},
+			expectErr: "post check failed: api: api is slow", temporary: true},
+		{proxy: "127.0.0.1:1", strategy: ErrNotAnonymous,
+			expectErr: "this IP address found", anonymity: Transparent},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			seen = nil
+			hooks, err := configurePostChecks("api, after")
+			assert.NoError(t, err)
+			cc := (&configurableChecker{}).use(checkerConfig{
+				strategies: map[string]Checker{
+					"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+						return time.Second, tt.strategy
+					}),
+				},
+				postChecks: hooks,
+			})
+			proxy := pmux.HttpProxy(tt.proxy)
+			_, err = cc.Check(context.Background(), proxy)
+			r := cc.Result(context.Background(), proxy)
+			assert.Equal(t, append(tt.seen, tt.seen...), seen)
+			if tt.expectErr == "" {
+				assert.NoError(t, err)
+				assert.True(t, r.Ok())
+				return
+			}
+			assert.EqualError(t, err, tt.expectErr)
+			assert.Equal(t, tt.expectErr, r.Failure)
+			assert.Equal(t, tt.temporary, isTimeout(err))
+			assert.Equal(t, tt.anonymity, r.Anonymity)
+		})
+	}
+	assert.True(t, errors.Is(postCheckFailed{"api", errors.New("x")}, errPostCheck))
+}
+
+func TestPostCheckFailuresAreScored(t *testing.T) {
+	RegisterPostCheck("denied", func(ctx context.Context, proxy pmux.Proxy, r CheckResult) error {
+		return fmt.Errorf("status 403")
+	})
+	hooks, err := configurePostChecks("denied")
+	assert.NoError(t, err)
+	requests := 0
+	cc := (&configurableChecker{
+		scoring:  newScoring(),
+		breakers: newBreakers(),
+	}).use(checkerConfig{
+		strategies: map[string]Checker{
+			"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				requests++
+				return time.Second, nil
+			}),
+		},
+		postChecks:      hooks,
+		breakerFailures: 1,
+		breakerCooldown: time.Minute,
+	})
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	_, err = cc.Check(context.Background(), proxy)
+	assert.EqualError(t, err, "post check failed: denied: status 403")
+	assert.Equal(t, Score{Checks: 1}, cc.Score(proxy))
+
+	_, err = cc.Check(context.Background(), proxy)
+	assert.ErrorIs(t, err, errProxyCircuitOpen)
+	assert.Equal(t, 1, requests)
+}
+
+func TestConfigurePostChecks(t *testing.T) {
+	RegisterPostCheck("known", func(ctx context.Context, proxy pmux.Proxy, r CheckResult) error {
+		return nil
+	})
+	c := configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	err := c.Configure(app.Config{"post_checks": "known, nope"})
+	assert.ErrorContains(t, err, "invalid post check: nope, known: ")
+}
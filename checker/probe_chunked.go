@@ -0,0 +1,65 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// chunked verifies, that proxy delivers chunked responses intact and streams
+// them, as the IP-echo checks never exercise streaming endpoints
+type chunked struct {
+	client httpClient
+	page   string
+	chunks int
+	delay  time.Duration
+}
+
+func newChunked(client httpClient, judge string) capabilityProbe {
+	return &chunked{
+		client: client,
+		page:   judge + "/chunked",
+		chunks: 8,
+		delay:  100 * time.Millisecond,
+	}
+}
+
+func (c *chunked) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	page := fmt.Sprintf("%s?n=%d&delay=%s", judgePage(proxy, c.page), c.chunks, c.delay)
+	start := time.Now()
+	res, err := probeResponse(ctx, c.client, proxy, "GET", page, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("status %d", res.StatusCode)
+	}
+	var first time.Duration
+	scanner := bufio.NewScanner(res.Body)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		if i == 0 {
+			first = time.Since(start)
+		}
+		if scanner.Text() != chunkLine(i) {
+			return fmt.Errorf("chunk %d is broken: %s", i, truncatedBody(ctx, scanner.Text()))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("chunk %d: %w", i, err)
+	}
+	if i != c.chunks {
+		return fmt.Errorf("truncated: %d of %d chunks", i, c.chunks)
+	}
+	r.Capabilities |= Chunked
+	// buffering proxies deliver everything at once in the end
+	spread := time.Since(start) - first
+	if spread >= c.delay*time.Duration(c.chunks-1)/2 {
+		r.Capabilities |= Streaming
+	}
+	return nil
+}
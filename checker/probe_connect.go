@@ -0,0 +1,119 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// connectTargets tunnels to the judge by its hostname and by its IP, as
+// some proxies resolve targets themselves and reject IP literals, which
+// breaks workloads pinning targets by IP, or the other way around
+type connectTargets struct {
+	page    string
+	dial    func(ctx context.Context, proxy pmux.Proxy, addr string) (net.Conn, error)
+	resolve func(ctx context.Context, host string) (string, error)
+}
+
+func newConnectTargets(_ httpClient, judge string) capabilityProbe {
+	return &connectTargets{
+		page:    judge + "/ip",
+		dial:    pmux.DialTunnel,
+		resolve: resolveHost,
+	}
+}
+
+func resolveHost(ctx context.Context, host string) (string, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no ipv4 for %s", host)
+	}
+	return ips[0].String(), nil
+}
+
+// Probe tries only the IP form for judges configured by IP
+func (c *connectTargets) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	page, err := url.Parse(c.page)
+	if err != nil {
+		return err
+	}
+	port := page.Port()
+	if port == "" {
+		port = "80"
+		if page.Scheme == "https" {
+			port = "443"
+		}
+	}
+	host := page.Hostname()
+	hostname, ip := "", host
+	if net.ParseIP(host) == nil {
+		hostname = host
+		ip, err = c.resolve(ctx, host)
+		if err != nil {
+			return fmt.Errorf("connect targets: %w", err)
+		}
+	}
+	for _, v := range []struct {
+		target     string
+		capability Capability
+	}{
+		{hostname, ConnectHostname},
+		{ip, ConnectIP},
+	} {
+		if v.target == "" {
+			continue
+		}
+		if c.reaches(ctx, proxy, page, net.JoinHostPort(v.target, port)) {
+			r.Capabilities |= v.capability
+		}
+	}
+	return nil
+}
+
+// reaches is false for any failure, as proxies reject targets in all sorts
+// of ways: refusing CONNECT, closing the tunnel, or serving an error page
+func (c *connectTargets) reaches(ctx context.Context, proxy pmux.Proxy, page *url.URL, addr string) bool {
+	conn, err := c.dial(ctx, proxy, addr)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+	if page.Scheme == "https" {
+		config := pmux.DefaultTlsConfig.Clone()
+		config.ServerName = page.Hostname()
+		tlsConn := tls.Client(conn, config)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			return false
+		}
+		conn = tlsConn
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", page.String(), nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", randomAgent(req.Context()))
+	err = req.Write(conn)
+	if err != nil {
+		return false
+	}
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode == 200
+}
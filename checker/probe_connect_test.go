@@ -0,0 +1,88 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectTargets(t *testing.T) {
+	srv := httptest.NewServer(NewJudge().Handler)
+	defer srv.Close()
+	for i, tt := range []struct {
+		page    string
+		accepts []string
+		dialed  []string
+		expect  Capability
+	}{
+		{
+			page:    "http://judge.local/ip",
+			accepts: []string{"judge.local:80", "10.0.0.1:80"},
+			dialed:  []string{"judge.local:80", "10.0.0.1:80"},
+			expect:  ConnectHostname | ConnectIP,
+		},
+		{
+			page:    "http://judge.local/ip",
+			accepts: []string{"judge.local:80"},
+			dialed:  []string{"judge.local:80", "10.0.0.1:80"},
+			expect:  ConnectHostname,
+		},
+		{
+			page:    "http://judge.local/ip",
+			accepts: []string{"10.0.0.1:80"},
+			dialed:  []string{"judge.local:80", "10.0.0.1:80"},
+			expect:  ConnectIP,
+		},
+		{
+			page:   "http://judge.local/ip",
+			dialed: []string{"judge.local:80", "10.0.0.1:80"},
+		},
+		{
+			page:    "http://10.0.0.2:8080/ip",
+			accepts: []string{"10.0.0.2:8080"},
+			dialed:  []string{"10.0.0.2:8080"},
+			expect:  ConnectIP,
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var dialed []string
+			probe := &connectTargets{
+				page: tt.page,
+				dial: func(ctx context.Context, proxy pmux.Proxy, addr string) (net.Conn, error) {
+					dialed = append(dialed, addr)
+					for _, v := range tt.accepts {
+						if v == addr {
+							return net.Dial("tcp", srv.Listener.Addr().String())
+						}
+					}
+					return nil, fmt.Errorf("connect: 403 Forbidden")
+				},
+				resolve: func(ctx context.Context, host string) (string, error) {
+					return "10.0.0.1", nil
+				},
+			}
+			var r CheckResult
+			err := probe.Probe(context.Background(), pmux.HttpProxy("127.0.0.1:1"), &r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.dialed, dialed)
+			assert.Equal(t, tt.expect, r.Capabilities)
+		})
+	}
+}
+
+func TestConnectTargetsUnresolved(t *testing.T) {
+	probe := &connectTargets{
+		page: "http://judge.local/ip",
+		resolve: func(ctx context.Context, host string) (string, error) {
+			return "", fmt.Errorf("no such host")
+		},
+	}
+	var r CheckResult
+	err := probe.Probe(context.Background(), pmux.HttpProxy("127.0.0.1:1"), &r)
+	assert.EqualError(t, err, "connect targets: no such host")
+}
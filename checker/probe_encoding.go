@@ -0,0 +1,66 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// contentEncoding verifies, that proxy delivers the exact bytes of the origin
+// and neither decompresses, recompresses, nor adds compression on its own
+type contentEncoding struct {
+	client httpClient
+	page   string
+}
+
+func newContentEncoding(client httpClient, judge string) capabilityProbe {
+	return &contentEncoding{
+		client: client,
+		page:   judge + "/encoded",
+	}
+}
+
+func (c *contentEncoding) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	for _, v := range []struct {
+		encoding string
+		expect   []byte
+	}{
+		{"gzip", gzippedPayload()},
+		{"identity", encodedPayload},
+	} {
+		altered, err := c.alters(ctx, proxy, v.encoding, v.expect)
+		if err != nil {
+			return fmt.Errorf("%s: %w", v.encoding, err)
+		}
+		if altered {
+			r.AltersEncoding = true
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *contentEncoding) alters(ctx context.Context, proxy pmux.Proxy, encoding string, expect []byte) (bool, error) {
+	page := fmt.Sprintf("%s?encoding=%s", c.page, encoding)
+	res, body, err := probeRequest(ctx, c.client, proxy, "GET", page, nil, func(req *http.Request) {
+		// explicit header keeps transport from transparent decompression
+		req.Header.Set("Accept-Encoding", "gzip")
+	})
+	if err != nil {
+		return false, err
+	}
+	if res.StatusCode != 200 {
+		return false, fmt.Errorf("status %d", res.StatusCode)
+	}
+	got := res.Header.Get("Content-Encoding")
+	if encoding == "identity" {
+		encoding = ""
+	}
+	if got != encoding {
+		return true, nil
+	}
+	return !bytes.Equal(body, expect), nil
+}
@@ -0,0 +1,70 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// earlyHints verifies, that proxy survives 103 Early Hints before the final
+// response, as many of them drop informational responses or break on them
+type earlyHints struct {
+	client httpClient
+	page   string
+}
+
+func newEarlyHints(client httpClient, judge string) capabilityProbe {
+	return &earlyHints{
+		client: client,
+		page:   judge + "/hints",
+	}
+}
+
+func (e *earlyHints) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	token := strconv.FormatUint(rand.Uint64(), 36)
+	page := fmt.Sprintf("%s?token=%s", judgePage(proxy, e.page), token)
+	var mu sync.Mutex
+	var hinted bool
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			link := header.Get("Link")
+			if code == http.StatusEarlyHints && strings.Contains(link, token) {
+				mu.Lock()
+				hinted = true
+				mu.Unlock()
+			}
+			return nil
+		},
+	})
+	res, err := probeResponse(ctx, e.client, proxy, "GET", page, nil, nil)
+	if err != nil {
+		return fmt.Errorf("final response: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("final response: %w", err)
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("final response: status %d", res.StatusCode)
+	}
+	if strings.TrimSpace(string(body)) != token {
+		return fmt.Errorf("final response is broken: %s", truncatedBody(ctx, string(body)))
+	}
+	r.Capabilities |= Informational
+	mu.Lock()
+	defer mu.Unlock()
+	if hinted {
+		r.Capabilities |= EarlyHints
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEarlyHints(t *testing.T) {
+	for i, tt := range []struct {
+		wrap      func(http.Handler) http.Handler
+		expect    Capability
+		expectErr string
+	}{
+		{
+			expect: Informational | EarlyHints,
+		},
+		{
+			// drops informational response
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					fmt.Fprintln(rw, r.URL.Query().Get("token"))
+				})
+			},
+			expect: Informational,
+		},
+		{
+			// takes informational response for the final one
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					rw.WriteHeader(502)
+				})
+			},
+			expectErr: "final response: status 502",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			proxy, client := judgeProxy(t, tt.wrap)
+			probe := newEarlyHints(client, "http://judge.local")
+
+			var r CheckResult
+			err := probe.Probe(context.Background(), proxy, &r)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expect, r.Capabilities)
+		})
+	}
+}
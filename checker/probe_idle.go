@@ -0,0 +1,95 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// idle reuses the connection to the proxy after it has been idle for a while,
+// as proxies dropping idle connections break long-lived sessions, and single
+// request checks never notice that
+type idle struct {
+	keepAlive
+	duration time.Duration
+}
+
+func newIdle(client httpClient, judge string) capabilityProbe {
+	ka := newKeepAlive(client, judge).(*keepAlive)
+	return &idle{
+		keepAlive: *ka,
+		duration:  30 * time.Second,
+	}
+}
+
+func (i *idle) configure(conf app.Config) error {
+	i.duration = conf.DurOr("idle_duration", 30*time.Second)
+	if i.duration <= 0 {
+		return fmt.Errorf("idle_duration has to be positive")
+	}
+	return nil
+}
+
+func (i *idle) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	deadline, ok := ctx.Deadline()
+	if ok && time.Until(deadline) < i.duration {
+		return fmt.Errorf("idle: %s is longer than the deadline", i.duration)
+	}
+	page, err := url.Parse(judgePage(proxy, i.page))
+	if err != nil {
+		return err
+	}
+	conn, err := i.connect(ctx, proxy, page)
+	if err != nil {
+		return fmt.Errorf("idle: %w", err)
+	}
+	defer conn.Close()
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+	br := bufio.NewReader(conn)
+	exchange := func(n int) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s?n=%d", page, n), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", randomAgent(req.Context()))
+		if proxy.Proto() == pmux.HTTP {
+			err = req.WriteProxy(conn)
+		} else {
+			err = req.Write(conn)
+		}
+		if err != nil {
+			return err
+		}
+		seen, err := readConn(br, req)
+		if err != nil {
+			return err
+		}
+		if seen.n != n {
+			return fmt.Errorf("unexpected response: %d", seen.n)
+		}
+		return nil
+	}
+	err = exchange(1)
+	if err != nil {
+		return fmt.Errorf("idle: %w", err)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(i.duration):
+	}
+	if exchange(2) != nil {
+		// proxy has dropped the idle connection
+		return nil
+	}
+	r.Capabilities |= SurvivesIdle
+	return nil
+}
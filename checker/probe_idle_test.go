@@ -0,0 +1,51 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdle(t *testing.T) {
+	for i, tt := range []struct {
+		wrap   func(http.Handler) http.Handler
+		expect Capability
+	}{
+		{
+			expect: SurvivesIdle,
+		},
+		{
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					rw.Header().Set("Connection", "close")
+					next.ServeHTTP(rw, r)
+				})
+			},
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			proxy, client := judgeProxy(t, tt.wrap)
+			p := newIdle(client, "http://judge.local").(*idle)
+			err := p.configure(app.Config{"idle_duration": "50ms"})
+			assert.NoError(t, err)
+			var r CheckResult
+			err = p.Probe(context.Background(), proxy, &r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, r.Capabilities)
+		})
+	}
+}
+
+func TestIdleLongerThanDeadline(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	p := newIdle(client, "http://judge.local")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := p.Probe(ctx, proxy, &CheckResult{})
+	assert.EqualError(t, err, "idle: 30s is longer than the deadline")
+}
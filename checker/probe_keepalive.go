@@ -0,0 +1,184 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// keepAlive sends several requests over a single connection to the proxy,
+// first one after another and then back-to-back, as the shared transport
+// never reuses connections and so cannot tell how well the proxy amortizes
+// connection cost.
+type keepAlive struct {
+	page     string
+	requests int
+	dial     func(ctx context.Context, proxy pmux.Proxy, addr string) (net.Conn, error)
+}
+
+func newKeepAlive(_ httpClient, judge string) capabilityProbe {
+	return &keepAlive{
+		page:     judge + "/conn",
+		requests: 3,
+		dial:     dialJudge,
+	}
+}
+
+// dialJudge connects to HTTP proxies directly, and tunnels through the rest
+func dialJudge(ctx context.Context, proxy pmux.Proxy, addr string) (net.Conn, error) {
+	if proxy.Proto() == pmux.HTTP {
+		return pmux.DefaultDialer.DialContext(ctx, "tcp", proxy.Address())
+	}
+	return pmux.DialTunnel(ctx, proxy, addr)
+}
+
+func (k *keepAlive) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	sequential, err := k.session(ctx, proxy, false)
+	if err != nil {
+		return fmt.Errorf("keep-alive: %w", err)
+	}
+	if sequential {
+		r.Capabilities |= KeepAlive
+	}
+	pipelined, err := k.session(ctx, proxy, true)
+	if err != nil {
+		return fmt.Errorf("pipelining: %w", err)
+	}
+	if pipelined {
+		r.Capabilities |= Pipelining
+	}
+	return nil
+}
+
+// session returns true, if all requests got their responses in order and
+// the judge has seen them coming from the same connection
+func (k *keepAlive) session(ctx context.Context, proxy pmux.Proxy, pipeline bool) (bool, error) {
+	page, err := url.Parse(judgePage(proxy, k.page))
+	if err != nil {
+		return false, err
+	}
+	conn, err := k.connect(ctx, proxy, page)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+	absolute := proxy.Proto() == pmux.HTTP
+	var reqs []*http.Request
+	for i := 1; i <= k.requests; i++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s?n=%d", page, i), nil)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("User-Agent", randomAgent(req.Context()))
+		reqs = append(reqs, req)
+	}
+	write := func(req *http.Request) error {
+		if absolute {
+			return req.WriteProxy(conn)
+		}
+		return req.Write(conn)
+	}
+	if pipeline {
+		for _, req := range reqs {
+			err = write(req)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	br := bufio.NewReader(conn)
+	var upstream string
+	for i, req := range reqs {
+		if !pipeline {
+			err = write(req)
+			if err != nil && i > 0 {
+				// proxy has closed the connection after the response
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		seen, err := readConn(br, req)
+		if err != nil && i > 0 {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if seen.n != i+1 {
+			return false, nil
+		}
+		if upstream == "" {
+			upstream = seen.addr
+		}
+		if seen.addr != upstream {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (k *keepAlive) connect(ctx context.Context, proxy pmux.Proxy, page *url.URL) (net.Conn, error) {
+	addr := page.Host
+	if page.Port() == "" {
+		port := "80"
+		if page.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(page.Hostname(), port)
+	}
+	conn, err := k.dial(ctx, proxy, addr)
+	if err != nil {
+		return nil, err
+	}
+	if page.Scheme != "https" || proxy.Proto() == pmux.HTTP {
+		return conn, nil
+	}
+	config := pmux.DefaultTlsConfig.Clone()
+	config.ServerName = page.Hostname()
+	tlsConn := tls.Client(conn, config)
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+type seenConn struct {
+	n    int
+	addr string
+}
+
+func readConn(br *bufio.Reader, req *http.Request) (seen seenConn, err error) {
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		return seen, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return seen, err
+	}
+	if res.StatusCode != 200 {
+		return seen, fmt.Errorf("status %d", res.StatusCode)
+	}
+	_, err = fmt.Sscanf(strings.TrimSpace(string(body)), "%d %s", &seen.n, &seen.addr)
+	if err != nil {
+		return seen, fmt.Errorf("unexpected: %s", truncatedBody(req.Context(), string(body)))
+	}
+	return seen, nil
+}
@@ -0,0 +1,46 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepAlive(t *testing.T) {
+	for i, tt := range []struct {
+		wrap   func(http.Handler) http.Handler
+		expect Capability
+	}{
+		{
+			expect: KeepAlive | Pipelining,
+		},
+		{
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					rw.Header().Set("Connection", "close")
+					next.ServeHTTP(rw, r)
+				})
+			},
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			proxy, client := judgeProxy(t, tt.wrap)
+			p := newKeepAlive(client, "http://judge.local")
+			var r CheckResult
+			err := p.Probe(context.Background(), proxy, &r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, r.Capabilities)
+		})
+	}
+}
+
+func TestJudgeConn(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	_, body, err := probeRequest(context.Background(), client, proxy, "GET",
+		"http://judge.local/conn?n=2", nil, nil)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^2 127\.0\.0\.1:\d+$`, string(body))
+}
@@ -0,0 +1,91 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// methods sends requests with methods beyond GET and POST, like WebDAV or
+// cache purges, which many proxies reject or rewrite
+type methods struct {
+	client  httpClient
+	page    string
+	methods []string
+}
+
+func newMethods(client httpClient, judge string) capabilityProbe {
+	return &methods{
+		client: client,
+		page:   judge + "/method",
+	}
+}
+
+// configure parses probe_methods, e.g. "PURGE, PROPFIND, MKCOL"
+func (m *methods) configure(conf app.Config) error {
+	m.methods = nil
+	for _, v := range strings.Split(conf.StrOr("probe_methods", "PURGE,PROPFIND"), ",") {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		m.methods = append(m.methods, v)
+	}
+	if len(m.methods) == 0 {
+		return fmt.Errorf("probe_methods are empty")
+	}
+	return nil
+}
+
+// Probe records every method, that got a verdict, and keeps going on errors
+func (m *methods) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	var errs []string
+	for _, method := range m.methods {
+		forwarded, err := m.forwards(ctx, proxy, method)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", method, err))
+			continue
+		}
+		if r.Methods == nil {
+			r.Methods = map[string]bool{}
+		}
+		r.Methods[method] = forwarded
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("methods: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// forwards is false for methods, that the proxy rejects as not allowed or
+// not implemented, or rewrites on the way to the judge
+func (m *methods) forwards(ctx context.Context, proxy pmux.Proxy, method string) (bool, error) {
+	// fresh token per request, so that cached responses don't pass
+	token := strconv.FormatUint(rand.Uint64(), 36)
+	page := fmt.Sprintf("%s?token=%s", judgePage(proxy, m.page), token)
+	res, err := probeResponse(ctx, m.client, proxy, method, page, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("status %d", res.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	if err != nil {
+		return false, err
+	}
+	return string(body) == method+" "+token, nil
+}
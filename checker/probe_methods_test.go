@@ -0,0 +1,81 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethods(t *testing.T) {
+	for i, tt := range []struct {
+		wrap      func(http.Handler) http.Handler
+		expect    map[string]bool
+		expectErr string
+	}{
+		{
+			expect: map[string]bool{"PURGE": true, "PROPFIND": true},
+		},
+		{
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					if r.Method == "PROPFIND" {
+						rw.WriteHeader(http.StatusMethodNotAllowed)
+						return
+					}
+					next.ServeHTTP(rw, r)
+				})
+			},
+			expect: map[string]bool{"PURGE": true, "PROPFIND": false},
+		},
+		{
+			// rewrites unknown methods to GET
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					r.Method = "GET"
+					next.ServeHTTP(rw, r)
+				})
+			},
+			expect: map[string]bool{"PURGE": false, "PROPFIND": false},
+		},
+		{
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					if r.Method == "PURGE" {
+						rw.WriteHeader(http.StatusBadGateway)
+						return
+					}
+					next.ServeHTTP(rw, r)
+				})
+			},
+			expect:    map[string]bool{"PROPFIND": true},
+			expectErr: "methods: PURGE: status 502",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			proxy, client := judgeProxy(t, tt.wrap)
+			probe := newMethods(client, "http://judge.local")
+			err := probe.(configurableProbe).configure(app.Config{})
+			assert.NoError(t, err)
+
+			var r CheckResult
+			err = probe.Probe(context.Background(), proxy, &r)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expect, r.Methods)
+		})
+	}
+}
+
+func TestMethodsConfigure(t *testing.T) {
+	m := newMethods(nil, "http://judge").(*methods)
+	assert.NoError(t, m.configure(app.Config{"probe_methods": "purge, MKCOL"}))
+	assert.Equal(t, []string{"PURGE", "MKCOL"}, m.methods)
+	assert.EqualError(t, m.configure(app.Config{"probe_methods": " , "}), "probe_methods are empty")
+}
@@ -0,0 +1,110 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// responseSize ramps up the size of responses until the proxy stalls or
+// truncates them, as fragmentation and MTU issues of proxies only show up
+// mid-body of large responses and never with tiny IP-echo checks
+type responseSize struct {
+	client httpClient
+	page   string
+	sizes  []int
+	// stall is the longest time without a single byte received
+	stall time.Duration
+}
+
+func newResponseSize(client httpClient, judge string) capabilityProbe {
+	rs := &responseSize{
+		client: client,
+		page:   judge + "/large",
+		stall:  2 * time.Second,
+	}
+	rs.configure(app.Config{})
+	return rs
+}
+
+func (rs *responseSize) configure(conf app.Config) error {
+	max := conf.IntOr("response_size_max", 4<<20)
+	if max > maxLarge {
+		return fmt.Errorf("response_size_max is over %d", maxLarge)
+	}
+	rs.sizes = nil
+	for size := 64 << 10; size < max; size *= 4 {
+		rs.sizes = append(rs.sizes, size)
+	}
+	rs.sizes = append(rs.sizes, max)
+	return nil
+}
+
+func (rs *responseSize) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	for _, size := range rs.sizes {
+		err := rs.fetch(ctx, proxy, size)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log := app.Log.From(ctx)
+			log.Debug().Err(err).Int("size", size).Msg("large response failed")
+			break
+		}
+		r.ResponseLimit = size
+	}
+	return nil
+}
+
+// fetch streams the payload and verifies every byte, without buffering
+func (rs *responseSize) fetch(ctx context.Context, proxy pmux.Proxy, size int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stalled int32
+	watchdog := time.AfterFunc(rs.stall, func() {
+		atomic.StoreInt32(&stalled, 1)
+		cancel()
+	})
+	defer watchdog.Stop()
+	page := fmt.Sprintf("%s?size=%d", judgePage(proxy, rs.page), size)
+	res, err := probeResponse(ctx, rs.client, proxy, "GET", page, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("status %d", res.StatusCode)
+	}
+	var offset int64
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := res.Body.Read(buf)
+		if n > 0 {
+			watchdog.Reset(rs.stall)
+		}
+		for _, b := range buf[:n] {
+			if b != largeByte(offset) {
+				return fmt.Errorf("corrupted at %d", offset)
+			}
+			offset++
+		}
+		if err == io.EOF {
+			break
+		}
+		if atomic.LoadInt32(&stalled) == 1 {
+			return fmt.Errorf("stalled at %d", offset)
+		}
+		if err != nil {
+			return fmt.Errorf("at %d: %w", offset, err)
+		}
+	}
+	if offset != int64(size) {
+		return fmt.Errorf("truncated at %d", offset)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// cutWriter misbehaves after the limit, like proxies with MTU issues
+type cutWriter struct {
+	http.ResponseWriter
+	limit   int
+	written int
+	stall   bool
+	corrupt bool
+}
+
+func (w *cutWriter) Write(b []byte) (int, error) {
+	if w.written+len(b) <= w.limit {
+		w.written += len(b)
+		return w.ResponseWriter.Write(b)
+	}
+	head := w.limit - w.written
+	if head < 0 {
+		head = 0
+	}
+	w.ResponseWriter.Write(b[:head])
+	w.written += len(b)
+	switch {
+	case w.stall:
+		w.ResponseWriter.(http.Flusher).Flush()
+		time.Sleep(time.Second)
+	case w.corrupt:
+		w.ResponseWriter.Write([]byte("!"))
+	}
+	return 0, fmt.Errorf("cut")
+}
+
+func TestResponseSize(t *testing.T) {
+	for i, tt := range []struct {
+		cut    func(http.ResponseWriter) http.ResponseWriter
+		expect int
+	}{
+		{
+			expect: 256 << 10,
+		},
+		{
+			cut: func(rw http.ResponseWriter) http.ResponseWriter {
+				return &cutWriter{ResponseWriter: rw, limit: 100 << 10}
+			},
+			expect: 64 << 10,
+		},
+		{
+			cut: func(rw http.ResponseWriter) http.ResponseWriter {
+				return &cutWriter{ResponseWriter: rw, limit: 100 << 10, stall: true}
+			},
+			expect: 64 << 10,
+		},
+		{
+			cut: func(rw http.ResponseWriter) http.ResponseWriter {
+				return &cutWriter{ResponseWriter: rw, limit: 100, corrupt: true}
+			},
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			proxy, client := judgeProxy(t, func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					if tt.cut != nil {
+						rw = tt.cut(rw)
+					}
+					next.ServeHTTP(rw, r)
+				})
+			})
+			rs := newResponseSize(client, "http://judge.local").(*responseSize)
+			rs.stall = 100 * time.Millisecond
+			err := rs.configure(app.Config{"response_size_max": fmt.Sprint(256 << 10)})
+			assert.NoError(t, err)
+			assert.Equal(t, []int{64 << 10, 256 << 10}, rs.sizes)
+			var r CheckResult
+			start := time.Now()
+			err = rs.Probe(context.Background(), proxy, &r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, r.ResponseLimit)
+			assert.Less(t, time.Since(start), 900*time.Millisecond)
+		})
+	}
+}
+
+func TestConfigureResponseSize(t *testing.T) {
+	_, err := configureProbes(app.Config{
+		"judge":             "http://judge",
+		"probes":            "response_size",
+		"response_size_max": fmt.Sprint(maxLarge + 1),
+	}, nil)
+	assert.EqualError(t, err, "response_size: response_size_max is over 67108864")
+
+	rs := newResponseSize(nil, "http://judge").(*responseSize)
+	assert.Equal(t, []int{64 << 10, 256 << 10, 1 << 20, 4 << 20}, rs.sizes)
+}
@@ -0,0 +1,95 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// requestSize ramps up headers and body of the request until the proxy
+// rejects it, as big cookies or payloads don't pass through some of them
+type requestSize struct {
+	client  httpClient
+	page    string
+	headers []int
+	bodies  []int
+}
+
+func newRequestSize(client httpClient, judge string) capabilityProbe {
+	return &requestSize{
+		client:  client,
+		page:    judge + "/size",
+		headers: []int{1 << 10, 4 << 10, 8 << 10, 16 << 10, 32 << 10, 64 << 10},
+		bodies:  []int{16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20},
+	}
+}
+
+func (rs *requestSize) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) (err error) {
+	r.HeaderLimit, err = rs.ramp(ctx, rs.headers, func(size int) (int, error) {
+		padding := strings.Repeat("x", size)
+		return rs.send(ctx, proxy, nil, func(req *http.Request) {
+			req.Header.Set("X-Padding", padding)
+		}, func(seen received) int {
+			return seen.Header
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	r.BodyLimit, err = rs.ramp(ctx, rs.bodies, func(size int) (int, error) {
+		payload := bytes.Repeat([]byte("x"), size)
+		return rs.send(ctx, proxy, payload, nil, func(seen received) int {
+			return seen.Body
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+	return nil
+}
+
+// ramp returns the largest size, that judge has fully received
+func (rs *requestSize) ramp(ctx context.Context, sizes []int, send func(int) (int, error)) (int, error) {
+	var limit int
+	for _, size := range sizes {
+		seen, err := send(size)
+		if ctx.Err() != nil {
+			return limit, ctx.Err()
+		}
+		if err != nil || seen < size {
+			// 413, 414, 431, or a dropped connection
+			break
+		}
+		limit = size
+	}
+	return limit, nil
+}
+
+func (rs *requestSize) send(ctx context.Context, proxy pmux.Proxy, payload []byte,
+	cb func(*http.Request), seen func(received) int) (int, error) {
+	method := "GET"
+	var reqBody io.Reader
+	if payload != nil {
+		method = "POST"
+		reqBody = bytes.NewReader(payload)
+	}
+	res, body, err := probeRequest(ctx, rs.client, proxy, method, rs.page, reqBody, cb)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != 200 {
+		return 0, fmt.Errorf("status %d", res.StatusCode)
+	}
+	var r received
+	err = json.Unmarshal(body, &r)
+	if err != nil {
+		return 0, fmt.Errorf("not size: %s", truncatedBody(ctx, string(body)))
+	}
+	return seen(r), nil
+}
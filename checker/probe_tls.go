@@ -0,0 +1,114 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// tlsExtensions compares the ClientHello, that was sent through the tunnel,
+// with the one, that the judge has received, as proxies re-originating TLS
+// strip or reorder extensions and change the fingerprint seen by anti-bots
+type tlsExtensions struct {
+	page string
+	dial func(ctx context.Context, proxy pmux.Proxy, addr string) (net.Conn, error)
+}
+
+func newTLSExtensions(_ httpClient, judge string) capabilityProbe {
+	return &tlsExtensions{
+		page: judge + "/tls",
+		dial: pmux.DialTunnel,
+	}
+}
+
+func (t *tlsExtensions) configure(conf app.Config) error {
+	judge := strings.TrimSuffix(conf.StrOr("tls_judge", ""), "/")
+	if judge != "" {
+		t.page = judge + "/tls"
+	}
+	if !strings.HasPrefix(t.page, "https://") {
+		return fmt.Errorf("tls_judge has to be https")
+	}
+	return nil
+}
+
+// sentHello records what is written to the tunnel during the handshake
+type sentHello struct {
+	net.Conn
+	buf []byte
+}
+
+func (s *sentHello) Write(b []byte) (int, error) {
+	if len(s.buf) < maxHello {
+		s.buf = append(s.buf, b...)
+	}
+	return s.Conn.Write(b)
+}
+
+func (t *tlsExtensions) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	page, err := url.Parse(t.page)
+	if err != nil {
+		return err
+	}
+	addr := page.Host
+	if page.Port() == "" {
+		addr = net.JoinHostPort(page.Hostname(), "443")
+	}
+	conn, err := t.dial(ctx, proxy, addr)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+	sent := &sentHello{Conn: conn}
+	config := pmux.DefaultTlsConfig.Clone()
+	config.ServerName = page.Hostname()
+	tlsConn := tls.Client(sent, config)
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	expected, err := clientHelloExtensions(sent.buf)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", page.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", randomAgent(req.Context()))
+	err = req.Write(tlsConn)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	res, err := http.ReadResponse(bufio.NewReader(tlsConn), req)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("tls: status %d: %s", res.StatusCode, truncatedBody(ctx, string(body)))
+	}
+	if strings.TrimSpace(string(body)) != formatExtensions(expected) {
+		r.AltersTLSExtensions = true
+		return nil
+	}
+	r.Capabilities |= TLSExtensions
+	return nil
+}
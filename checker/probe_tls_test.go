@@ -0,0 +1,141 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func tlsJudge(t *testing.T) string {
+	j := NewJudge()
+	srv := httptest.NewUnstartedServer(j.Handler)
+	srv.Config.ConnContext = j.ConnContext
+	srv.Listener = helloListener{srv.Listener}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.Listener.Addr().String()
+}
+
+// reoriginate terminates TLS of the client and sends requests to the judge
+// over TLS 1.2, like intercepting proxies do
+func reoriginate(t *testing.T, client net.Conn, addr string) {
+	cert, err := judgeCertificate("", "")
+	assert.NoError(t, err)
+	downstream := tls.Server(client, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	})
+	defer downstream.Close()
+	err = downstream.Handshake()
+	if err != nil {
+		return
+	}
+	upstream, err := tls.Dial("tcp", addr, &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	})
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	go io.Copy(upstream, downstream)
+	io.Copy(downstream, upstream)
+}
+
+func TestTLSExtensions(t *testing.T) {
+	addr := tlsJudge(t)
+	for i, tt := range []struct {
+		intercept bool
+		expect    Capability
+		altered   bool
+	}{
+		{expect: TLSExtensions},
+		{intercept: true, altered: true},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			probe := &tlsExtensions{
+				page: "https://" + addr + "/tls",
+				dial: func(ctx context.Context, proxy pmux.Proxy, target string) (net.Conn, error) {
+					assert.Equal(t, addr, target)
+					if !tt.intercept {
+						return net.Dial("tcp", target)
+					}
+					client, server := net.Pipe()
+					go reoriginate(t, server, target)
+					return client, nil
+				},
+			}
+			var r CheckResult
+			err := probe.Probe(context.Background(), pmux.HttpProxy("127.0.0.1:1"), &r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, r.Capabilities)
+			assert.Equal(t, tt.altered, r.AltersTLSExtensions)
+		})
+	}
+}
+
+func TestJudgeExtensionsWithoutTLS(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	res, _, err := probeRequest(context.Background(), client, proxy, "GET",
+		"http://judge.local/tls", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+}
+
+func TestClientHelloExtensions(t *testing.T) {
+	hello := []byte{
+		0x16, 0x03, 0x01, 0x00, 0x39,
+		0x01, 0x00, 0x00, 0x35,
+		0x03, 0x03,
+	}
+	hello = append(hello, make([]byte, 32)...)
+	hello = append(hello,
+		0x00,                   // session id
+		0x00, 0x02, 0x13, 0x01, // cipher suites
+		0x01, 0x00, // compression methods
+		0x00, 0x0a, // extensions
+		0x00, 0x2b, 0x00, 0x02, 0x03, 0x04,
+		0x00, 0x00, 0x00, 0x00)
+	for i, tt := range []struct {
+		raw       []byte
+		expect    []uint16
+		expectErr string
+	}{
+		{raw: hello, expect: []uint16{43, 0}},
+		{raw: hello[:20], expectErr: "incomplete client hello"},
+		{raw: []byte("GET / HTTP/1.1\r\n"), expectErr: "not a handshake record: 71"},
+		// same message split into two records
+		{raw: append(append([]byte{0x16, 0x03, 0x01, 0x00, 0x10}, hello[5:21]...),
+			append([]byte{0x16, 0x03, 0x01, 0x00, 0x29}, hello[21:]...)...), expect: []uint16{43, 0}},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			extensions, err := clientHelloExtensions(tt.raw)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, extensions)
+		})
+	}
+}
+
+func TestConfigureTLSExtensions(t *testing.T) {
+	probe := newTLSExtensions(nil, "http://judge").(*tlsExtensions)
+	err := probe.configure(app.Config{})
+	assert.EqualError(t, err, "tls_judge has to be https")
+
+	err = probe.configure(app.Config{
+		"tls_judge": "https://judge:8443/",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://judge:8443/tls", probe.page)
+}
@@ -0,0 +1,62 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// trailers verifies, that proxy delivers trailers of chunked responses,
+// which many of them drop, breaking gRPC-Web and APIs with status in them
+type trailers struct {
+	client httpClient
+	page   string
+}
+
+func newTrailers(client httpClient, judge string) capabilityProbe {
+	return &trailers{
+		client: client,
+		page:   judge + "/trailers",
+	}
+}
+
+func (t *trailers) Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error {
+	// fresh token per probe, so that cached responses don't pass
+	token := strconv.FormatUint(rand.Uint64(), 36)
+	page := fmt.Sprintf("%s?token=%s", judgePage(proxy, t.page), token)
+	res, err := probeResponse(ctx, t.client, proxy, "GET", page, nil, func(req *http.Request) {
+		req.Header.Set("TE", "trailers")
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("status %d", res.StatusCode)
+	}
+	scanner := bufio.NewScanner(res.Body)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		if scanner.Text() != chunkLine(i) {
+			return fmt.Errorf("chunk %d is broken: %s", i, truncatedBody(ctx, scanner.Text()))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("chunk %d: %w", i, err)
+	}
+	// trailers are known only once the body is read
+	actual := res.Trailer.Get(trailerToken)
+	if actual == "" {
+		return nil
+	}
+	if actual != token {
+		return fmt.Errorf("trailer is altered: %s", truncatedBody(ctx, actual))
+	}
+	r.Capabilities |= Trailers
+	return nil
+}
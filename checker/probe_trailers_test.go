@@ -0,0 +1,59 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrailers(t *testing.T) {
+	for i, tt := range []struct {
+		wrap      func(http.Handler) http.Handler
+		expect    Capability
+		expectErr string
+	}{
+		{
+			expect: Trailers,
+		},
+		{
+			// drops trailers, but keeps the body
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					rec := httptest.NewRecorder()
+					next.ServeHTTP(rec, r)
+					rw.Write(rec.Body.Bytes())
+				})
+			},
+		},
+		{
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					rec := httptest.NewRecorder()
+					next.ServeHTTP(rec, r)
+					rw.Header().Set("Trailer", trailerToken)
+					rw.Write(rec.Body.Bytes())
+					rw.Header().Set(trailerToken, "cached")
+				})
+			},
+			expectErr: "trailer is altered: cached",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			proxy, client := judgeProxy(t, tt.wrap)
+			probe := newTrailers(client, "http://judge.local")
+
+			var r CheckResult
+			err := probe.Probe(context.Background(), proxy, &r)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expect, r.Capabilities)
+		})
+	}
+}
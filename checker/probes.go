@@ -0,0 +1,122 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// capabilityProbe is an optional check of what the proxy can do beyond being
+// alive and anonymous. Probes run against the self-hosted judge only for
+// proxies, that passed the strategy, and record findings into the result.
+type capabilityProbe interface {
+	Probe(ctx context.Context, proxy pmux.Proxy, r *CheckResult) error
+}
+
+type probeFactory func(client httpClient, judge string) capabilityProbe
+
+// configurableProbe has settings of its own
+type configurableProbe interface {
+	configure(conf app.Config) error
+}
+
+var capabilityProbes = map[string]probeFactory{
+	"request_size":    newRequestSize,
+	"response_size":   newResponseSize,
+	"chunked":         newChunked,
+	"encoding":        newContentEncoding,
+	"keep_alive":      newKeepAlive,
+	"trailers":        newTrailers,
+	"early_hints":     newEarlyHints,
+	"idle":            newIdle,
+	"tls_extensions":  newTLSExtensions,
+	"connect_targets": newConnectTargets,
+	"methods":         newMethods,
+}
+
+func configureProbes(conf app.Config, client httpClient) ([]capabilityProbe, error) {
+	raw := conf.StrOr("probes", "")
+	if raw == "" {
+		return nil, nil
+	}
+	judge := strings.TrimSuffix(conf.StrOr("judge", ""), "/")
+	if judge == "" {
+		return nil, fmt.Errorf("probes require self-hosted judge")
+	}
+	var out []capabilityProbe
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		factory, ok := capabilityProbes[name]
+		if !ok {
+			var known []string
+			for k := range capabilityProbes {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("invalid probe: %s, known: %s", name, strings.Join(known, ", "))
+		}
+		probe := factory(client, judge)
+		cp, ok := probe.(configurableProbe)
+		if ok {
+			err := cp.configure(conf)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		out = append(out, probe)
+	}
+	return out, nil
+}
+
+// judgePage downgrades https judges for HTTP proxies, which often cannot CONNECT
+func judgePage(proxy pmux.Proxy, page string) string {
+	if proxy.Proto() == pmux.HTTP {
+		return strings.Replace(page, "https", "http", 1)
+	}
+	return page
+}
+
+// probeRequest sends method to the judge through the proxy and returns the
+// response along with the fully read body
+func probeRequest(ctx context.Context, client httpClient, proxy pmux.Proxy,
+	method, page string, reqBody io.Reader, cb func(*http.Request)) (res *http.Response, body []byte, err error) {
+	page = judgePage(proxy, page)
+	ctx, record := traced(ctx, method, page)
+	defer func() {
+		record(res, string(body), err)
+	}()
+	res, err = probeResponse(ctx, client, proxy, method, page, reqBody, cb)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	body, err = ioutil.ReadAll(res.Body)
+	return res, body, err
+}
+
+// probeResponse sends method to the page through the proxy and leaves the
+// body to the caller. Every request takes one from the judge budget of the
+// check, so that probes are capped by max_judges_per_check as well.
+func probeResponse(ctx context.Context, client httpClient, proxy pmux.Proxy,
+	method, page string, reqBody io.Reader, cb func(*http.Request)) (*http.Response, error) {
+	err := spend(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(proxy.InContext(ctx), method, page, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", randomAgent(req.Context()))
+	if cb != nil {
+		cb(req)
+	}
+	return client.Do(req)
+}
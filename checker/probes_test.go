@@ -0,0 +1,203 @@
+package checker
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+// judgeProxy starts self-hosted judge, that also acts as an HTTP proxy for
+// itself, as absolute-form requests end up in the same handler
+func judgeProxy(t *testing.T, wrap func(http.Handler) http.Handler) (pmux.Proxy, httpClient) {
+	var handler http.Handler = NewJudge().Handler
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	proxy := pmux.HttpProxy(srv.Listener.Addr().String())
+	client := &http.Client{
+		Transport: pmux.ContextualHttpTransport(),
+		Timeout:   5 * time.Second,
+	}
+	return proxy, client
+}
+
+func TestConfigureProbes(t *testing.T) {
+	_, err := configureProbes(app.Config{
+		"probes": "request_size",
+	}, nil)
+	assert.EqualError(t, err, "probes require self-hosted judge")
+
+	_, err = configureProbes(app.Config{
+		"probes": "nope",
+		"judge":  "http://judge",
+	}, nil)
+	assert.EqualError(t, err, "invalid probe: nope, known: chunked, connect_targets, early_hints, encoding, idle, keep_alive, methods, request_size, response_size, tls_extensions, trailers")
+
+	probes, err := configureProbes(app.Config{
+		"probes": "request_size",
+		"judge":  "http://judge/",
+	}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, probes, 1)
+	assert.Equal(t, "http://judge/size", probes[0].(*requestSize).page)
+}
+
+func TestRequestSize(t *testing.T) {
+	proxy, client := judgeProxy(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if len(r.Header.Get("X-Padding")) > 8<<10 {
+				rw.WriteHeader(431)
+				return
+			}
+			if r.ContentLength > 64<<10 {
+				rw.WriteHeader(413)
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	})
+	probe := newRequestSize(client, "http://judge.local")
+
+	var r CheckResult
+	err := probe.Probe(context.Background(), proxy, &r)
+	assert.NoError(t, err)
+	assert.Equal(t, 8<<10, r.HeaderLimit)
+	assert.Equal(t, 64<<10, r.BodyLimit)
+}
+
+func TestResultRunsProbes(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	cc := &configurableChecker{
+		client: client,
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip:     "255.0.0.1",
+				page:   "http://judge.local/ip",
+				client: client,
+			},
+		},
+	}
+	probes, err := configureProbes(app.Config{
+		"probes": "request_size",
+		"judge":  "http://judge.local",
+	}, client)
+	assert.NoError(t, err)
+	cc.use(checkerConfig{probes: probes})
+
+	r := cc.Result(context.Background(), proxy)
+	assert.True(t, r.Ok(), r.Failure)
+	assert.Equal(t, 64<<10, r.HeaderLimit)
+	assert.Equal(t, 4<<20, r.BodyLimit)
+}
+
+func TestChunked(t *testing.T) {
+	for i, tt := range []struct {
+		wrap      func(http.Handler) http.Handler
+		expect    Capability
+		expectErr string
+	}{
+		{
+			expect: Chunked | Streaming,
+		},
+		{
+			// buffers the whole response before sending it
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					rec := httptest.NewRecorder()
+					next.ServeHTTP(rec, r)
+					rw.Write(rec.Body.Bytes())
+				})
+			},
+			expect: Chunked,
+		},
+		{
+			wrap: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					rec := httptest.NewRecorder()
+					next.ServeHTTP(rec, r)
+					rw.Write(rec.Body.Bytes()[:rec.Body.Len()/2])
+				})
+			},
+			expectErr: "chunk 2 is broken: 2:ccccccccccccccccccccccccccccccc",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			proxy, client := judgeProxy(t, tt.wrap)
+			probe := newChunked(client, "http://judge.local").(*chunked)
+			probe.chunks = 5
+			probe.delay = 20 * time.Millisecond
+
+			var r CheckResult
+			err := probe.Probe(context.Background(), proxy, &r)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expect, r.Capabilities)
+		})
+	}
+}
+
+func TestContentEncoding(t *testing.T) {
+	gunzip := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rec := httptest.NewRecorder()
+			next.ServeHTTP(rec, r)
+			if rec.Header().Get("Content-Encoding") != "gzip" {
+				rw.Write(rec.Body.Bytes())
+				return
+			}
+			gz, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				rw.WriteHeader(500)
+				return
+			}
+			io.Copy(rw, gz)
+		})
+	}
+	compress := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rec := httptest.NewRecorder()
+			next.ServeHTTP(rec, r)
+			if rec.Header().Get("Content-Encoding") != "" {
+				rw.Header().Set("Content-Encoding", rec.Header().Get("Content-Encoding"))
+				rw.Write(rec.Body.Bytes())
+				return
+			}
+			rw.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(rw)
+			gz.Write(rec.Body.Bytes())
+			gz.Close()
+		})
+	}
+	for i, tt := range []struct {
+		wrap    func(http.Handler) http.Handler
+		altered bool
+	}{
+		{nil, false},
+		{gunzip, true},
+		{compress, true},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			proxy, client := judgeProxy(t, tt.wrap)
+			probe := newContentEncoding(client, "http://judge.local")
+
+			var r CheckResult
+			err := probe.Probe(context.Background(), proxy, &r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.altered, r.AltersEncoding)
+		})
+	}
+}
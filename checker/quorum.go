@@ -0,0 +1,120 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// quorum asks every judge at once and decides anonymity by the trust weight
+// of judges, that have reached a verdict, so that one trusted self-hosted
+// judge could outvote several flaky public ones. Failed judges abstain.
+type quorum struct {
+	judges []*simple
+}
+
+// configureQuorum reads comma-separated judges from quorum_judges
+func configureQuorum(conf app.Config, client httpClient, ip string) (out quorum) {
+	valid := map[string]string{}
+	for _, j := range registry {
+		valid[j.page] = j.valid
+	}
+	for _, page := range strings.Split(conf.StrOr("quorum_judges", ""), ",") {
+		page = strings.TrimSpace(page)
+		if page == "" {
+			continue
+		}
+		out.judges = append(out.judges, &simple{
+			client: client,
+			page:   page,
+			valid:  valid[page],
+			ip:     ip,
+		})
+	}
+	return out
+}
+
+// parseJudgeTrust parses comma-separated pairs of judge page and its
+// positive integer weight, e.g. "https://judge.example.com/ip 10"
+func parseJudgeTrust(raw string) (map[string]int, error) {
+	out := map[string]int{}
+	for _, v := range strings.Split(raw, ",") {
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid judge trust: %s", strings.TrimSpace(v))
+		}
+		weight, err := strconv.Atoi(fields[1])
+		if err != nil || weight < 1 {
+			return nil, fmt.Errorf("invalid judge trust: %s: %s", fields[0], fields[1])
+		}
+		out[fields[0]] = weight
+	}
+	return out, nil
+}
+
+func (sc *simple) weight() int {
+	if sc.trust < 1 {
+		return 1
+	}
+	return sc.trust
+}
+
+// Check passes, when anonymous verdicts outweigh transparent ones, and
+// returns the fastest latency of them. Ties are transparent.
+func (q quorum) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+	type outcome struct {
+		judge *simple
+		t     time.Duration
+		err   error
+	}
+	results := make(chan outcome, len(q.judges))
+	var wg sync.WaitGroup
+	for _, j := range q.judges {
+		wg.Add(1)
+		go func(j *simple) {
+			defer wg.Done()
+			t, err := j.Check(ctx, proxy)
+			results <- outcome{j, t, err}
+		}(j)
+	}
+	wg.Wait()
+	close(results)
+	var anonymous, transparent int
+	var fastest time.Duration
+	var failures []string
+	var lastErr error
+	for v := range results {
+		switch anonymityLevel(v.err) {
+		case outcomeAnonymous:
+			if anonymous == 0 || v.t < fastest {
+				fastest = v.t
+			}
+			anonymous += v.judge.weight()
+		case outcomeTransparent:
+			transparent += v.judge.weight()
+		default:
+			failures = append(failures, fmt.Sprintf("%s: %s", v.judge.page, v.err))
+			lastErr = v.err
+		}
+	}
+	switch {
+	case transparent > 0 && transparent >= anonymous:
+		return 0, ErrNotAnonymous
+	case anonymous > 0:
+		return fastest, nil
+	case len(failures) == 1:
+		return 0, lastErr
+	}
+	sort.Strings(failures)
+	return 0, fmt.Errorf("all judges failed: %s", strings.Join(failures, "; "))
+}
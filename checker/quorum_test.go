@@ -0,0 +1,87 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+// quorumClient responds with the body by host of the judge
+func quorumClient(bodies map[string]string) clientFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		b, ok := bodies[req.URL.Host]
+		if !ok {
+			return nil, fmt.Errorf("%s is down", req.URL.Host)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       body(b),
+		}, nil
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	for i, tt := range []struct {
+		bodies    map[string]string
+		trust     string
+		expectErr string
+	}{
+		{
+			bodies: map[string]string{"self": "255.0.0.1", "a": "1.2.3.4", "b": "1.2.3.4"},
+			trust:  "https://self/ip 3",
+			// trusted judge outvotes public ones
+			expectErr: "this IP address found",
+		},
+		{
+			bodies: map[string]string{"self": "255.0.0.1", "a": "1.2.3.4", "b": "1.2.3.4"},
+		},
+		{
+			bodies: map[string]string{"self": "1.2.3.4", "a": "255.0.0.1"},
+			trust:  "https://self/ip 3",
+		},
+		{
+			bodies:    map[string]string{"self": "255.0.0.1", "a": "1.2.3.4"},
+			expectErr: "this IP address found",
+		},
+		{
+			bodies:    map[string]string{"a": "nope"},
+			expectErr: "all judges failed: https://a/ip: not ip: nope; https://b/ip: b is down; https://self/ip: self is down",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			cc := &configurableChecker{
+				ip:         "255.0.0.1",
+				client:     quorumClient(tt.bodies),
+				strategies: map[string]Checker{},
+			}
+			err := cc.Configure(app.Config{
+				"strategy":      "quorum",
+				"quorum_judges": "https://self/ip, https://a/ip, https://b/ip",
+				"judge_trust":   tt.trust,
+			})
+			assert.NoError(t, err)
+			_, err = cc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestParseJudgeTrust(t *testing.T) {
+	out, err := parseJudgeTrust("https://a/ip 10,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"https://a/ip": 10}, out)
+
+	_, err = parseJudgeTrust("https://a/ip")
+	assert.EqualError(t, err, "invalid judge trust: https://a/ip")
+	_, err = parseJudgeTrust("https://a/ip 0")
+	assert.EqualError(t, err, "invalid judge trust: https://a/ip: 0")
+}
@@ -0,0 +1,192 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+)
+
+// Readiness reflects the ability of the checker to do any useful work:
+// it needs to know this IP and to reach enough judges directly.
+type Readiness struct {
+	Ready     bool
+	IP        bool
+	Reachable int
+	Required  int
+	Probed    time.Time
+	// Intercepted is the reason to believe, that the network of this host
+	// serves something else instead of judges, e.g. a captive portal
+	Intercepted string `json:",omitempty"`
+	// Dead are built-in judges, that are excluded from selection until
+	// they pass the direct probe again
+	Dead []string `json:",omitempty"`
+}
+
+type readiness struct {
+	sync.RWMutex
+	reachable   int
+	probed      time.Time
+	intercepted string
+}
+
+func (cc *configurableChecker) Ready() bool {
+	return cc.Readiness().Ready
+}
+
+func (cc *configurableChecker) Readiness() Readiness {
+	cc.readiness.RLock()
+	defer cc.readiness.RUnlock()
+	cfg := cc.current()
+	r := Readiness{
+		IP:          cfg.ip != "",
+		Reachable:   cc.readiness.reachable,
+		Required:    cfg.minJudges,
+		Probed:      cc.readiness.probed,
+		Intercepted: cc.readiness.intercepted,
+	}
+	if cc.dead != nil {
+		r.Dead = cc.dead.pages()
+	}
+	r.Ready = r.IP && !r.Probed.IsZero() && r.Reachable >= r.Required && r.Intercepted == ""
+	return r
+}
+
+// judges returns every built-in judge page, so that they could be probed
+func judges() (out []string) {
+	for _, j := range judgesThat(0, 0) {
+		out = append(out, j.page)
+	}
+	return out
+}
+
+// ProbeJudges requests every judge directly, without any proxy, and returns
+// the number of those, that have reported this IP back. When none of them
+// did and some were intercepted, it's the network of this host to blame.
+// Judges failing dead_judge_failures probes in a row are marked dead, and
+// the next passed probe brings them back.
+func (cc *configurableChecker) ProbeJudges(ctx context.Context) int {
+	log := app.Log.From(ctx)
+	threshold := cc.current().deadFailures
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reachable := map[string]time.Duration{}
+	var intercepted error
+	for _, page := range judges() {
+		wg.Add(1)
+		go func(page string) {
+			defer wg.Done()
+			start := time.Now()
+			err := cc.probeJudge(ctx, page)
+			cc.metrics.probed(page, err)
+			if threshold > 0 && cc.dead.probed(page, err, threshold) {
+				if err != nil {
+					log.Warn().Str("judge", page).Int("failures", threshold).
+						Msg("judge is dead and excluded from selection")
+				} else {
+					log.Info().Str("judge", page).Msg("dead judge has recovered")
+				}
+			}
+			if err != nil {
+				log.Warn().Err(err).Str("judge", page).Msg("judge is not reachable")
+				if errors.Is(err, errCaptivePortal) {
+					mu.Lock()
+					intercepted = err
+					mu.Unlock()
+				}
+				return
+			}
+			mu.Lock()
+			reachable[page] = time.Since(start)
+			mu.Unlock()
+		}(page)
+	}
+	wg.Wait()
+	cc.current().warm.keep(reachable)
+	cc.readiness.Lock()
+	cc.readiness.reachable = len(reachable)
+	cc.readiness.probed = time.Now()
+	cc.readiness.intercepted = ""
+	if len(reachable) == 0 && intercepted != nil {
+		log.Error().Err(intercepted).Msg("judges are not reachable from this host")
+		cc.readiness.intercepted = intercepted.Error()
+	}
+	cc.readiness.Unlock()
+	return len(reachable)
+}
+
+func (cc *configurableChecker) probeJudge(ctx context.Context, page string) error {
+	cfg := cc.current()
+	ctx = withConfig(ctx, cfg)
+	req, err := http.NewRequestWithContext(ctx, "GET", page, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", randomAgent(ctx))
+	client := cfg.warm.clientFor(page)
+	if client == nil {
+		client = cfg.direct
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return interceptedTLS(err)
+	}
+	defer res.Body.Close()
+	err = detectCaptivePortal(page, res, cfg.directRoots)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("status %d: %s", res.StatusCode, truncatedBody(ctx, string(body)))
+	}
+	if !strings.Contains(string(body), cfg.ip) {
+		return fmt.Errorf("no %s found: %s", cfg.ip, truncatedBody(ctx, string(body)))
+	}
+	return nil
+}
+
+func (cc *configurableChecker) Start(ctx app.Context) {
+	cfg := cc.current()
+	go cc.probeJudgesEvery(ctx.Ctx(), cfg.probeInterval)
+	if cfg.warm != nil {
+		go cc.refreshWarmEvery(ctx.Ctx(), cfg.warm.interval)
+	}
+}
+
+func (cc *configurableChecker) probeJudgesEvery(ctx context.Context, interval time.Duration) {
+	cc.ProbeJudges(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cc.ProbeJudges(ctx)
+		}
+	}
+}
+
+// HttpGet reports readiness of the checker for health checks
+func (cc *configurableChecker) HttpGet(_ *http.Request) (interface{}, error) {
+	r := cc.Readiness()
+	if r.Intercepted != "" {
+		return nil, fmt.Errorf("checker is not ready: %s", r.Intercepted)
+	}
+	if !r.Ready {
+		// any non-2xx status is enough for health checks
+		return nil, fmt.Errorf("checker is not ready: %d of %d judges reachable",
+			r.Reachable, r.Required)
+	}
+	return r, nil
+}
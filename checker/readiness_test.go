@@ -0,0 +1,46 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness(t *testing.T) {
+	reachable := map[string]bool{
+		"https://ifconfig.me/ip":  true,
+		"https://ipinfo.io/ip":    true,
+		"https://api.ipify.org/":  true,
+		"https://ifconfig.me/all": true,
+	}
+	cc := &configurableChecker{
+		ip: "255.0.0.1",
+		client: clientFunc(func(req *http.Request) (*http.Response, error) {
+			b := "blocked"
+			if reachable[req.URL.String()] {
+				b = "255.0.0.1"
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       body(b),
+			}, nil
+		}),
+		readiness: &readiness{},
+	}
+	cc.use(checkerConfig{minJudges: 5})
+	assert.False(t, cc.Ready(), "not probed yet")
+
+	n := cc.ProbeJudges(context.Background())
+	assert.Equal(t, 4, n)
+	assert.False(t, cc.Ready())
+	_, err := cc.HttpGet(nil)
+	assert.EqualError(t, err, "checker is not ready: 4 of 5 judges reachable")
+
+	cc.use(checkerConfig{minJudges: 4})
+	assert.True(t, cc.Ready())
+	r, err := cc.HttpGet(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, r.(Readiness).Reachable)
+}
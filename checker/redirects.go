@@ -0,0 +1,26 @@
+package checker
+
+import (
+	"fmt"
+	"net/http"
+)
+
+var errRedirectNotAllowed = fmt.Errorf("redirect not allowed")
+
+// redirectPolicy follows up to max redirects of the judge. Redirects beyond
+// that, or the ones changing the scheme when it's disallowed, fail the check
+// distinctly, so that redirect-based blocks are detected.
+func redirectPolicy(max int, crossScheme bool) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		prev := via[len(via)-1]
+		if len(via) > max {
+			return fmt.Errorf("%w: more than %d to %s", errRedirectNotAllowed,
+				max, redact(req.URL.String()))
+		}
+		if !crossScheme && req.URL.Scheme != prev.URL.Scheme {
+			return fmt.Errorf("%w: %s to %s", errRedirectNotAllowed,
+				prev.URL.Scheme, redact(req.URL.String()))
+		}
+		return nil
+	}
+}
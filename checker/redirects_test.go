@@ -0,0 +1,113 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	req := func(page string) *http.Request {
+		r, _ := http.NewRequest("GET", page, nil)
+		return r
+	}
+	for i, tt := range []struct {
+		max         int
+		crossScheme bool
+		via         []string
+		next        string
+		expectErr   string
+	}{
+		{
+			max:         1,
+			crossScheme: true,
+			via:         []string{"http://judge/ip"},
+			next:        "https://judge/ip",
+		},
+		{
+			max:  1,
+			via:  []string{"http://judge/ip"},
+			next: "http://judge/raw",
+		},
+		{
+			max:       1,
+			via:       []string{"http://judge/ip"},
+			next:      "https://judge/ip",
+			expectErr: "redirect not allowed: http to https://judge/ip",
+		},
+		{
+			max:         0,
+			crossScheme: true,
+			via:         []string{"http://judge/ip"},
+			next:        "http://portal/login",
+			expectErr:   "redirect not allowed: more than 0 to http://portal/login",
+		},
+		{
+			max:         1,
+			crossScheme: true,
+			via:         []string{"http://judge/ip", "http://judge/raw"},
+			next:        "http://judge/text",
+			expectErr:   "redirect not allowed: more than 1 to http://judge/text",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var via []*http.Request
+			for _, v := range tt.via {
+				via = append(via, req(v))
+			}
+			err := redirectPolicy(tt.max, tt.crossScheme)(req(tt.next), via)
+			if tt.expectErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.expectErr)
+			assert.True(t, errors.Is(err, errRedirectNotAllowed))
+		})
+	}
+}
+
+func TestConfigureRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ip" {
+			rw.Write([]byte("1.2.3.4"))
+			return
+		}
+		http.Redirect(rw, r, "/ip", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	cc := configurableChecker{
+
+		ip:     "255.0.0.1",
+		client: &http.Client{},
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	for i, tt := range []struct {
+		max       string
+		expectErr bool
+	}{
+		{max: "1"},
+		{max: "0", expectErr: true},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			err := cc.Configure(app.Config{
+				"max_redirects": tt.max,
+			})
+			assert.NoError(t, err)
+			res, err := cc.current().client.(*http.Client).Get(srv.URL + "/start")
+			if tt.expectErr {
+				assert.True(t, errors.Is(err, errRedirectNotAllowed))
+				return
+			}
+			assert.NoError(t, err)
+			res.Body.Close()
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+const regionPrefix = "region_"
+
+// regional checks the proxy against one judge per region concurrently,
+// so that proxies could be assigned to the region they perform best in.
+type regional map[string]federated
+
+// configureRegions reads judges tagged with a region from region_<name>
+// keys, that hold comma-separated lists of ip-only judges
+func configureRegions(conf app.Config, client httpClient, ip string) regional {
+	out := regional{}
+	for k := range conf {
+		if !strings.HasPrefix(k, regionPrefix) {
+			continue
+		}
+		region := strings.TrimPrefix(k, regionPrefix)
+		var f federated
+		for _, page := range strings.Split(conf.StrOr(k, ""), ",") {
+			page = strings.TrimSpace(page)
+			if page == "" {
+				continue
+			}
+			f.judges = append(f.judges, &simple{
+				client: client,
+				page:   page,
+				ip:     ip,
+			})
+		}
+		if len(f.judges) == 0 {
+			continue
+		}
+		f.next = new(uint32)
+		out[region] = f
+	}
+	return out
+}
+
+// parseJudgeRegions parses comma-separated pairs of judge page and region,
+// where the judge is located, e.g. "https://ifconfig.me/ip us"
+func parseJudgeRegions(raw string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, v := range strings.Split(raw, ",") {
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid judge region: %s", strings.TrimSpace(v))
+		}
+		out[fields[0]] = fields[1]
+	}
+	return out, nil
+}
+
+func (r regional) regions() (out []string) {
+	for k := range r {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (r regional) withSelection(s selection) Checker {
+	out := regional{}
+	for k, v := range r {
+		out[k] = v.selectBy(s)
+	}
+	return out
+}
+
+// Check passes, if at least one region has passed, and returns the fastest
+// latency. Per-region latencies are recorded for the CheckResult.
+func (r regional) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+	type outcome struct {
+		region string
+		t      time.Duration
+		err    error
+	}
+	results := make(chan outcome, len(r))
+	var wg sync.WaitGroup
+	for region, f := range r {
+		wg.Add(1)
+		go func(region string, f federated) {
+			defer wg.Done()
+			t, err := f.Check(ctx, proxy)
+			results <- outcome{region, t, err}
+		}(region, f)
+	}
+	wg.Wait()
+	close(results)
+	var fastest time.Duration
+	var passed bool
+	var failures []string
+	var lastErr error
+	for v := range results {
+		if v.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", v.region, v.err))
+			lastErr = v.err
+			continue
+		}
+		observed(ctx).latency(v.region, v.t)
+		if !passed || v.t < fastest {
+			fastest = v.t
+		}
+		passed = true
+	}
+	if passed {
+		return fastest, nil
+	}
+	if len(failures) == 1 {
+		return 0, lastErr
+	}
+	sort.Strings(failures)
+	return 0, fmt.Errorf("all regions failed: %s", strings.Join(failures, "; "))
+}
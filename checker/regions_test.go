@@ -0,0 +1,107 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func regionalClient(alive ...string) clientFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		for _, v := range alive {
+			if req.URL.Host == v {
+				return &http.Response{
+					StatusCode: 200,
+					Body:       body("1.2.3.4"),
+				}, nil
+			}
+		}
+		return nil, fmt.Errorf("%s is down", req.URL.Host)
+	}
+}
+
+func TestRegionalCheck(t *testing.T) {
+	conf := app.Config{
+		"region_us":   "https://us1/ip, https://us2/ip",
+		"region_eu":   "https://eu1/ip",
+		"region_apac": "",
+	}
+	r := configureRegions(conf, regionalClient("us1", "us2", "eu1"), "255.0.0.1")
+	assert.Equal(t, []string{"eu", "us"}, r.regions())
+	assert.Len(t, r["us"].judges, 2)
+
+	ctx, o := observe(context.Background())
+	_, err := r.Check(ctx, pmux.HttpProxy("127.0.0.1:23"))
+	assert.NoError(t, err)
+	latencies := o.latencies()
+	assert.Len(t, latencies, 2)
+	assert.Contains(t, latencies, "us")
+	assert.Contains(t, latencies, "eu")
+}
+
+func TestRegionalCheckPartiallyFails(t *testing.T) {
+	conf := app.Config{
+		"region_us": "https://us1/ip",
+		"region_eu": "https://eu1/ip",
+	}
+	r := configureRegions(conf, regionalClient("eu1"), "255.0.0.1")
+	ctx, o := observe(context.Background())
+	_, err := r.Check(ctx, pmux.HttpProxy("127.0.0.1:23"))
+	assert.NoError(t, err)
+	assert.Len(t, o.latencies(), 1)
+	assert.Contains(t, o.latencies(), "eu")
+
+	r = configureRegions(conf, regionalClient(), "255.0.0.1")
+	_, err = r.Check(context.Background(), pmux.HttpProxy("127.0.0.1:23"))
+	assert.EqualError(t, err, "all regions failed: eu: eu1 is down; us: us1 is down")
+}
+
+func TestConfigureRegionalStrategy(t *testing.T) {
+	c := configurableChecker{
+		ip:         "255.0.0.1",
+		client:     http.DefaultClient,
+		strategies: map[string]Checker{},
+	}
+	err := c.Configure(app.Config{
+		"strategy":  "regional",
+		"region_eu": "https://eu1/ip",
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, regional{}, c.current().strategies["regional"])
+}
+
+func TestJudgeRegions(t *testing.T) {
+	c := configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": federated{
+				judges: []*simple{
+					{client: regionalClient("us1"), page: "https://us1/ip", ip: "255.0.0.1"},
+				},
+			},
+		},
+	}
+	err := c.Configure(app.Config{
+		"judge_regions": "https://us1/ip us",
+	})
+	assert.NoError(t, err)
+	r := c.Result(context.Background(), pmux.HttpProxy("127.0.0.1:23"))
+	assert.NoError(t, r.Err)
+	assert.Len(t, r.Regions, 1)
+	assert.Contains(t, r.Regions, "us")
+}
+
+func TestParseJudgeRegions(t *testing.T) {
+	out, err := parseJudgeRegions("https://us1/ip us, https://eu1/ip eu,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"https://us1/ip": "us", "https://eu1/ip": "eu"}, out)
+
+	_, err = parseJudgeRegions("https://us1/ip")
+	assert.EqualError(t, err, "invalid judge region: https://us1/ip")
+}
@@ -0,0 +1,95 @@
+package checker
+
+import (
+	"sort"
+	"strings"
+)
+
+// judgeCapability is what the judge reports back about the request
+type judgeCapability uint8
+
+const (
+	reportsIP judgeCapability = 1 << iota
+	reportsHeaders
+	reportsTLS
+	reportsHTTPVersion
+)
+
+// judgeCapabilityNames are how capabilities are configured
+var judgeCapabilityNames = map[string]judgeCapability{
+	"ip":           reportsIP,
+	"headers":      reportsHeaders,
+	"tls":          reportsTLS,
+	"http_version": reportsHTTPVersion,
+}
+
+func (c judgeCapability) String() string {
+	var names []string
+	for name, v := range judgeCapabilityNames {
+		if c&v != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, "+")
+}
+
+// judgeEntry is a public judge along with what it reports
+type judgeEntry struct {
+	page string
+	// valid is the marker of complete response for judges, that report
+	// more than a bare IP
+	valid        string
+	capabilities judgeCapability
+}
+
+func (j judgeEntry) has(c judgeCapability) bool {
+	return j.capabilities&c == c
+}
+
+// registry is the single list of public judges, that strategies compose from
+var registry = []judgeEntry{
+	// these check for ext ip, but don't show headers
+	{page: "https://ifconfig.me/ip", capabilities: reportsIP}, // okhttp
+	//{page: "https://ifconfig.io/ip", capabilities: reportsIP},
+	{page: "https://myexternalip.com/raw", capabilities: reportsIP}, // okhttp
+	{page: "https://ipv4.icanhazip.com/", capabilities: reportsIP},  // okhttp
+	{page: "https://ipinfo.io/ip", capabilities: reportsIP},         // okhttp
+	{page: "https://api.ipify.org/", capabilities: reportsIP},       // okhttp
+	{page: "https://wtfismyip.com/text", capabilities: reportsIP},   // okhttp
+	// checks for X-Forwarded-For and alikes
+	{
+		page:         "https://ifconfig.me/all",
+		valid:        "user_agent",
+		capabilities: reportsIP | reportsHeaders,
+	},
+	{
+		page:         "https://ifconfig.io/all.json",
+		valid:        "ifconfig_hostname",
+		capabilities: reportsIP | reportsHeaders,
+	},
+}
+
+// judgesThat returns judges with all of required and none of excluded
+// capabilities, ordered by page, so that fixed-order selection is stable
+func judgesThat(required, excluded judgeCapability) []judgeEntry {
+	return entriesThat(registry, required, excluded)
+}
+
+func entriesThat(entries []judgeEntry, required, excluded judgeCapability) (out []judgeEntry) {
+	for _, j := range entries {
+		if !j.has(required) || j.capabilities&excluded != 0 {
+			continue
+		}
+		out = append(out, j)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].page < out[j].page
+	})
+	return out
+}
+
+// ipOnly judges are the cheapest and the least informative ones
+func ipOnly() []judgeEntry {
+	return judgesThat(reportsIP, reportsHeaders|reportsTLS|reportsHTTPVersion)
+}
@@ -0,0 +1,55 @@
+package checker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJudgesThat(t *testing.T) {
+	for i, tt := range []struct {
+		required judgeCapability
+		excluded judgeCapability
+		expected []string
+	}{
+		{
+			required: reportsHeaders,
+			expected: []string{
+				"https://ifconfig.io/all.json",
+				"https://ifconfig.me/all",
+			},
+		},
+		{
+			required: reportsIP,
+			excluded: reportsHeaders,
+			expected: []string{
+				"https://api.ipify.org/",
+				"https://ifconfig.me/ip",
+				"https://ipinfo.io/ip",
+				"https://ipv4.icanhazip.com/",
+				"https://myexternalip.com/raw",
+				"https://wtfismyip.com/text",
+			},
+		},
+		{
+			required: reportsTLS,
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var pages []string
+			for _, j := range judgesThat(tt.required, tt.excluded) {
+				pages = append(pages, j.page)
+			}
+			assert.Equal(t, tt.expected, pages)
+		})
+	}
+}
+
+func TestHeadersStrategyUsesHeaderJudges(t *testing.T) {
+	headers := newFederated(judgesThat(reportsHeaders, 0), nil, "")
+	assert.Len(t, headers.judges, 2)
+	for _, j := range headers.judges {
+		assert.NotEmpty(t, j.valid, j.page)
+	}
+}
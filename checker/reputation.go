@@ -0,0 +1,140 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+)
+
+// Reputation is the verdict of an IP-reputation API on the exit IP
+type Reputation struct {
+	Score float64
+	Flags []string `json:",omitempty"`
+}
+
+// reputation queries the configured API with the exit IP of proxies, that
+// passed the check. Verdicts are cached by IP, and API failures never fail
+// the check itself.
+type reputation struct {
+	sync.Mutex
+	client httpClient
+	api    string
+	score  string
+	flags  []string
+	ttl    time.Duration
+	cache  map[string]cachedReputation
+	now    func() time.Time
+}
+
+type cachedReputation struct {
+	*Reputation
+	at time.Time
+}
+
+func configureReputation(conf app.Config, client httpClient) (*reputation, error) {
+	api := conf.StrOr("reputation_api", "")
+	if api == "" {
+		return nil, nil
+	}
+	if !strings.Contains(api, "{ip}") {
+		return nil, fmt.Errorf("reputation_api has no {ip} placeholder")
+	}
+	var flags []string
+	for _, v := range strings.Split(conf.StrOr("reputation_flags", ""), ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			flags = append(flags, v)
+		}
+	}
+	return &reputation{
+		client: client,
+		api:    api,
+		score:  conf.StrOr("reputation_score", "fraud_score"),
+		flags:  flags,
+		ttl:    conf.DurOr("reputation_ttl", 24*time.Hour),
+		cache:  map[string]cachedReputation{},
+		now:    time.Now,
+	}, nil
+}
+
+func (rep *reputation) Lookup(ctx context.Context, ip string) (*Reputation, error) {
+	rep.Lock()
+	cached, ok := rep.cache[ip]
+	rep.Unlock()
+	if ok && rep.now().Sub(cached.at) < rep.ttl {
+		return cached.Reputation, nil
+	}
+	page := strings.ReplaceAll(rep.api, "{ip}", url.QueryEscape(ip))
+	req, err := http.NewRequestWithContext(ctx, "GET", page, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := rep.client.Do(req)
+	if err != nil {
+		// API keys are usually in the query
+		ue, ok := err.(*url.Error)
+		if ok {
+			err = ue.Err
+		}
+		return nil, fmt.Errorf("reputation api: %w", err)
+	}
+	defer res.Body.Close()
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("reputation api: status %d: %s",
+			res.StatusCode, truncatedBody(ctx, string(raw)))
+	}
+	var decoded any
+	err = json.Unmarshal(raw, &decoded)
+	if err != nil {
+		return nil, fmt.Errorf("reputation api: %w", err)
+	}
+	score, ok := jsonPath(decoded, rep.score).(float64)
+	if !ok {
+		return nil, fmt.Errorf("reputation api: no %s found: %s",
+			rep.score, truncatedBody(ctx, string(raw)))
+	}
+	verdict := &Reputation{Score: score}
+	for _, flag := range rep.flags {
+		switch x := jsonPath(decoded, flag).(type) {
+		case bool:
+			if !x {
+				continue
+			}
+		case float64:
+			if x <= 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		verdict.Flags = append(verdict.Flags, flag)
+	}
+	rep.Lock()
+	rep.cache[ip] = cachedReputation{verdict, rep.now()}
+	rep.Unlock()
+	return verdict, nil
+}
+
+// jsonPath returns the value at dot-separated path or nil
+func jsonPath(v any, path string) any {
+	for _, k := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
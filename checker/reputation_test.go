@@ -0,0 +1,121 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureReputation(t *testing.T) {
+	rep, err := configureReputation(app.Config{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, rep)
+
+	_, err = configureReputation(app.Config{
+		"reputation_api": "https://rep.local/check",
+	}, nil)
+	assert.EqualError(t, err, "reputation_api has no {ip} placeholder")
+}
+
+func TestReputationLookup(t *testing.T) {
+	for i, tt := range []struct {
+		status    int
+		body      string
+		expect    *Reputation
+		expectErr string
+	}{
+		{
+			status: 200,
+			body:   `{"fraud_score": 85, "proxy": true, "vpn": false, "abuse": {"recent": 3}}`,
+			expect: &Reputation{Score: 85, Flags: []string{"proxy", "abuse.recent"}},
+		},
+		{
+			status: 200,
+			body:   `{"fraud_score": 0}`,
+			expect: &Reputation{},
+		},
+		{
+			status:    200,
+			body:      `{"score": 1}`,
+			expectErr: "reputation api: no fraud_score found: {\n  \"score\": 1\n}",
+		},
+		{
+			status:    429,
+			body:      `quota exceeded`,
+			expectErr: `reputation api: status 429: quota exceeded`,
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var requested []string
+			rep, err := configureReputation(app.Config{
+				"reputation_api":   "https://rep.local/{ip}?key=secret",
+				"reputation_flags": "proxy, vpn, abuse.recent, missing",
+			}, clientFunc(func(req *http.Request) (*http.Response, error) {
+				requested = append(requested, req.URL.String())
+				return &http.Response{
+					StatusCode: tt.status,
+					Body:       body(tt.body),
+				}, nil
+			}))
+			assert.NoError(t, err)
+			ctx := context.Background()
+			verdict, err := rep.Lookup(ctx, "1.2.3.4")
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, verdict)
+
+			// cached by IP
+			_, err = rep.Lookup(ctx, "1.2.3.4")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"https://rep.local/1.2.3.4?key=secret"}, requested)
+		})
+	}
+}
+
+func TestReputationHidesApiKey(t *testing.T) {
+	rep, err := configureReputation(app.Config{
+		"reputation_api": "https://rep.local/{ip}?key=secret",
+	}, &http.Client{Transport: clientTransport(func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("connection refused")
+	})})
+	assert.NoError(t, err)
+	_, err = rep.Lookup(context.Background(), "1.2.3.4")
+	assert.EqualError(t, err, "reputation api: connection refused")
+}
+
+type clientTransport func(req *http.Request) (*http.Response, error)
+
+func (f clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestResultDegradesOnReputationFailure(t *testing.T) {
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	cc := &configurableChecker{
+		ip: "255.0.0.1",
+		client: clientFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: body("1.2.3.4")}, nil
+		}),
+	}
+	cc.strategies = map[string]Checker{
+		"simple": federated{judges: []*simple{{client: cc.client, page: "http://judge.local/ip", ip: cc.ip}}},
+	}
+	rep, _ := configureReputation(app.Config{
+		"reputation_api": "https://rep.local/{ip}",
+	}, clientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 500, Body: body("")}, nil
+	}))
+	cc.use(checkerConfig{reputation: rep})
+	r := cc.Result(context.Background(), proxy)
+	assert.True(t, r.Ok())
+	assert.Equal(t, "1.2.3.4", r.ExitIP)
+	assert.Nil(t, r.Reputation)
+}
@@ -0,0 +1,345 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// CheckResult is the detailed outcome of a single proxy check
+type CheckResult struct {
+	ID      string
+	Proxy   pmux.Proxy
+	Speed   time.Duration
+	Failure string `json:",omitempty"`
+	Err     error  `json:"-"`
+	// Anonymity is either "anonymous" or "transparent", if it's known
+	Anonymity string `json:",omitempty"`
+	// Labels are passed with WithLabels or CheckRequest and never read
+	Labels map[string]string `json:",omitempty"`
+
+	// ExitIP is the address, that judges have seen the proxy coming from
+	ExitIP string `json:",omitempty"`
+	// ExitIPs are all distinct addresses seen across passes and judges
+	// during the check, where more than one means a multi-exit proxy
+	ExitIPs []string `json:",omitempty"`
+	// DirectExit is set when the proxy exits from the same IP it listens on,
+	// so it gives no additional anonymity layer, unlike chained proxies.
+	DirectExit bool `json:",omitempty"`
+	// Rotating is set when twopass strategy has seen different exit IPs
+	Rotating bool `json:",omitempty"`
+	// Regions is the latency to judges per region for regional strategy
+	// and judges tagged with judge_regions
+	Regions map[string]time.Duration `json:",omitempty"`
+	// GeoMismatch is why the geo lookup of exit IP contradicts Regions
+	GeoMismatch string `json:",omitempty"`
+
+	// JudgeAttempts is the number of requests to judges across all passes,
+	// RateLimited is how many of them were rate-limited, and Retries is how
+	// many times the check or the request was repeated before the verdict
+	JudgeAttempts int `json:",omitempty"`
+	RateLimited   int `json:",omitempty"`
+	Retries       int `json:",omitempty"`
+
+	// ConnectHeaders are the headers of the response to CONNECT, like Via
+	// or Server, which identify the proxy software, when the check or the
+	// probes have tunneled through the proxy, e.g. to HTTPS judges
+	ConnectHeaders http.Header `json:",omitempty"`
+	// ALPN is the protocol, that the judge has negotiated through the proxy
+	ALPN string `json:",omitempty"`
+	// TCPFingerprint is what the fingerprint judge has seen of the proxy
+	TCPFingerprint *TCPFingerprint `json:",omitempty"`
+
+	// largest request header and body sizes, that reached the judge
+	HeaderLimit int `json:",omitempty"`
+	BodyLimit   int `json:",omitempty"`
+	// ResponseLimit is the largest response, that arrived intact
+	ResponseLimit int `json:",omitempty"`
+
+	Capabilities Capability
+	// AltersEncoding is set when proxy has changed Content-Encoding or
+	// the bytes of compressed response
+	AltersEncoding bool `json:",omitempty"`
+	// AltersTLSExtensions is set when the judge has received the ClientHello
+	// with extensions stripped, added, or reordered
+	AltersTLSExtensions bool `json:",omitempty"`
+	// Methods tells which of probe_methods were forwarded to the judge,
+	// where false means the proxy has rejected or rewritten the method
+	Methods map[string]bool `json:",omitempty"`
+
+	// Throttled is why hot_destination was throttled, while the judge was not
+	Throttled string `json:",omitempty"`
+
+	// Reputation is the verdict of the reputation API on the exit IP
+	Reputation *Reputation `json:",omitempty"`
+
+	// Confidence is the success rate of all checks of this proxy so far,
+	// penalized for flapping between passing and failing
+	Confidence float64
+	// Verified is set, once the proxy has passed verified_judges distinct
+	// judges over verified_checks checks
+	Verified bool `json:",omitempty"`
+	// CaptchaProne is set, once the proxy has triggered captchas in at least
+	// captcha_rate of checks, so it's better kept away from anti-bot targets
+	CaptchaProne bool `json:",omitempty"`
+
+	// Outcome is the fingerprint of anonymity, capabilities, exit subnet,
+	// and rough latency, that changes only when the behavior does
+	Outcome string `json:",omitempty"`
+}
+
+// Ok is derived from Failure as well, as errors are not persisted
+func (r CheckResult) Ok() bool {
+	return r.Err == nil && r.Failure == ""
+}
+
+// ProxyID is a stable identifier of the proxy across runs, that is derived
+// from normalized scheme://ip:port form of it, so that external stores can
+// key on it consistently.
+func ProxyID(proxy pmux.Proxy) string {
+	h := fnv.New64a()
+	h.Write([]byte(proxy.String()))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func newResult(proxy pmux.Proxy, speed time.Duration, err error) CheckResult {
+	r := CheckResult{
+		ID:    ProxyID(proxy),
+		Proxy: proxy,
+		Speed: speed,
+		Err:   err,
+	}
+	if err != nil {
+		r.Failure = err.Error()
+	}
+	switch anonymityLevel(err) {
+	case outcomeAnonymous:
+		r.Anonymity = Anonymous
+	case outcomeTransparent:
+		r.Anonymity = Transparent
+	}
+	return r
+}
+
+// Result performs the check with the configured strategy and returns
+// the detailed outcome of it
+func (cc *configurableChecker) Result(ctx context.Context, proxy pmux.Proxy) CheckResult {
+	ctx, cfg, release := cc.acquire(ctx)
+	defer release()
+	// probes and hot destination share the judge budget of the check
+	ctx = withBudget(ctx, cfg.maxJudges)
+	ctx, o := observe(ctx)
+	speed, err := cc.checkWith(ctx, cfg, proxy)
+	r := newResult(proxy, speed, err)
+	r.Labels = labelsFrom(ctx)
+	r.observed(o)
+	if cc.scoring != nil {
+		r.Confidence = cc.scoring.confidence(cfg.scorePolicy, proxy)
+		r.Verified = cc.scoring.verified(cfg.scorePolicy, proxy)
+		r.CaptchaProne = cc.scoring.captchaProne(cfg.scorePolicy, proxy)
+	}
+	if err == nil {
+		cc.enrich(ctx, cfg, proxy, &r)
+		// probes tunnel through the proxy as well
+		r.ConnectHeaders = o.connectHeaders()
+	}
+	if err == nil && cfg.geo != nil {
+		mismatch := cfg.geo.verify(r.ExitIP, r.Regions)
+		if mismatch != nil {
+			r.GeoMismatch = mismatch.Error()
+		}
+	}
+	if cfg.outcomeFingerprint {
+		r.Outcome = outcomeFingerprint(r)
+	}
+	cfg.store(ctx, r)
+	return r
+}
+
+// enrich runs capability probes and reputation lookup for passed proxies
+func (cc *configurableChecker) enrich(ctx context.Context, cfg *checkerConfig, proxy pmux.Proxy, r *CheckResult) {
+	for _, p := range cfg.probes {
+		err := p.Probe(ctx, proxy, r)
+		if err != nil {
+			log := app.Log.From(ctx)
+			log.Debug().Err(redactErr(err)).Msg("capability probe failed")
+		}
+	}
+	if cfg.hot != nil {
+		var err error
+		r.Throttled, err = cfg.hot.throttled(ctx, proxy, r.Speed)
+		if err != nil {
+			log := app.Log.From(ctx)
+			log.Debug().Err(redactErr(err)).Msg("hot destination failed")
+		}
+	}
+	if cfg.reputation != nil && r.ExitIP != "" {
+		var err error
+		r.Reputation, err = cfg.reputation.Lookup(ctx, r.ExitIP)
+		if err != nil {
+			log := app.Log.From(ctx)
+			log.Debug().Err(redactErr(err)).Msg("reputation lookup failed")
+		}
+	}
+}
+
+// observed fills in what strategies have seen during the check
+func (r *CheckResult) observed(o *observation) {
+	exits := o.exitIPs()
+	if len(exits) > 0 {
+		r.ExitIP = exits[0]
+		r.ExitIPs = exits
+	}
+	r.DirectExit = isDirectExit(r.Proxy, exits)
+	r.Regions = o.latencies()
+	r.Rotating = o.isRotating()
+	c := o.spent()
+	r.JudgeAttempts = c.attempts
+	r.RateLimited = c.rateLimited
+	r.Retries = c.retries
+	r.ConnectHeaders = o.connectHeaders()
+	r.ALPN = o.negotiatedProtocol()
+	r.TCPFingerprint = o.tcpFingerprint()
+}
+
+// CheckAllStrategies runs every configured strategy once against the proxy,
+// so that verdicts of them could be compared side by side for borderline
+// proxies. It neither affects scores nor runs capability probes.
+func (cc *configurableChecker) CheckAllStrategies(ctx context.Context, proxy pmux.Proxy) map[string]CheckResult {
+	ctx, cfg, release := cc.acquire(ctx)
+	defer release()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	out := map[string]CheckResult{}
+	for name := range cfg.strategies {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			only := *cfg
+			only.strategy = name
+			only.shadow = nil
+			ctx, o := detach(ctx)
+			speed, err := cc.check(ctx, &only, proxy)
+			r := newResult(proxy, speed, redactErr(err))
+			r.observed(o)
+			mu.Lock()
+			out[name] = r
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	return out
+}
+
+func isDirectExit(proxy pmux.Proxy, exits []string) bool {
+	own := proxy.IP().String()
+	for _, v := range exits {
+		if v == own {
+			return true
+		}
+	}
+	return false
+}
+
+// Explain renders the verdict with its reasons in a single line, so that
+// operators don't have to decode structured fields
+func (r CheckResult) Explain() string {
+	switch {
+	case r.Anonymity == Transparent:
+		return fmt.Sprintf("transparent: %s%s", r.Failure, r.explainAttempts(" (", ")"))
+	case r.Err != nil && isTimeout(r.Err):
+		return fmt.Sprintf("retry later: %s%s", r.Failure, r.explainAttempts(" (", ")"))
+	case r.Failure != "":
+		return fmt.Sprintf("failed: %s%s", r.Failure, r.explainAttempts(" (", ")"))
+	}
+	parts := []string{r.Speed.Round(time.Millisecond).String()}
+	if attempts := r.explainAttempts("", ""); attempts != "" {
+		parts = append(parts, attempts)
+	}
+	if r.ExitIP != "" {
+		parts = append(parts, "exit "+r.ExitIP)
+	}
+	if len(r.ExitIPs) > 1 {
+		parts = append(parts, fmt.Sprintf("%d exits", len(r.ExitIPs)))
+	}
+	if r.Rotating {
+		parts = append(parts, "rotating")
+	}
+	if r.DirectExit {
+		parts = append(parts, "direct exit")
+	}
+	var regions []string
+	for region := range r.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	for _, region := range regions {
+		parts = append(parts, fmt.Sprintf("%s %s", region,
+			r.Regions[region].Round(time.Millisecond)))
+	}
+	if r.GeoMismatch != "" {
+		parts = append(parts, r.GeoMismatch)
+	}
+	if r.Capabilities != 0 {
+		parts = append(parts, r.Capabilities.String())
+	}
+	if r.AltersEncoding {
+		parts = append(parts, "alters encoding")
+	}
+	if r.AltersTLSExtensions {
+		parts = append(parts, "alters TLS extensions")
+	}
+	var unsupported []string
+	for method, forwarded := range r.Methods {
+		if !forwarded {
+			unsupported = append(unsupported, method)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		parts = append(parts, "unsupported methods: "+strings.Join(unsupported, ","))
+	}
+	if r.Throttled != "" {
+		parts = append(parts, "throttled on hot destination: "+r.Throttled)
+	}
+	if r.Reputation != nil {
+		rep := fmt.Sprintf("reputation %g", r.Reputation.Score)
+		if len(r.Reputation.Flags) > 0 {
+			rep += fmt.Sprintf(" (%s)", strings.Join(r.Reputation.Flags, ","))
+		}
+		parts = append(parts, rep)
+	}
+	if r.Confidence > 0 {
+		parts = append(parts, fmt.Sprintf("confidence %.2f", r.Confidence))
+	}
+	anonymity := r.Anonymity
+	if anonymity == "" {
+		// e.g. results read back from the store
+		anonymity = "unknown anonymity"
+	}
+	return fmt.Sprintf("%s: %s", anonymity, strings.Join(parts, ", "))
+}
+
+// explainAttempts renders judge attempts and retries between prefix and
+// suffix, or nothing, if neither were counted
+func (r CheckResult) explainAttempts(prefix, suffix string) string {
+	var parts []string
+	if r.JudgeAttempts > 0 {
+		parts = append(parts, fmt.Sprintf("%d judge attempts", r.JudgeAttempts))
+	}
+	if r.Retries > 0 {
+		parts = append(parts, fmt.Sprintf("%d retries", r.Retries))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return prefix + strings.Join(parts, ", ") + suffix
+}
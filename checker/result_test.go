@@ -0,0 +1,274 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyIDIsStable(t *testing.T) {
+	a := ProxyID(pmux.HttpProxy("127.0.0.1:8080"))
+	b := ProxyID(pmux.NewProxy("127.0.0.1:8080", "http"))
+	assert.Equal(t, a, b)
+	assert.Len(t, a, 16)
+
+	c := ProxyID(pmux.Socks5Proxy("127.0.0.1:8080"))
+	assert.NotEqual(t, a, c)
+}
+
+func TestResult(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip: "255.0.0.1",
+				client: staticResponseClient{
+					err: fmt.Errorf("nope"),
+				},
+			},
+		},
+	}
+	proxy := pmux.HttpProxy("127.0.0.1:23")
+	r := cc.Result(context.Background(), proxy)
+	assert.False(t, r.Ok())
+	assert.Equal(t, ProxyID(proxy), r.ID)
+	assert.Equal(t, proxy, r.Proxy)
+	assert.Equal(t, "nope", r.Failure)
+}
+
+func TestDirectExit(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip:     "255.0.0.1",
+				page:   "http://judge.local/ip",
+				client: client,
+			},
+		},
+	}
+	r := cc.Result(context.Background(), proxy)
+	assert.True(t, r.Ok(), r.Failure)
+	assert.Equal(t, "127.0.0.1", r.ExitIP)
+	assert.True(t, r.DirectExit)
+
+	cc.use(checkerConfig{rejectDirectExit: true})
+	r = cc.Result(context.Background(), proxy)
+	assert.Equal(t, errDirectExit, r.Err)
+}
+
+func TestReportedIPs(t *testing.T) {
+	assert.Equal(t, []string{"1.2.3.4"}, reportedIPs("1.2.3.4\n"))
+	assert.Equal(t, []string{"1.2.3.4"}, reportedIPs(`{"ip": "1.2.3.4", "port": 1234}`))
+	assert.Equal(t, []string{"5.6.7.8", "1.2.3.4"}, reportedIPs(
+		`{"forwarded": "1.2.3.4, 5.6.7.8"}`+"\n5.6.7.8\n"))
+	assert.Nil(t, reportedIPs("nope"))
+}
+
+func TestResultCollectsExitIPs(t *testing.T) {
+	pass := func(b, valid string) federated {
+		return federated{judges: []*simple{{
+			ip:    "255.0.0.1",
+			valid: valid,
+			client: clientFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: body(b)}, nil
+			}),
+		}}}
+	}
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"twopass": twoPass{
+				first:  pass("1.2.3.4", ""),
+				second: pass(`{"ip": "1.2.3.4", "forwarded": "5.6.7.8", "user_agent": "x"}`, "user_agent"),
+			},
+		},
+	}
+	cc.use(checkerConfig{strategy: "twopass"})
+	r := cc.Result(context.Background(), pmux.HttpProxy("127.0.0.1:23"))
+	assert.True(t, r.Ok(), r.Failure)
+	assert.Equal(t, "1.2.3.4", r.ExitIP)
+	assert.Equal(t, []string{"1.2.3.4", "5.6.7.8"}, r.ExitIPs)
+	assert.False(t, r.Rotating)
+}
+
+func TestResultCountsJudgeTraffic(t *testing.T) {
+	for i, tt := range []struct {
+		responses []*http.Response
+		failures  []error
+		retries   int
+		attempts  int
+		limited   int
+		retried   int
+	}{
+		{
+			// both passes
+			responses: []*http.Response{{StatusCode: 200, Body: body("1.2.3.4")}},
+			attempts:  2,
+		},
+		{
+			responses: []*http.Response{{StatusCode: 429, Body: body("slow down")}},
+			attempts:  1,
+			limited:   1,
+		},
+		{
+			failures: []error{
+				&net.DNSError{Err: "no such host", Name: "judge"},
+				&net.DNSError{Err: "no such host", Name: "judge"},
+			},
+			responses: []*http.Response{nil, nil, {StatusCode: 200, Body: body("1.2.3.4")}},
+			retries:   2,
+			attempts:  4,
+			retried:   2,
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			n := 0
+			cc := &configurableChecker{
+				strategies: map[string]Checker{
+					"twopass": twoPass{
+						first: federated{judges: []*simple{{
+							ip: "255.0.0.1",
+							client: clientFunc(func(req *http.Request) (*http.Response, error) {
+								defer func() { n++ }()
+								if n < len(tt.failures) {
+									return nil, tt.failures[n]
+								}
+								return tt.responses[n], nil
+							}),
+						}}},
+						second: federated{judges: []*simple{{
+							ip: "255.0.0.1",
+							client: clientFunc(func(req *http.Request) (*http.Response, error) {
+								return &http.Response{StatusCode: 200, Body: body("1.2.3.4")}, nil
+							}),
+						}}},
+					},
+				},
+			}
+			cc.use(checkerConfig{
+				strategy:      "twopass",
+				dnsRetries:    tt.retries,
+				dnsRetryDelay: time.Millisecond,
+			})
+			r := cc.Result(context.Background(), pmux.HttpProxy("127.0.0.1:23"))
+			assert.Equal(t, tt.attempts, r.JudgeAttempts)
+			assert.Equal(t, tt.limited, r.RateLimited)
+			assert.Equal(t, tt.retried, r.Retries)
+		})
+	}
+}
+
+func TestCheckAllStrategies(t *testing.T) {
+	judge := func(b, valid string) federated {
+		return federated{judges: []*simple{{
+			ip:    "255.0.0.1",
+			valid: valid,
+			client: clientFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: body(b)}, nil
+			}),
+		}}}
+	}
+	leaky := `{"ip": "1.2.3.4", "forwarded": "255.0.0.1", "user_agent": "x"}`
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple":  judge("1.2.3.4", ""),
+			"headers": judge(leaky, "user_agent"),
+			"twopass": twoPass{
+				first:  judge("1.2.3.4", ""),
+				second: judge(leaky, "user_agent"),
+			},
+		},
+		scoring: newScoring(),
+	}
+	proxy := pmux.HttpProxy("127.0.0.1:23")
+	results := cc.CheckAllStrategies(context.Background(), proxy)
+	assert.Len(t, results, 3)
+	assert.True(t, results["simple"].Ok())
+	assert.Equal(t, "1.2.3.4", results["simple"].ExitIP)
+	assert.Equal(t, ErrNotAnonymous, results["headers"].Err)
+	assert.EqualError(t, results["twopass"].Err, "second: this IP address found")
+	assert.Equal(t, Score{}, cc.Score(proxy), "not scored")
+}
+
+func TestExplain(t *testing.T) {
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	passed := newResult(proxy, 180400*time.Microsecond, nil)
+	passed.ExitIP = "1.2.3.4"
+	passed.ExitIPs = []string{"1.2.3.4", "5.6.7.8"}
+	passed.Rotating = true
+	passed.Regions = map[string]time.Duration{
+		"us": 200 * time.Millisecond,
+		"eu": 100 * time.Millisecond,
+	}
+	passed.Capabilities = Chunked | KeepAlive
+	passed.Methods = map[string]bool{"PURGE": true, "PROPFIND": false}
+	passed.Reputation = &Reputation{Score: 75, Flags: []string{"proxy", "vpn"}}
+	passed.Confidence = 0.921
+	passed.JudgeAttempts = 3
+	mismatched := newResult(proxy, time.Second, nil)
+	mismatched.GeoMismatch = "geo mismatch: 1.2.3.4 is in de, but latency says us"
+	mismatched.JudgeAttempts = 1
+	mismatched.Retries = 1
+	transparent := newResult(proxy, 0, fmt.Errorf("first: %w", ErrNotAnonymous))
+	transparent.JudgeAttempts = 2
+	captcha := newResult(proxy, 0, errCloudFlare)
+	captcha.JudgeAttempts = 4
+	captcha.Retries = 2
+	failed := newResult(proxy, 0, fmt.Errorf("nope"))
+	failed.Retries = 1
+	for i, tt := range []struct {
+		r      CheckResult
+		expect string
+	}{
+		{
+			r: passed,
+			expect: "anonymous: 180ms, 3 judge attempts, exit 1.2.3.4, 2 exits, rotating, eu 100ms, us 200ms, " +
+				"chunked,keep_alive, unsupported methods: PROPFIND, reputation 75 (proxy,vpn), confidence 0.92",
+		},
+		{
+			r:      newResult(proxy, time.Second, nil),
+			expect: "anonymous: 1s",
+		},
+		{
+			r:      CheckResult{Proxy: proxy, Speed: time.Second},
+			expect: "unknown anonymity: 1s",
+		},
+		{
+			r:      newResult(proxy, 0, fmt.Errorf("first: %w", ErrNotAnonymous)),
+			expect: "transparent: first: this IP address found",
+		},
+		{
+			r:      newResult(proxy, 0, errCloudFlare),
+			expect: "retry later: cloudflare captcha",
+		},
+		{
+			r:      newResult(proxy, 0, fmt.Errorf("nope")),
+			expect: "failed: nope",
+		},
+		{
+			r:      mismatched,
+			expect: "anonymous: 1s, 1 judge attempts, 1 retries, geo mismatch: 1.2.3.4 is in de, but latency says us",
+		},
+		{
+			r:      transparent,
+			expect: "transparent: first: this IP address found (2 judge attempts)",
+		},
+		{
+			r:      captcha,
+			expect: "retry later: cloudflare captcha (4 judge attempts, 2 retries)",
+		},
+		{
+			r:      failed,
+			expect: "failed: nope (1 retries)",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			assert.Equal(t, tt.expect, tt.r.Explain())
+		})
+	}
+}
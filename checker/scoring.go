@@ -0,0 +1,229 @@
+package checker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+var errCaptchaProne = fmt.Errorf("captcha-prone")
+
+// captchaProne is the proxy, that triggers captchas on most judges, which
+// is the property of its exit IP rather than a transient judge issue
+type captchaProne struct {
+	rate float64
+}
+
+func (e captchaProne) Error() string {
+	return fmt.Sprintf("%s: %.0f%% of checks triggered captchas", errCaptchaProne, e.rate*100)
+}
+
+func (e captchaProne) Is(target error) bool {
+	return target == errCaptchaProne
+}
+
+// Score is the track record of checks for a single proxy
+type Score struct {
+	Checks int
+	Passed int
+	// Flaps is the number of transitions between passing and failing
+	Flaps  int
+	LastOk bool
+	// Breadth is the number of distinct judges, that the proxy has passed
+	Breadth int
+	// Captchas is the number of checks, where judges served anti-bot
+	// challenges, like Cloudflare or Google captchas
+	Captchas int
+}
+
+func (s Score) SuccessRate() float64 {
+	if s.Checks == 0 {
+		return 0
+	}
+	return float64(s.Passed) / float64(s.Checks)
+}
+
+// FlapRate is the share of checks, that have changed the verdict
+func (s Score) FlapRate() float64 {
+	if s.Checks < 2 {
+		return 0
+	}
+	return float64(s.Flaps) / float64(s.Checks-1)
+}
+
+// Confidence penalizes proxies, that pass intermittently, more than the ones
+// consistently failing, as flappy proxies cause production failures that are
+// hard to debug. Penalty of 0 makes it the same as plain success rate.
+func (s Score) Confidence(penalty float64) float64 {
+	c := s.SuccessRate() * (1 - penalty*s.FlapRate())
+	if c < 0 {
+		return 0
+	}
+	return c
+}
+
+// CaptchaRate is the share of checks, that have triggered captchas
+func (s Score) CaptchaRate() float64 {
+	if s.Checks == 0 {
+		return 0
+	}
+	return float64(s.Captchas) / float64(s.Checks)
+}
+
+// CaptchaProne tells if the exit IP of the proxy is likely flagged by anti-bot
+// systems, as captchas were triggered at least at this rate over at least
+// this many checks. Zero rate is never prone.
+func (s Score) CaptchaProne(rate float64, checks int) bool {
+	return rate > 0 && s.Checks >= checks && s.CaptchaRate() >= rate
+}
+
+// Verified tells if the proxy has passed at least this many distinct judges
+// over at least this many checks, so that it's trusted only after it has
+// worked against a variety of judges. Zero judges never verify.
+func (s Score) Verified(judges, checks int) bool {
+	return judges > 0 && s.Breadth >= judges && s.Passed >= checks
+}
+
+// scoringPolicy are the thresholds of scores, that come with the config
+type scoringPolicy struct {
+	flapPenalty float64
+	// verifiedJudges and verifiedChecks are for Score.Verified
+	verifiedJudges int
+	verifiedChecks int
+	// captchaRate and captchaChecks are for Score.CaptchaProne
+	captchaRate   float64
+	captchaChecks int
+	// ttl is how long scores of proxies, that are no longer checked, are
+	// kept, where zero keeps them forever
+	ttl time.Duration
+}
+
+var defaultScoringPolicy = scoringPolicy{
+	flapPenalty:   0.5,
+	captchaChecks: 5,
+	ttl:           24 * time.Hour,
+}
+
+func configureScoringPolicy(conf app.Config) scoringPolicy {
+	verifiedJudges := conf.IntOr("verified_judges", 0)
+	return scoringPolicy{
+		flapPenalty:    float64(conf.IntOr("flap_penalty", 50)) / 100,
+		verifiedJudges: verifiedJudges,
+		verifiedChecks: conf.IntOr("verified_checks", verifiedJudges),
+		captchaRate:    float64(conf.IntOr("captcha_rate", 0)) / 100,
+		captchaChecks:  conf.IntOr("captcha_checks", 5),
+		ttl:            conf.DurOr("score_ttl", 24*time.Hour),
+	}
+}
+
+// scoring is the store of scores for every checked proxy
+type scoring struct {
+	sync.RWMutex
+	records map[pmux.Proxy]Score
+	// judges are pages of judges, that every proxy has passed
+	judges map[pmux.Proxy]map[string]bool
+	// seen is when every proxy was last checked, so that proxies gone from
+	// the pool are forgotten after ttl instead of growing the store forever
+	seen  map[pmux.Proxy]time.Time
+	swept time.Time
+	now   func() time.Time
+}
+
+func newScoring() *scoring {
+	return &scoring{
+		records: map[pmux.Proxy]Score{},
+		judges:  map[pmux.Proxy]map[string]bool{},
+		seen:    map[pmux.Proxy]time.Time{},
+		now:     time.Now,
+	}
+}
+
+// record adds judges, that the check has passed, only for passed checks
+func (s *scoring) record(p scoringPolicy, proxy pmux.Proxy, ok bool, judges ...string) Score {
+	s.Lock()
+	defer s.Unlock()
+	s.sweep(p.ttl)
+	s.seen[proxy] = s.now()
+	score := s.records[proxy]
+	if score.Checks > 0 && score.LastOk != ok {
+		score.Flaps++
+	}
+	score.Checks++
+	if ok {
+		score.Passed++
+		passed := s.judges[proxy]
+		if passed == nil {
+			passed = map[string]bool{}
+			s.judges[proxy] = passed
+		}
+		for _, page := range judges {
+			passed[page] = true
+		}
+		score.Breadth = len(passed)
+	}
+	score.LastOk = ok
+	s.records[proxy] = score
+	return score
+}
+
+// captcha marks the latest recorded check of the proxy as captcha-triggering
+func (s *scoring) captcha(proxy pmux.Proxy) {
+	s.Lock()
+	defer s.Unlock()
+	score := s.records[proxy]
+	score.Captchas++
+	s.records[proxy] = score
+}
+
+func (s *scoring) get(proxy pmux.Proxy) Score {
+	s.RLock()
+	defer s.RUnlock()
+	return s.records[proxy]
+}
+
+// sweep forgets proxies, that were not checked within ttl. It runs at most
+// once per ttl, so that records are kept for between one and two of them.
+func (s *scoring) sweep(ttl time.Duration) {
+	now := s.now()
+	if ttl <= 0 || now.Sub(s.swept) < ttl {
+		return
+	}
+	s.swept = now
+	for proxy, seen := range s.seen {
+		if now.Sub(seen) < ttl {
+			continue
+		}
+		delete(s.seen, proxy)
+		delete(s.records, proxy)
+		delete(s.judges, proxy)
+	}
+}
+
+func (s *scoring) verified(p scoringPolicy, proxy pmux.Proxy) bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.records[proxy].Verified(p.verifiedJudges, p.verifiedChecks)
+}
+
+func (s *scoring) captchaProne(p scoringPolicy, proxy pmux.Proxy) bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.records[proxy].CaptchaProne(p.captchaRate, p.captchaChecks)
+}
+
+func (s *scoring) confidence(p scoringPolicy, proxy pmux.Proxy) float64 {
+	s.RLock()
+	defer s.RUnlock()
+	return s.records[proxy].Confidence(p.flapPenalty)
+}
+
+// Score returns the track record of checks for the proxy
+func (cc *configurableChecker) Score(proxy pmux.Proxy) Score {
+	if cc.scoring == nil {
+		return Score{}
+	}
+	return cc.scoring.get(proxy)
+}
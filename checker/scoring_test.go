@@ -0,0 +1,169 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlappingIsPenalized(t *testing.T) {
+	s := newScoring()
+	p := scoringPolicy{flapPenalty: 0.5}
+	stable := pmux.HttpProxy("127.0.0.1:1")
+	flappy := pmux.HttpProxy("127.0.0.1:2")
+	// both pass half of the time
+	for _, ok := range []bool{true, true, false, false} {
+		s.record(p, stable, ok)
+	}
+	for _, ok := range []bool{true, false, true, false} {
+		s.record(p, flappy, ok)
+	}
+	assert.Equal(t, s.get(stable).SuccessRate(), s.get(flappy).SuccessRate())
+	assert.Equal(t, 1, s.get(stable).Flaps)
+	assert.Equal(t, 3, s.get(flappy).Flaps)
+	assert.Greater(t, s.confidence(p, stable), s.confidence(p, flappy))
+	assert.InDelta(t, 0.25, s.confidence(p, flappy), 0.001)
+}
+
+func TestCheckRecordsScore(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				client: staticResponseClient{err: fmt.Errorf("nope")},
+			},
+		},
+		scoring: newScoring(),
+	}
+	proxy := pmux.HttpProxy("127.0.0.1:23")
+	cc.Check(context.Background(), proxy)
+	r := cc.Result(context.Background(), proxy)
+	assert.Equal(t, Score{Checks: 2}, cc.Score(proxy))
+	assert.Equal(t, 0.0, r.Confidence)
+}
+
+func TestBreadthCountsDistinctJudges(t *testing.T) {
+	s := newScoring()
+	p := scoringPolicy{verifiedJudges: 2, verifiedChecks: 3}
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	s.record(p, proxy, true, "a")
+	s.record(p, proxy, true, "a")
+	assert.Equal(t, 1, s.get(proxy).Breadth)
+	assert.False(t, s.verified(p, proxy))
+	// failed checks don't widen the breadth
+	s.record(p, proxy, false, "b")
+	assert.Equal(t, 1, s.get(proxy).Breadth)
+	s.record(p, proxy, true, "b")
+	assert.Equal(t, 2, s.get(proxy).Breadth)
+	assert.True(t, s.verified(p, proxy))
+}
+
+func TestVerified(t *testing.T) {
+	for i, tt := range []struct {
+		score  Score
+		judges int
+		checks int
+		out    bool
+	}{
+		{Score{Breadth: 5, Passed: 5}, 0, 0, false},
+		{Score{Breadth: 1, Passed: 5}, 2, 2, false},
+		{Score{Breadth: 2, Passed: 1}, 2, 2, false},
+		{Score{Breadth: 2, Passed: 2}, 2, 2, true},
+		{Score{Breadth: 3, Passed: 9}, 2, 5, true},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			assert.Equal(t, tt.out, tt.score.Verified(tt.judges, tt.checks))
+		})
+	}
+}
+
+func TestCheckRecordsPassedJudges(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				page: "https://judge/ip",
+				ip:   "5.6.7.8",
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						Body:       body("1.2.3.4"),
+					}, nil
+				}),
+			},
+		},
+		scoring: newScoring(),
+	}
+	cc.use(checkerConfig{scorePolicy: scoringPolicy{verifiedJudges: 1, verifiedChecks: 1}})
+	proxy := pmux.HttpProxy("127.0.0.1:23")
+	_, err := cc.Check(context.Background(), proxy)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cc.Score(proxy).Breadth)
+	assert.True(t, cc.Result(context.Background(), proxy).Verified)
+}
+
+func TestCaptchaProne(t *testing.T) {
+	for i, tt := range []struct {
+		score  Score
+		rate   float64
+		checks int
+		out    bool
+	}{
+		{Score{Checks: 5, Captchas: 5}, 0, 0, false},
+		{Score{Checks: 4, Captchas: 4}, 0.5, 5, false},
+		{Score{Checks: 10, Captchas: 4}, 0.5, 5, false},
+		{Score{Checks: 10, Captchas: 5}, 0.5, 5, true},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			assert.Equal(t, tt.out, tt.score.CaptchaProne(tt.rate, tt.checks))
+		})
+	}
+}
+
+func TestCaptchaProneCheckIsNotRetried(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip:   "5.6.7.8",
+				page: "https://judge/ip",
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 403,
+						Body:       body("Attention Required! | Cloudflare"),
+					}, nil
+				}),
+			},
+		},
+		scoring: newScoring(),
+	}
+	cc.use(checkerConfig{scorePolicy: scoringPolicy{captchaRate: 0.5, captchaChecks: 2}})
+	proxy := pmux.HttpProxy("127.0.0.1:23")
+	_, err := cc.Check(context.Background(), proxy)
+	assert.ErrorIs(t, err, errCloudFlare)
+	assert.True(t, isTimeout(err))
+
+	_, err = cc.Check(context.Background(), proxy)
+	assert.EqualError(t, err, "captcha-prone: 100% of checks triggered captchas")
+	assert.False(t, isTimeout(err))
+	assert.Equal(t, 2, cc.Score(proxy).Captchas)
+	assert.True(t, cc.Result(context.Background(), proxy).CaptchaProne)
+}
+
+func TestScoresOfGoneProxiesAreForgotten(t *testing.T) {
+	now := time.Now()
+	s := newScoring()
+	s.now = func() time.Time { return now }
+	p := scoringPolicy{ttl: time.Hour}
+	gone := pmux.HttpProxy("127.0.0.1:1")
+	kept := pmux.HttpProxy("127.0.0.1:2")
+	s.record(p, gone, true, "a")
+	now = now.Add(90 * time.Minute)
+	s.record(p, kept, true, "a")
+	assert.Equal(t, 0, s.get(gone).Checks)
+	assert.Equal(t, 1, s.get(kept).Checks)
+	assert.Len(t, s.judges, 1)
+	assert.Len(t, s.seen, 1)
+}
@@ -0,0 +1,178 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// judgeLogin is the request, that gets the session cookie of private judge
+type judgeLogin struct {
+	method string
+	url    *url.URL
+}
+
+// parseJudgeLogins parses comma-separated judge pages and their login
+// requests, e.g. "https://judge/ip POST https://judge/login?user=a"
+func parseJudgeLogins(raw string) (map[string]judgeLogin, error) {
+	out := map[string]judgeLogin{}
+	for _, v := range strings.Split(raw, ",") {
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		login := judgeLogin{method: "GET"}
+		switch len(fields) {
+		case 2:
+		case 3:
+			login.method = strings.ToUpper(fields[1])
+		default:
+			return nil, fmt.Errorf("invalid judge login: %s", redact(strings.TrimSpace(v)))
+		}
+		u, err := url.Parse(fields[len(fields)-1])
+		if err != nil || !u.IsAbs() {
+			return nil, fmt.Errorf("invalid judge login: %s", fields[0])
+		}
+		if login.method != "GET" && login.method != "POST" {
+			return nil, fmt.Errorf("invalid judge login method: %s", login.method)
+		}
+		login.url = u
+		out[fields[0]] = login
+	}
+	return out, nil
+}
+
+// loginFailed is not the fault of the proxy, so it's checked again later
+type loginFailed struct {
+	err error
+}
+
+func (e loginFailed) Error() string {
+	return e.err.Error()
+}
+
+func (e loginFailed) Unwrap() error {
+	return e.err
+}
+
+func (e loginFailed) Temporary() bool {
+	return true
+}
+
+// session keeps cookies of the private judge, that are obtained directly,
+// without the proxy, and attached to every check request to the judge
+type session struct {
+	sync.Mutex
+	client     httpClient
+	login      judgeLogin
+	cookies    []*http.Cookie
+	generation int
+}
+
+func newSession(client httpClient, login judgeLogin) *session {
+	hc, ok := client.(*http.Client)
+	if ok {
+		// logins usually set cookies with the redirect
+		direct := *hc
+		direct.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		client = &direct
+	}
+	return &session{
+		client: client,
+		login:  login,
+	}
+}
+
+// attach adds session cookies to the request, logging in if needed, and
+// returns the generation of the session, so that concurrent checks refresh
+// the expired session only once
+func (s *session) attach(ctx context.Context, req *http.Request) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.cookies == nil {
+		err := s.authenticate(ctx)
+		if err != nil {
+			return 0, loginFailed{err}
+		}
+	}
+	for _, c := range s.cookies {
+		req.AddCookie(c)
+	}
+	return s.generation, nil
+}
+
+func (s *session) authenticate(ctx context.Context) error {
+	var body io.Reader
+	u := *s.login.url
+	if s.login.method == "POST" {
+		// credentials of POST logins are sent as form
+		body = strings.NewReader(u.RawQuery)
+		u.RawQuery = ""
+	}
+	req, err := http.NewRequestWithContext(ctx, s.login.method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("User-Agent", randomAgent(req.Context()))
+	res, err := s.client.Do(req)
+	if err != nil {
+		// credentials may be in the query
+		ue, ok := err.(*url.Error)
+		if ok {
+			err = ue.Err
+		}
+		return fmt.Errorf("judge login: %w", err)
+	}
+	defer res.Body.Close()
+	ioutil.ReadAll(res.Body)
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("judge login: status %d", res.StatusCode)
+	}
+	cookies := res.Cookies()
+	if len(cookies) == 0 {
+		return fmt.Errorf("judge login: no cookies")
+	}
+	s.cookies = cookies
+	s.generation++
+	return nil
+}
+
+// expired detects judges rejecting the session or sending to the login page
+func (s *session) expired(res *http.Response) bool {
+	if s == nil {
+		return false
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	if res.StatusCode >= 300 && res.StatusCode < 400 {
+		return true
+	}
+	if res.Request == nil {
+		return false
+	}
+	final := res.Request.URL
+	return final.Host == s.login.url.Host && final.Path == s.login.url.Path
+}
+
+// invalidate drops cookies, unless other check has refreshed them already
+func (s *session) invalidate(generation int) {
+	s.Lock()
+	defer s.Unlock()
+	if s.generation == generation {
+		s.cookies = nil
+	}
+}
@@ -0,0 +1,102 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJudgeSession(t *testing.T) {
+	var logins, valid int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			r.ParseForm()
+			if r.Method != "POST" || r.PostForm.Get("user") != "a" {
+				rw.WriteHeader(403)
+				return
+			}
+			sid := atomic.AddInt32(&logins, 1)
+			atomic.StoreInt32(&valid, sid)
+			http.SetCookie(rw, &http.Cookie{Name: "sid", Value: fmt.Sprint(sid)})
+			http.Redirect(rw, r, "/", http.StatusFound)
+		case "/ip":
+			c, err := r.Cookie("sid")
+			if err != nil || c.Value != fmt.Sprint(atomic.LoadInt32(&valid)) {
+				rw.WriteHeader(401)
+				return
+			}
+			rw.Write([]byte("1.2.3.4"))
+		}
+	}))
+	defer srv.Close()
+
+	cc := configurableChecker{
+
+		ip:     "255.0.0.1",
+		client: &http.Client{},
+		strategies: map[string]Checker{
+			"simple": federated{judges: []*simple{{
+				ip:     "255.0.0.1",
+				page:   srv.URL + "/ip",
+				client: &http.Client{},
+			}}},
+		},
+	}
+	err := cc.Configure(app.Config{
+		"judge_logins": fmt.Sprintf("%s/ip POST %s/login?user=a", srv.URL, srv.URL),
+	})
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	_, err = cc.Check(ctx, proxy)
+	assert.NoError(t, err)
+	_, err = cc.Check(ctx, proxy)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+
+	// session expires on the judge side
+	atomic.StoreInt32(&valid, 0)
+	_, err = cc.Check(ctx, proxy)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&logins))
+
+	err = cc.Configure(app.Config{
+		"judge_logins": fmt.Sprintf("%s/ip POST %s/login?user=b", srv.URL, srv.URL),
+	})
+	assert.NoError(t, err)
+	_, err = cc.Check(ctx, proxy)
+	assert.EqualError(t, err, "judge login: status 403")
+	assert.True(t, isTimeout(err))
+}
+
+func TestParseJudgeLogins(t *testing.T) {
+	logins, err := parseJudgeLogins("a https://judge/login, b post https://judge/login?user=a")
+	assert.NoError(t, err)
+	assert.Equal(t, "GET", logins["a"].method)
+	assert.Equal(t, "POST", logins["b"].method)
+	assert.Equal(t, "user=a", logins["b"].url.RawQuery)
+
+	for i, tt := range []struct {
+		raw       string
+		expectErr string
+	}{
+		{"a", "invalid judge login: a"},
+		{"a b c d", "invalid judge login: a b c d"},
+		{"a /login", "invalid judge login: a"},
+		{"a PUT https://judge/login", "invalid judge login method: PUT"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			_, err := parseJudgeLogins(tt.raw)
+			assert.EqualError(t, err, tt.expectErr)
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// ShadowStats is the agreement of shadow strategy with the primary one
+type ShadowStats struct {
+	Sampled     int
+	BothPassed  int
+	BothFailed  int
+	PrimaryOnly int
+	ShadowOnly  int
+	// Dropped are samples skipped, as too many shadow checks were running
+	Dropped int
+}
+
+func (s ShadowStats) Agreement() float64 {
+	if s.Sampled == 0 {
+		return 0
+	}
+	return float64(s.BothPassed+s.BothFailed) / float64(s.Sampled)
+}
+
+// shadow returns the verdict of the primary strategy, but also runs the
+// shadow one in the background on a sample of checks, so that strategy
+// changes could be validated against live traffic without affecting the pool.
+type shadow struct {
+	primary Checker
+	shadow  Checker
+	sample  float64
+	timeout time.Duration
+	// slots bound shadow checks running at the same time
+	slots chan struct{}
+
+	mu    sync.Mutex
+	stats ShadowStats
+	wg    sync.WaitGroup
+}
+
+func newShadow(primary, s Checker, sample float64, timeout time.Duration, concurrency int) *shadow {
+	return &shadow{
+		primary: primary,
+		shadow:  s,
+		sample:  sample,
+		timeout: timeout,
+		slots:   make(chan struct{}, concurrency),
+	}
+}
+
+func (s *shadow) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+	t, err := s.primary.Check(ctx, proxy)
+	if rand.Float64() >= s.sample {
+		return t, err
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		s.mu.Lock()
+		s.stats.Dropped++
+		s.mu.Unlock()
+		return t, err
+	}
+	s.wg.Add(1)
+	go s.compare(ctx, proxy, err == nil)
+	return t, err
+}
+
+func (s *shadow) compare(ctx context.Context, proxy pmux.Proxy, primaryOk bool) {
+	defer s.wg.Done()
+	defer func() { <-s.slots }()
+	// shadow check must outlive the primary one, but not pollute its observation
+	parent := ctx
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, s.timeout)
+	defer cancel()
+	ctx, _ = detach(ctx)
+	b := spent(parent)
+	if b != nil {
+		ctx = withBudget(ctx, b.max)
+	}
+	_, err := s.shadow.Check(ctx, proxy)
+	shadowOk := err == nil
+	s.mu.Lock()
+	s.stats.Sampled++
+	switch {
+	case primaryOk && shadowOk:
+		s.stats.BothPassed++
+	case !primaryOk && !shadowOk:
+		s.stats.BothFailed++
+	case primaryOk:
+		s.stats.PrimaryOnly++
+	default:
+		s.stats.ShadowOnly++
+	}
+	s.mu.Unlock()
+	if primaryOk != shadowOk {
+		log := app.Log.From(ctx)
+		log.Debug().
+			Stringer("proxy", proxy).
+			Bool("primary", primaryOk).
+			Err(redactErr(err)).
+			Msg("shadow strategy disagrees")
+	}
+}
+
+// wait blocks until shadow checks of the replaced config are finished
+func (s *shadow) wait() {
+	if s == nil {
+		return
+	}
+	s.wg.Wait()
+}
+
+func (s *shadow) Stats() ShadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+type shadowKey struct{}
+
+// shadowed tells if the check runs in the shadow, so that it doesn't affect
+// live stats, like judge metrics, hourly latencies and pacers
+func shadowed(ctx context.Context) bool {
+	return ctx.Value(shadowKey{}) != nil
+}
+
+// detachedContext keeps the values, like logger, but never gets cancelled.
+// Judge budget and reused connections of the primary check are not shared.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key any) any {
+	switch key {
+	case budgetKey, connectionsKey{}:
+		return nil
+	case shadowKey{}:
+		return true
+	}
+	return d.parent.Value(key)
+}
+
+func configureShadow(conf app.Config, strategies map[string]Checker, primary string) (*shadow, error) {
+	name := conf.StrOr("shadow_strategy", "")
+	if name == "" {
+		return nil, nil
+	}
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid shadow strategy: %s", name)
+	}
+	if name == primary {
+		return nil, fmt.Errorf("shadow strategy is the same as primary: %s", name)
+	}
+	sample := float64(conf.IntOr("shadow_sample", 10)) / 100
+	// twopass makes two requests, each within the client timeout
+	timeout := 2 * conf.DurOr("timeout", 5*time.Second)
+	concurrency := conf.IntOr("shadow_concurrency", 4)
+	return newShadow(strategies[primary], s, sample, timeout, concurrency), nil
+}
+
+// ShadowStats returns the agreement of the shadow strategy with the primary
+func (cc *configurableChecker) ShadowStats() ShadowStats {
+	cfg := cc.current()
+	if cfg.shadow == nil {
+		return ShadowStats{}
+	}
+	return cfg.shadow.Stats()
+}
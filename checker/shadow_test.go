@@ -0,0 +1,209 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+type checkerFunc func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error)
+
+func (f checkerFunc) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+	return f(ctx, proxy)
+}
+
+func verdict(err error) checkerFunc {
+	return func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+		return time.Second, err
+	}
+}
+
+func TestShadowKeepsPrimaryVerdict(t *testing.T) {
+	fails := fmt.Errorf("fails")
+	for i, tt := range []struct {
+		primary, shadow error
+		expect          ShadowStats
+	}{
+		{nil, nil, ShadowStats{Sampled: 1, BothPassed: 1}},
+		{fails, fails, ShadowStats{Sampled: 1, BothFailed: 1}},
+		{nil, fails, ShadowStats{Sampled: 1, PrimaryOnly: 1}},
+		{fails, nil, ShadowStats{Sampled: 1, ShadowOnly: 1}},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			s := newShadow(verdict(tt.primary), verdict(tt.shadow), 1, time.Second, 1)
+			_, err := s.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			assert.Equal(t, tt.primary, err)
+			s.wg.Wait()
+			assert.Equal(t, tt.expect, s.Stats())
+		})
+	}
+}
+
+func TestShadowOutlivesPrimary(t *testing.T) {
+	s := newShadow(verdict(nil), checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+		time.Sleep(10 * time.Millisecond)
+		observed(ctx).exit("1.2.3.4")
+		return 0, ctx.Err()
+	}), 1, time.Second, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, o := observe(ctx)
+	_, err := s.Check(ctx, pmux.HttpProxy("127.0.0.1:1"))
+	assert.NoError(t, err)
+	cancel()
+	s.wg.Wait()
+	assert.Equal(t, 1, s.Stats().BothPassed)
+	assert.Empty(t, o.exitIPs())
+	assert.Equal(t, 1.0, s.Stats().Agreement())
+}
+
+func TestShadowSampling(t *testing.T) {
+	s := newShadow(verdict(nil), verdict(nil), 0, time.Second, 1)
+	for i := 0; i < 10; i++ {
+		s.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+	}
+	s.wg.Wait()
+	assert.Equal(t, 0, s.Stats().Sampled)
+}
+
+func TestConfigureShadow(t *testing.T) {
+	strategies := map[string]Checker{
+		"simple":  verdict(nil),
+		"twopass": verdict(nil),
+	}
+	s, err := configureShadow(app.Config{}, strategies, "simple")
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+
+	_, err = configureShadow(app.Config{"shadow_strategy": "nope"}, strategies, "simple")
+	assert.EqualError(t, err, "invalid shadow strategy: nope")
+
+	_, err = configureShadow(app.Config{"shadow_strategy": "simple"}, strategies, "simple")
+	assert.EqualError(t, err, "shadow strategy is the same as primary: simple")
+
+	s, err = configureShadow(app.Config{
+		"shadow_strategy": "twopass",
+		"shadow_sample":   "25",
+	}, strategies, "simple")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, s.sample)
+	assert.Equal(t, 10*time.Second, s.timeout)
+	assert.Equal(t, 4, cap(s.slots))
+}
+
+func TestShadowDropsSamplesWhenFull(t *testing.T) {
+	finish := make(chan bool)
+	s := newShadow(verdict(nil), checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+		<-finish
+		return 0, nil
+	}), 1, time.Second, 1)
+	for i := 0; i < 3; i++ {
+		_, err := s.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+		assert.NoError(t, err)
+	}
+	close(finish)
+	s.wg.Wait()
+	assert.Equal(t, ShadowStats{Sampled: 1, BothPassed: 1, Dropped: 2}, s.Stats())
+}
+
+func TestShadowSkipsLivePacers(t *testing.T) {
+	p := newPacer(time.Hour, true)
+	assert.NoError(t, p.wait(context.Background()))
+	next := p.next
+	sc := &simple{
+		ip:    "255.0.0.1",
+		page:  "http://judge/ip",
+		pacer: p,
+		client: clientFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Ratelimit-Remaining": {"0"}, "Ratelimit-Reset": {"7200"}},
+				Body:       body("1.2.3.4"),
+			}, nil
+		}),
+	}
+	s := newShadow(verdict(nil), sc, 1, time.Second, 1)
+	_, err := s.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+	assert.NoError(t, err)
+	s.wg.Wait()
+	assert.Equal(t, 1, s.Stats().BothPassed)
+	assert.Equal(t, next, p.next)
+}
+
+func TestReconfigurationWaitsForShadowChecks(t *testing.T) {
+	started := make(chan bool)
+	finish := make(chan bool)
+	cc := &configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": verdict(nil),
+			"slow": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				started <- true
+				<-finish
+				return 0, nil
+			}),
+		},
+	}
+	err := cc.Configure(app.Config{
+		"shadow_strategy": "slow",
+		"shadow_sample":   "100",
+	})
+	assert.NoError(t, err)
+	_, err = cc.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+	assert.NoError(t, err)
+	<-started
+
+	configured := make(chan error)
+	go func() {
+		configured <- cc.Configure(app.Config{})
+	}()
+	select {
+	case <-configured:
+		t.Fatal("configured before the shadow check has finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(finish)
+	assert.NoError(t, <-configured)
+}
+
+func TestShadowDoesNotShareCheckState(t *testing.T) {
+	ctx := withBudget(context.Background(), 3)
+	spend(ctx)
+	ctx, done := reuseConnections(ctx, &http.Client{Transport: &http.Transport{}}, false)
+	defer done()
+	s := newShadow(verdict(nil), checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+		assert.True(t, shadowed(ctx))
+		assert.Nil(t, ctx.Value(connectionsKey{}))
+		assert.Equal(t, int64(3), spent(ctx).left)
+		return 0, nil
+	}), 1, time.Second, 1)
+	_, err := s.Check(ctx, pmux.HttpProxy("127.0.0.1:1"))
+	assert.NoError(t, err)
+	s.wg.Wait()
+	assert.Equal(t, int64(2), spent(ctx).left)
+	assert.False(t, shadowed(ctx))
+}
+
+func TestShadowDoesNotRecordJudgeMetrics(t *testing.T) {
+	m := newMetrics()
+	sc := &simple{
+		ip:      "255.0.0.1",
+		page:    "http://judge/ip",
+		metrics: m,
+		client: clientFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: body("1.2.3.4")}, nil
+		}),
+	}
+	s := newShadow(verdict(nil), sc, 1, time.Second, 1)
+	_, err := s.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+	assert.NoError(t, err)
+	s.wg.Wait()
+	assert.Equal(t, 1, s.Stats().BothPassed)
+	assert.Empty(t, m.snapshot().Judges)
+}
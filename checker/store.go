@@ -0,0 +1,169 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// ResultStore persists results of checks, so that the history of the pool
+// could be queried after restarts
+type ResultStore interface {
+	Put(r CheckResult) error
+	Query(q ResultQuery) ([]CheckResult, error)
+}
+
+// ResultQuery matches results by all of the non-empty fields
+type ResultQuery struct {
+	Proxy     pmux.Proxy
+	Anonymity string
+	MinSpeed  time.Duration
+	MaxSpeed  time.Duration
+}
+
+func (q ResultQuery) Match(r CheckResult) bool {
+	if q.Proxy != 0 && q.Proxy != r.Proxy {
+		return false
+	}
+	if q.Anonymity != "" && q.Anonymity != r.Anonymity {
+		return false
+	}
+	if q.MinSpeed > 0 && r.Speed < q.MinSpeed {
+		return false
+	}
+	if q.MaxSpeed > 0 && r.Speed > q.MaxSpeed {
+		return false
+	}
+	return true
+}
+
+// fileStore appends results as JSON lines, which are scanned on every query
+type fileStore struct {
+	sync.Mutex
+	path string
+	file *os.File
+}
+
+func NewFileStore(path string) (ResultStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("results file: %w", err)
+	}
+	return &fileStore{
+		path: path,
+		file: file,
+	}, nil
+}
+
+func (fs *fileStore) Put(r CheckResult) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	fs.Lock()
+	defer fs.Unlock()
+	_, err = fs.file.Write(append(raw, '\n'))
+	return err
+}
+
+func (fs *fileStore) Close() error {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.file.Close()
+}
+
+func (fs *fileStore) Query(q ResultQuery) (out []CheckResult, err error) {
+	fs.Lock()
+	defer fs.Unlock()
+	file, err := os.Open(fs.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var r CheckResult
+		err = dec.Decode(&r)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("results file: %w", err)
+		}
+		if q.Match(r) {
+			out = append(out, r)
+		}
+	}
+}
+
+// configureResults keeps the store open across reconfigurations, where
+// results_store is either "jsonl" or "sqlite"
+func configureResults(conf app.Config, prev ResultStore) (ResultStore, error) {
+	path := conf.StrOr("results_file", "")
+	if path == "" {
+		return nil, nil
+	}
+	switch conf.StrOr("results_store", "jsonl") {
+	case "jsonl":
+		fs, ok := prev.(*fileStore)
+		if ok && fs.path == path {
+			return fs, nil
+		}
+		return NewFileStore(path)
+	case "sqlite":
+		s, ok := prev.(*sqliteStore)
+		if ok && s.path == path {
+			return s, nil
+		}
+		return NewSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("invalid results store: %s", conf.StrOr("results_store", ""))
+	}
+}
+
+// closeResults closes the previous store, once it's swapped for another
+// one and checks holding the previous config have drained
+func closeResults(ctx context.Context, prev, next ResultStore) {
+	if prev == nil || prev == next {
+		return
+	}
+	c, ok := prev.(io.Closer)
+	if !ok {
+		return
+	}
+	err := c.Close()
+	if err != nil {
+		log := app.Log.From(ctx)
+		log.Warn().Err(err).Msg("cannot close previous results store")
+	}
+}
+
+// store never fails the check, as results are secondary to the pool
+func (cfg *checkerConfig) store(ctx context.Context, r CheckResult) {
+	if cfg.results == nil {
+		return
+	}
+	err := cfg.results.Put(r)
+	if err != nil {
+		log := app.Log.From(ctx)
+		log.Warn().Err(err).Stringer("proxy", r.Proxy).Msg("cannot store result")
+	}
+}
+
+// Results queries the configured results_file
+func (cc *configurableChecker) Results(q ResultQuery) ([]CheckResult, error) {
+	_, cfg, release := cc.acquire(context.Background())
+	defer release()
+	if cfg.results == nil {
+		return nil, fmt.Errorf("results_file is not configured")
+	}
+	return cfg.results.Query(q)
+}
@@ -0,0 +1,110 @@
+package checker
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// pure Go driver, so that builds don't need cgo
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore keeps results in the table, that could be queried with SQL
+// directly, where result column is the complete CheckResult as JSON
+type sqliteStore struct {
+	path string
+	db   *sql.DB
+}
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS results (
+	id TEXT NOT NULL,
+	proxy TEXT NOT NULL,
+	speed INTEGER NOT NULL,
+	anonymity TEXT NOT NULL,
+	failure TEXT NOT NULL,
+	ok INTEGER NOT NULL,
+	checked INTEGER NOT NULL,
+	result TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS results_proxy ON results (proxy);`
+
+func NewSQLiteStore(path string) (ResultStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("results db: %w", err)
+	}
+	// writes of concurrent checks are serialized by sqlite anyway
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("results db: %w", err)
+	}
+	return &sqliteStore{
+		path: path,
+		db:   db,
+	}, nil
+}
+
+func (s *sqliteStore) Put(r CheckResult) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO results
+		(id, proxy, speed, anonymity, failure, ok, checked, result)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Proxy.String(), int64(r.Speed), r.Anonymity, r.Failure,
+		r.Ok(), time.Now().Unix(), string(raw))
+	return err
+}
+
+func (s *sqliteStore) Query(q ResultQuery) (out []CheckResult, err error) {
+	var where []string
+	var args []interface{}
+	if q.Proxy != 0 {
+		where = append(where, "proxy = ?")
+		args = append(args, q.Proxy.String())
+	}
+	if q.Anonymity != "" {
+		where = append(where, "anonymity = ?")
+		args = append(args, q.Anonymity)
+	}
+	if q.MinSpeed > 0 {
+		where = append(where, "speed >= ?")
+		args = append(args, int64(q.MinSpeed))
+	}
+	if q.MaxSpeed > 0 {
+		where = append(where, "speed <= ?")
+		args = append(args, int64(q.MaxSpeed))
+	}
+	query := "SELECT result FROM results"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := s.db.Query(query+" ORDER BY rowid", args...)
+	if err != nil {
+		return nil, fmt.Errorf("results db: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raw string
+		err = rows.Scan(&raw)
+		if err != nil {
+			return nil, fmt.Errorf("results db: %w", err)
+		}
+		var r CheckResult
+		err = json.Unmarshal([]byte(raw), &r)
+		if err != nil {
+			return nil, fmt.Errorf("results db: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
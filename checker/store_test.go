@@ -0,0 +1,226 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "results.jsonl"))
+	assert.NoError(t, err)
+	testResultStore(t, s)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "results.db"))
+	assert.NoError(t, err)
+	defer s.(*sqliteStore).Close()
+	testResultStore(t, s)
+}
+
+func testResultStore(t *testing.T, s ResultStore) {
+
+	a := pmux.HttpProxy("127.0.0.1:1")
+	b := pmux.Socks5Proxy("127.0.0.1:2")
+	fast := newResult(a, 100*time.Millisecond, nil)
+	fast.Capabilities = Chunked | Streaming
+	fast.ExitIP = "1.2.3.4"
+	transparent := newResult(b, 2*time.Second, fmt.Errorf("first: %w", ErrNotAnonymous))
+	failed := newResult(a, 0, fmt.Errorf("nope"))
+	for _, r := range []CheckResult{fast, transparent, failed} {
+		assert.NoError(t, s.Put(r))
+	}
+	// errors are not persisted
+	fast.Err = nil
+	transparent.Err = nil
+	failed.Err = nil
+
+	for i, tt := range []struct {
+		query  ResultQuery
+		expect []CheckResult
+	}{
+		{
+			expect: []CheckResult{fast, transparent, failed},
+		},
+		{
+			query:  ResultQuery{Proxy: a},
+			expect: []CheckResult{fast, failed},
+		},
+		{
+			query:  ResultQuery{Anonymity: Transparent},
+			expect: []CheckResult{transparent},
+		},
+		{
+			query:  ResultQuery{MinSpeed: time.Second},
+			expect: []CheckResult{transparent},
+		},
+		{
+			query:  ResultQuery{Anonymity: Anonymous, MaxSpeed: time.Second},
+			expect: []CheckResult{fast},
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			found, err := s.Query(tt.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, found)
+		})
+	}
+
+	found, err := s.Query(ResultQuery{Proxy: a})
+	assert.NoError(t, err)
+	assert.True(t, found[0].Ok())
+	assert.False(t, found[1].Ok(), "failures stay failed without errors")
+}
+
+func TestChecksAreStored(t *testing.T) {
+	cc := &configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip:   "255.0.0.1",
+				page: "http://judge.local/ip",
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: 200, Body: body("1.2.3.4")}, nil
+				}),
+			},
+		},
+	}
+	_, err := cc.Results(ResultQuery{})
+	assert.EqualError(t, err, "results_file is not configured")
+
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	err = cc.Configure(app.Config{"results_file": path})
+	assert.NoError(t, err)
+	store := cc.current().results
+
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	_, err = cc.Check(context.Background(), proxy)
+	assert.NoError(t, err)
+	cc.Result(context.Background(), proxy)
+
+	found, err := cc.Results(ResultQuery{Proxy: proxy})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, "1.2.3.4", found[0].ExitIP)
+	assert.Equal(t, Anonymous, found[1].Anonymity)
+
+	err = cc.Configure(app.Config{"results_file": path})
+	assert.NoError(t, err)
+	assert.Same(t, store, cc.current().results)
+}
+
+func TestResultsStoreIsClosedAfterChecksDrain(t *testing.T) {
+	started := make(chan bool)
+	finish := make(chan bool)
+	cc := &configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				started <- true
+				<-finish
+				return time.Second, nil
+			}),
+		},
+		scoring: newScoring(),
+	}
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.jsonl")
+	err := cc.Configure(app.Config{"results_file": first})
+	assert.NoError(t, err)
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	checked := make(chan error)
+	go func() {
+		_, err := cc.Check(context.Background(), proxy)
+		checked <- err
+	}()
+	<-started
+
+	configured := make(chan error)
+	go func() {
+		configured <- cc.Configure(app.Config{"results_file": filepath.Join(dir, "b.jsonl")})
+	}()
+	select {
+	case <-configured:
+		t.Fatal("configured before the check has drained")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(finish)
+	assert.NoError(t, <-checked)
+	assert.NoError(t, <-configured)
+
+	raw, err := os.ReadFile(first)
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), "127.0.0.1:1", "check has written to the store of its config")
+}
+
+func TestResultsStoreIsClosedOnSwap(t *testing.T) {
+	cc := &configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	dir := t.TempDir()
+	err := cc.Configure(app.Config{"results_file": filepath.Join(dir, "a.jsonl")})
+	assert.NoError(t, err)
+	first := cc.current().results
+
+	err = cc.Configure(app.Config{
+		"results_file":  filepath.Join(dir, "b.db"),
+		"results_store": "sqlite",
+	})
+	assert.NoError(t, err)
+	assert.Error(t, first.Put(CheckResult{}), "previous file is closed")
+	second := cc.current().results
+	assert.NoError(t, second.Put(CheckResult{}))
+
+	err = cc.Configure(app.Config{"results_file": "x", "results_store": "nope"})
+	assert.EqualError(t, err, "invalid results store: nope")
+	assert.NoError(t, second.Put(CheckResult{}), "failed reconfiguration keeps the store")
+
+	err = cc.Configure(app.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, cc.current().results)
+	assert.Error(t, second.Put(CheckResult{}))
+}
+
+func TestFailedReconfigurationIsNotHalfApplied(t *testing.T) {
+	cc := &configurableChecker{
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	err := cc.Configure(app.Config{
+		"user_agents":   "a",
+		"preserve_json": "false",
+		"flap_penalty":  "10",
+	})
+	assert.NoError(t, err)
+
+	err = cc.Configure(app.Config{
+		"user_agents":   "b",
+		"preserve_json": "true",
+		"flap_penalty":  "90",
+		"results_file":  "x",
+		"results_store": "nope",
+	})
+	assert.EqualError(t, err, "invalid results store: nope")
+	cfg := cc.current()
+	assert.Equal(t, userAgents{"a"}, cfg.agents)
+	assert.True(t, cfg.sanitizeJSON)
+	assert.Equal(t, 0.1, cfg.scorePolicy.flapPenalty)
+}
@@ -0,0 +1,66 @@
+package checker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// CheckStream checks proxies from in with at most concurrency checks at a
+// time, until in is closed or ctx is cancelled. Slow consumers of out hold
+// back reading of in. Out is closed, once all started checks are done, and
+// results of checks cancelled by ctx are dropped.
+func (cc *configurableChecker) CheckStream(ctx context.Context, in <-chan pmux.Proxy, out chan<- CheckResult, concurrency int) {
+	cc.checkRequests(ctx, func() (CheckRequest, bool) {
+		select {
+		case <-ctx.Done():
+			return CheckRequest{}, false
+		case proxy, ok := <-in:
+			return CheckRequest{Proxy: proxy}, ok
+		}
+	}, out, concurrency)
+}
+
+// CheckRequests is CheckStream, that echoes labels of every request in
+// its result
+func (cc *configurableChecker) CheckRequests(ctx context.Context, in <-chan CheckRequest, out chan<- CheckResult, concurrency int) {
+	cc.checkRequests(ctx, func() (CheckRequest, bool) {
+		select {
+		case <-ctx.Done():
+			return CheckRequest{}, false
+		case req, ok := <-in:
+			return req, ok
+		}
+	}, out, concurrency)
+}
+
+func (cc *configurableChecker) checkRequests(ctx context.Context, next func() (CheckRequest, bool), out chan<- CheckResult, concurrency int) {
+	defer close(out)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				req, ok := next()
+				if !ok {
+					return
+				}
+				r := cc.Result(WithLabels(ctx, req.Labels), req.Proxy)
+				if ctx.Err() != nil {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case out <- r:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,128 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStream(t *testing.T) {
+	var running, peak int32
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				return time.Millisecond, nil
+			}),
+		},
+	}
+	cc.use(checkerConfig{})
+	in := make(chan pmux.Proxy)
+	out := make(chan CheckResult)
+	go cc.CheckStream(context.Background(), in, out, 3)
+	go func() {
+		for i := 1; i <= 10; i++ {
+			in <- pmux.HttpProxy(fmt.Sprintf("127.0.0.1:%d", i))
+		}
+		close(in)
+	}()
+	seen := map[pmux.Proxy]bool{}
+	for r := range out {
+		assert.True(t, r.Ok())
+		seen[r.Proxy] = true
+	}
+	assert.Len(t, seen, 10)
+	assert.LessOrEqual(t, peak, int32(3))
+}
+
+func TestCheckStreamCancelled(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				return time.Millisecond, nil
+			}),
+		},
+	}
+	cc.use(checkerConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan pmux.Proxy, 1)
+	out := make(chan CheckResult)
+	done := make(chan struct{})
+	go func() {
+		cc.CheckStream(ctx, in, out, 2)
+		close(done)
+	}()
+	in <- pmux.HttpProxy("127.0.0.1:1")
+	// nobody reads out, so only cancellation unblocks the stream
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream is not shut down")
+	}
+	_, ok := <-out
+	assert.False(t, ok)
+}
+
+func TestCheckRequestsEchoLabels(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				return time.Millisecond, nil
+			}),
+		},
+	}
+	cc.use(checkerConfig{})
+	in := make(chan CheckRequest)
+	out := make(chan CheckResult)
+	go cc.CheckRequests(context.Background(), in, out, 2)
+	go func() {
+		for i := 1; i <= 4; i++ {
+			in <- CheckRequest{
+				Proxy:  pmux.HttpProxy(fmt.Sprintf("127.0.0.1:%d", i)),
+				Labels: map[string]string{"batch": fmt.Sprint(i)},
+			}
+		}
+		close(in)
+	}()
+	seen := map[string]string{}
+	for r := range out {
+		seen[r.Proxy.String()] = r.Labels["batch"]
+	}
+	assert.Equal(t, map[string]string{
+		"http://127.0.0.1:1": "1",
+		"http://127.0.0.1:2": "2",
+		"http://127.0.0.1:3": "3",
+		"http://127.0.0.1:4": "4",
+	}, seen)
+}
+
+func TestResultWithLabels(t *testing.T) {
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": checkerFunc(func(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+				return time.Millisecond, nil
+			}),
+		},
+	}
+	cc.use(checkerConfig{})
+	labels := map[string]string{"source": "feed"}
+	r := cc.Result(WithLabels(context.Background(), labels), pmux.HttpProxy("127.0.0.1:1"))
+	assert.Equal(t, labels, r.Labels)
+	r = cc.Result(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+	assert.Nil(t, r.Labels)
+}
@@ -0,0 +1,145 @@
+package checker
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PoolSummary is the aggregate of check results, e.g. of a batch sweep, so
+// that operators and CI could assert on health of the pool as a whole
+type PoolSummary struct {
+	Checked int
+	Passed  int
+	// Anonymity counts results by Anonymous, Transparent, "temporary",
+	// and "failed"
+	Anonymity map[string]int
+	// Capabilities counts passed proxies by capability name
+	Capabilities map[string]int
+	// Latency is of passed proxies
+	Latency Percentiles
+	// Failures counts failed results by cause, as known errors or rough
+	// network conditions, like "timeout" or "connection refused"
+	Failures map[string]int
+
+	// speeds of passed proxies in ascending order
+	speeds []time.Duration
+}
+
+// Percentiles are nearest-rank percentiles of latency
+type Percentiles struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+}
+
+// Faster returns the number of passed proxies, that are faster than limit
+func (s PoolSummary) Faster(limit time.Duration) int {
+	return sort.Search(len(s.speeds), func(i int) bool {
+		return s.speeds[i] >= limit
+	})
+}
+
+// Summarize aggregates results of checks or of the results store, where
+// stored results are classified by their Failure, as errors aren't kept
+func Summarize(results []CheckResult) PoolSummary {
+	out := PoolSummary{
+		Anonymity:    map[string]int{},
+		Capabilities: map[string]int{},
+		Failures:     map[string]int{},
+	}
+	for _, r := range results {
+		out.Checked++
+		level := resultLevel(r)
+		out.Anonymity[outcomeNames[level]]++
+		if level != outcomeAnonymous {
+			out.Failures[failureCause(r)]++
+			continue
+		}
+		out.Passed++
+		out.speeds = append(out.speeds, r.Speed)
+		for _, name := range r.Capabilities.Names() {
+			out.Capabilities[name]++
+		}
+	}
+	sort.Slice(out.speeds, func(i, j int) bool {
+		return out.speeds[i] < out.speeds[j]
+	})
+	out.Latency = Percentiles{
+		P50: percentile(out.speeds, 50),
+		P90: percentile(out.speeds, 90),
+		P99: percentile(out.speeds, 99),
+	}
+	return out
+}
+
+func resultLevel(r CheckResult) byte {
+	switch {
+	case r.Err != nil:
+		return anonymityLevel(r.Err)
+	case r.Anonymity == Transparent:
+		return outcomeTransparent
+	case r.Failure != "":
+		return outcomeFailed
+	default:
+		return outcomeAnonymous
+	}
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// failureCauses are checked in order, so that wrapping errors come first
+var failureCauses = []error{
+	errPostCheck,
+	errCaptchaProne,
+	ErrNotAnonymous,
+	errDirectExit,
+	errRotatingExit,
+	errGeoMismatch,
+	errFingerprintMismatch,
+	errCaptivePortal,
+	errJudgeIdentity,
+	errTLSStripped,
+	errALPN,
+	errUnexpectedContentType,
+	errRedirectNotAllowed,
+	errImplausiblyFast,
+	errCloudFlare,
+	errGoogleRatelimit,
+	errProxyCircuitOpen,
+	errSlowOutlier,
+	errJudgeBudget,
+	errJudgePaced,
+	errSourceNotAllowlisted,
+}
+
+func failureCause(r CheckResult) string {
+	for _, cause := range failureCauses {
+		if errors.Is(r.Err, cause) || strings.Contains(r.Failure, cause.Error()) {
+			return cause.Error()
+		}
+	}
+	failure := strings.ToLower(r.Failure)
+	switch {
+	case strings.Contains(failure, "timeout"), strings.Contains(failure, "deadline exceeded"):
+		return "timeout"
+	case strings.Contains(failure, "connection refused"):
+		return "connection refused"
+	case strings.Contains(failure, "connection reset"):
+		return "connection reset"
+	case strings.Contains(failure, "eof"):
+		return "eof"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,67 @@
+package checker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	var results []CheckResult
+	for i := 1; i <= 10; i++ {
+		r := newResult(proxy, time.Duration(i)*100*time.Millisecond, nil)
+		if i%2 == 0 {
+			r.Capabilities = KeepAlive | Chunked
+		}
+		results = append(results, r)
+	}
+	results = append(results,
+		newResult(proxy, time.Second, ErrNotAnonymous),
+		newResult(proxy, time.Second, transparentByPolicy{}),
+		newResult(proxy, time.Second, temporary("dial tcp: i/o timeout")),
+		newResult(proxy, time.Second, postCheckFailed{"api", fmt.Errorf("status 403")}),
+		newResult(proxy, time.Second, fmt.Errorf("dial tcp: connection refused")),
+		// results store doesn't keep errors
+		CheckResult{Failure: "tls stripped: no tls connection"},
+		CheckResult{Failure: "nope"},
+	)
+	s := Summarize(results)
+	assert.Equal(t, 17, s.Checked)
+	assert.Equal(t, 10, s.Passed)
+	assert.Equal(t, map[string]int{
+		Anonymous:   10,
+		Transparent: 2,
+		"temporary": 1,
+		"failed":    4,
+	}, s.Anonymity)
+	assert.Equal(t, map[string]int{
+		"chunked":    5,
+		"keep_alive": 5,
+	}, s.Capabilities)
+	assert.Equal(t, Percentiles{
+		P50: 500 * time.Millisecond,
+		P90: 900 * time.Millisecond,
+		P99: time.Second,
+	}, s.Latency)
+	assert.Equal(t, map[string]int{
+		"this IP address found": 2,
+		"timeout":               1,
+		"post check failed":     1,
+		"connection refused":    1,
+		"tls stripped":          1,
+		"other":                 1,
+	}, s.Failures)
+	assert.Equal(t, 2, s.Faster(300*time.Millisecond))
+	assert.Equal(t, 10, s.Faster(time.Hour))
+}
+
+func TestSummarizeNothing(t *testing.T) {
+	s := Summarize(nil)
+	assert.Equal(t, 0, s.Checked)
+	assert.Equal(t, Percentiles{}, s.Latency)
+	assert.Equal(t, 0, s.Faster(time.Second))
+}
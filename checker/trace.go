@@ -0,0 +1,201 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// Timing is the breakdown of a single judge request, so that proxies slow
+// to accept connections could be told apart from ones slow to tunnel
+type Timing struct {
+	DNS time.Duration `json:",omitempty"`
+	// Connect is the TCP connection setup to the proxy
+	Connect time.Duration `json:",omitempty"`
+	// Negotiate is the tunnel setup once connected, e.g. SOCKS handshake
+	// or CONNECT
+	Negotiate time.Duration `json:",omitempty"`
+	// TLS is the handshake with the judge
+	TLS       time.Duration `json:",omitempty"`
+	FirstByte time.Duration `json:",omitempty"`
+	Total     time.Duration
+}
+
+// TraceEvent is a single judge hit during the traced check
+type TraceEvent struct {
+	Time    time.Time
+	Method  string
+	URL     string
+	Status  int `json:",omitempty"`
+	Timing  Timing
+	Outcome string
+	Body    string `json:",omitempty"`
+}
+
+// Trace is the complete diagnostic of a single proxy check
+type Trace struct {
+	Result   CheckResult
+	Timeline []TraceEvent
+}
+
+// Trace runs the proxy through the full check, including capability probes,
+// and records every judge hit in order, so that it could be attached to bug
+// reports about specific proxies.
+func (cc *configurableChecker) Trace(ctx context.Context, proxy pmux.Proxy) Trace {
+	o := &observation{tracing: true}
+	ctx = context.WithValue(ctx, observationKey, o)
+	r := cc.Result(ctx, proxy)
+	return Trace{
+		Result:   r,
+		Timeline: o.timeline(),
+	}
+}
+
+// timingTrace collects phases of the request from httptrace hooks
+type timingTrace struct {
+	sync.Mutex
+	start               time.Time
+	dnsStart, dnsDone   time.Time
+	connStart, connDone time.Time
+	tlsStart, tlsDone   time.Time
+	firstByte           time.Time
+	// tunnels are traced by pmux
+	negotiate, tunnelTLS time.Duration
+}
+
+func (tt *timingTrace) at(t *time.Time) func() {
+	return func() {
+		tt.Lock()
+		defer tt.Unlock()
+		*t = time.Now()
+	}
+}
+
+func (tt *timingTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tt.at(&tt.dnsStart)()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tt.at(&tt.dnsDone)()
+		},
+		ConnectStart: func(string, string) {
+			tt.at(&tt.connStart)()
+		},
+		ConnectDone: func(string, string, error) {
+			tt.at(&tt.connDone)()
+		},
+		TLSHandshakeStart: tt.at(&tt.tlsStart),
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tt.at(&tt.tlsDone)()
+		},
+		GotFirstResponseByte: tt.at(&tt.firstByte),
+	}
+}
+
+func (tt *timingTrace) dialTrace() *pmux.DialTrace {
+	return &pmux.DialTrace{
+		Negotiated: func(d time.Duration) {
+			tt.Lock()
+			defer tt.Unlock()
+			tt.negotiate = d
+		},
+		Handshaked: func(d time.Duration) {
+			tt.Lock()
+			defer tt.Unlock()
+			tt.tunnelTLS = d
+		},
+	}
+}
+
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+func (tt *timingTrace) timing() Timing {
+	tt.Lock()
+	defer tt.Unlock()
+	t := Timing{
+		DNS:       between(tt.dnsStart, tt.dnsDone),
+		Connect:   between(tt.connStart, tt.connDone),
+		Negotiate: tt.negotiate,
+		TLS:       between(tt.tlsStart, tt.tlsDone),
+		FirstByte: between(tt.start, tt.firstByte),
+		Total:     time.Since(tt.start),
+	}
+	if tt.tunnelTLS != 0 {
+		// net/http only sees the handshake, that is already done by pmux
+		t.TLS = tt.tunnelTLS
+	}
+	return t
+}
+
+// traced instruments the request, if the check is traced, and returns the
+// callback to record the outcome of it
+func traced(ctx context.Context, method, page string) (context.Context, func(*http.Response, string, error)) {
+	o := observed(ctx)
+	if !o.isTracing() {
+		return ctx, func(*http.Response, string, error) {}
+	}
+	tt := &timingTrace{start: time.Now()}
+	ctx = httptrace.WithClientTrace(ctx, tt.clientTrace())
+	dt := tt.dialTrace()
+	dt.Connected = o.connected
+	ctx = pmux.WithDialTrace(ctx, dt)
+	return ctx, func(res *http.Response, body string, err error) {
+		e := TraceEvent{
+			Time:    tt.start,
+			Method:  method,
+			URL:     redact(page),
+			Timing:  tt.timing(),
+			Outcome: "ok",
+		}
+		if res != nil {
+			e.Status = res.StatusCode
+			e.Body = truncatedResponse(ctx, res.Header.Get("Content-Type"), body)
+		}
+		if err != nil {
+			e.Outcome = redact(err.Error())
+		}
+		o.event(e)
+	}
+}
+
+func (o *observation) isTracing() bool {
+	if o == nil {
+		return false
+	}
+	o.Lock()
+	defer o.Unlock()
+	return o.tracing
+}
+
+func (o *observation) event(e TraceEvent) {
+	if o == nil {
+		return
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.events = append(o.events, e)
+}
+
+// timeline returns judge hits ordered by time, as passes and regions may
+// run concurrently
+func (o *observation) timeline() []TraceEvent {
+	o.Lock()
+	defer o.Unlock()
+	out := append([]TraceEvent{}, o.events...)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Time.Before(out[j].Time)
+	})
+	return out
+}
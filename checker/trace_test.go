@@ -0,0 +1,94 @@
+package checker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrace(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	cc := &configurableChecker{
+		client: client,
+		strategies: map[string]Checker{
+			"twopass": twoPass{
+				first: federated{judges: []*simple{{
+					ip:     "255.0.0.1",
+					page:   "http://judge.local/ip",
+					client: client,
+				}}},
+				second: federated{judges: []*simple{{
+					ip:     "255.0.0.1",
+					page:   "http://judge.local/size",
+					valid:  "header",
+					client: client,
+				}}},
+			},
+		},
+	}
+	probes, err := configureProbes(app.Config{
+		"probes": "encoding",
+		"judge":  "http://judge.local",
+	}, client)
+	assert.NoError(t, err)
+	cc.use(checkerConfig{strategy: "twopass", probes: probes})
+
+	trace := cc.Trace(context.Background(), proxy)
+	assert.True(t, trace.Result.Ok(), trace.Result.Failure)
+
+	var urls []string
+	for i, e := range trace.Timeline {
+		urls = append(urls, e.URL)
+		assert.Equal(t, "GET", e.Method)
+		assert.Equal(t, 200, e.Status)
+		assert.Equal(t, "ok", e.Outcome)
+		assert.NotZero(t, e.Timing.Total)
+		assert.NotZero(t, e.Timing.FirstByte)
+		if i > 0 {
+			assert.False(t, e.Time.Before(trace.Timeline[i-1].Time))
+		}
+	}
+	assert.Equal(t, []string{
+		"http://judge.local/ip",
+		"http://judge.local/size",
+		"http://judge.local/encoded?encoding=gzip",
+		"http://judge.local/encoded?encoding=identity",
+	}, urls)
+	// bodies are shrunk the same way as in errors
+	assert.Equal(t, "ip", trace.Timeline[0].Body)
+}
+
+func TestTraceRecordsFailures(t *testing.T) {
+	proxy, client := judgeProxy(t, nil)
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": federated{judges: []*simple{{
+				ip:     "127.0.0.1",
+				page:   "http://judge.local/ip",
+				client: client,
+			}}},
+		},
+	}
+	trace := cc.Trace(context.Background(), proxy)
+	assert.Equal(t, ErrNotAnonymous, trace.Result.Err)
+	assert.Len(t, trace.Timeline, 1)
+	assert.Equal(t, ErrNotAnonymous.Error(), trace.Timeline[0].Outcome)
+
+	// regular checks are not traced
+	ctx, o := observe(context.Background())
+	cc.Check(ctx, proxy)
+	assert.Empty(t, o.timeline())
+}
+
+func TestTimingIncludesTunnelPhases(t *testing.T) {
+	tt := &timingTrace{start: time.Now()}
+	dt := tt.dialTrace()
+	dt.Negotiated(20 * time.Millisecond)
+	dt.Handshaked(30 * time.Millisecond)
+	timing := tt.timing()
+	assert.Equal(t, 20*time.Millisecond, timing.Negotiate)
+	assert.Equal(t, 30*time.Millisecond, timing.TLS)
+}
@@ -0,0 +1,118 @@
+package checker
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// CheckRecord is a single check in the history of the proxy
+type CheckRecord struct {
+	Time    time.Time
+	Speed   time.Duration
+	Ok      bool
+	Failure string `json:",omitempty"`
+}
+
+// ProxyHistory is the last checks of the proxy, oldest first, so that
+// slowly degrading proxies could be spotted before they fail outright
+type ProxyHistory struct {
+	ID     string
+	Proxy  pmux.Proxy
+	Checks []CheckRecord
+}
+
+type ring struct {
+	proxy   pmux.Proxy
+	records []CheckRecord
+	next    int
+}
+
+func (r *ring) add(size int, record CheckRecord) {
+	if len(r.records) < size {
+		r.records = append(r.records, record)
+		return
+	}
+	r.records[r.next] = record
+	r.next = (r.next + 1) % len(r.records)
+}
+
+func (r *ring) ordered() []CheckRecord {
+	out := make([]CheckRecord, 0, len(r.records))
+	out = append(out, r.records[r.next:]...)
+	return append(out, r.records[:r.next]...)
+}
+
+// trends keeps bounded history of checks per proxy, keyed by ProxyID
+type trends struct {
+	sync.RWMutex
+	rings map[string]*ring
+	now   func() time.Time
+}
+
+func newTrends() *trends {
+	return &trends{
+		rings: map[string]*ring{},
+		now:   time.Now,
+	}
+}
+
+func (t *trends) record(size int, proxy pmux.Proxy, speed time.Duration, err error) {
+	record := CheckRecord{
+		Time:  t.now(),
+		Speed: speed,
+		Ok:    err == nil,
+	}
+	if err != nil {
+		record.Failure = err.Error()
+	}
+	id := ProxyID(proxy)
+	t.Lock()
+	defer t.Unlock()
+	r, ok := t.rings[id]
+	if !ok || len(r.records) > size {
+		// history size may shrink on reconfiguration
+		r = &ring{proxy: proxy}
+		t.rings[id] = r
+	}
+	r.add(size, record)
+}
+
+func (t *trends) get(id string) (ProxyHistory, bool) {
+	if t == nil {
+		return ProxyHistory{}, false
+	}
+	t.RLock()
+	defer t.RUnlock()
+	r, ok := t.rings[id]
+	if !ok {
+		return ProxyHistory{}, false
+	}
+	return ProxyHistory{
+		ID:     id,
+		Proxy:  r.proxy,
+		Checks: r.ordered(),
+	}, true
+}
+
+// History returns the last checks of the proxy, if checker.history is set
+func (cc *configurableChecker) History(proxy pmux.Proxy) ProxyHistory {
+	h, _ := cc.trends.get(ProxyID(proxy))
+	return h
+}
+
+// HttpGetByID returns the history of the proxy by its ProxyID
+// or Metrics for "metrics"
+func (cc *configurableChecker) HttpGetByID(id string, _ *http.Request) (interface{}, error) {
+	if id == "metrics" {
+		return cc.Metrics(), nil
+	}
+	h, ok := cc.trends.get(id)
+	if !ok {
+		return nil, app.NotFound("no history for proxy: " + id)
+	}
+	return h, nil
+}
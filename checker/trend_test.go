@@ -0,0 +1,68 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	var r ring
+	for i := 0; i < 5; i++ {
+		r.add(3, CheckRecord{Speed: time.Duration(i)})
+	}
+	var speeds []time.Duration
+	for _, v := range r.ordered() {
+		speeds = append(speeds, v.Speed)
+	}
+	assert.Equal(t, []time.Duration{2, 3, 4}, speeds)
+}
+
+func TestCheckHistory(t *testing.T) {
+	checks := 0
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip: "255.0.0.1",
+				client: clientFunc(func(req *http.Request) (*http.Response, error) {
+					checks++
+					if checks%2 == 0 {
+						return nil, fmt.Errorf("nope")
+					}
+					return &http.Response{StatusCode: 200, Body: body("1.2.3.4")}, nil
+				}),
+			},
+		},
+		trends: newTrends(),
+	}
+	proxy := pmux.HttpProxy("127.0.0.1:1")
+	ctx := context.Background()
+	cc.Check(ctx, proxy)
+	assert.Empty(t, cc.History(proxy).Checks, "disabled by default")
+
+	cc.use(checkerConfig{history: 2})
+	for i := 0; i < 3; i++ {
+		cc.Check(ctx, proxy)
+	}
+	h := cc.History(proxy)
+	assert.Equal(t, ProxyID(proxy), h.ID)
+	assert.Equal(t, proxy, h.Proxy)
+	assert.Len(t, h.Checks, 2)
+	assert.True(t, h.Checks[0].Ok)
+	assert.False(t, h.Checks[1].Ok)
+	assert.Equal(t, "nope", h.Checks[1].Failure)
+	assert.False(t, h.Checks[1].Time.Before(h.Checks[0].Time))
+
+	res, err := cc.HttpGetByID(ProxyID(proxy), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, h, res)
+
+	_, err = cc.HttpGetByID("nope", nil)
+	assert.Equal(t, app.NotFound("no history for proxy: nope"), err)
+}
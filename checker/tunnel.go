@@ -0,0 +1,96 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// handshakes are the banner or the first response, not the whole stream
+const tunnelReadLimit = 4096
+
+// tunnel confirms that the proxy tunnels arbitrary TCP to the target, and
+// that the target speaks the expected protocol through it, e.g. SSH banner,
+// SMTP greeting, or WebSocket upgrade.
+type tunnel struct {
+	target  string
+	send    []byte
+	expect  *regexp.Regexp
+	timeout time.Duration
+	dial    func(ctx context.Context, proxy pmux.Proxy, addr string) (net.Conn, error)
+}
+
+func configureTunnel(conf app.Config) (*tunnel, error) {
+	target := conf.StrOr("tunnel_target", "")
+	if target == "" {
+		return nil, nil
+	}
+	_, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, fmt.Errorf("tunnel_target: %w", err)
+	}
+	// escapes like \r\n are common in handshakes
+	send, err := strconv.Unquote(`"` + conf.StrOr("tunnel_send", "") + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("tunnel_send: %w", err)
+	}
+	t := &tunnel{
+		target:  target,
+		send:    []byte(send),
+		timeout: conf.DurOr("timeout", 5*time.Second),
+		dial:    pmux.DialTunnel,
+	}
+	expect := conf.StrOr("tunnel_expect", "")
+	if expect != "" {
+		t.expect, err = regexp.Compile(expect)
+		if err != nil {
+			return nil, fmt.Errorf("tunnel_expect: %w", err)
+		}
+	}
+	return t, nil
+}
+
+func (t *tunnel) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := t.dial(ctx, proxy, t.target)
+	if err != nil {
+		return 0, fmt.Errorf("tunnel: %w", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if len(t.send) > 0 {
+		_, err = conn.Write(t.send)
+		if err != nil {
+			return 0, fmt.Errorf("tunnel: send: %w", err)
+		}
+	}
+	if t.expect == nil {
+		return time.Since(start), nil
+	}
+	var received []byte
+	buf := make([]byte, tunnelReadLimit)
+	for len(received) < tunnelReadLimit {
+		n, err := conn.Read(buf[:tunnelReadLimit-len(received)])
+		received = append(received, buf[:n]...)
+		if t.expect.Match(received) {
+			return time.Since(start), nil
+		}
+		if err != nil {
+			break
+		}
+	}
+	// handshakes may be binary, so they are not sanitized like HTML
+	if len(received) > 128 {
+		received = received[:128]
+	}
+	return 0, fmt.Errorf("tunnel: unexpected handshake: %q", received)
+}
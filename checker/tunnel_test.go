@@ -0,0 +1,229 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoServer replies with the banner and then echoes back the first line
+func echoServer(t *testing.T, banner string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte(banner))
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				conn.Write([]byte(line))
+			}(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestTunnel(t *testing.T) {
+	direct := func(ctx context.Context, _ pmux.Proxy, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	addr := echoServer(t, "SSH-2.0-OpenSSH_8.9\r\n")
+	for i, tt := range []struct {
+		conf      app.Config
+		expectErr string
+	}{
+		{
+			conf: app.Config{
+				"tunnel_expect": `^SSH-2\.0-`,
+			},
+		},
+		{
+			conf: app.Config{
+				"tunnel_send":   `PING\r\n`,
+				"tunnel_expect": `\r\nPING\r\n$`,
+			},
+		},
+		{
+			conf: app.Config{},
+		},
+		{
+			conf: app.Config{
+				"tunnel_expect": `^220 `,
+			},
+			expectErr: `tunnel: unexpected handshake: "SSH-2.0-OpenSSH_8.9\r\n"`,
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			tt.conf["tunnel_target"] = addr
+			tt.conf["timeout"] = "1s"
+			tn, err := configureTunnel(tt.conf)
+			assert.NoError(t, err)
+			tn.dial = direct
+			_, err = tn.Check(context.Background(), pmux.HttpProxy("127.0.0.1:1"))
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTunnelDialFails(t *testing.T) {
+	tn, err := configureTunnel(app.Config{
+		"tunnel_target": "127.0.0.1:22",
+		"timeout":       "1s",
+	})
+	assert.NoError(t, err)
+	_, err = tn.Check(context.Background(), pmux.Socks5Proxy("127.0.0.1:1"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "tunnel: dial socks")
+}
+
+func TestConfigureTunnel(t *testing.T) {
+	for i, tt := range []struct {
+		conf      app.Config
+		expectErr string
+	}{
+		{
+			conf:      app.Config{"tunnel_target": "example.com"},
+			expectErr: "tunnel_target: address example.com: missing port in address",
+		},
+		{
+			conf: app.Config{
+				"tunnel_target": "example.com:22",
+				"tunnel_send":   `"`,
+			},
+			expectErr: "tunnel_send: invalid syntax",
+		},
+		{
+			conf: app.Config{
+				"tunnel_target": "example.com:22",
+				"tunnel_expect": `(`,
+			},
+			expectErr: "tunnel_expect: error parsing regexp: missing closing ): `(`",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			_, err := configureTunnel(tt.conf)
+			assert.EqualError(t, err, tt.expectErr)
+		})
+	}
+
+	cc := configurableChecker{
+
+		ip:     "255.0.0.1",
+		client: http.DefaultClient,
+		strategies: map[string]Checker{
+			"simple": federated{},
+		},
+	}
+	err := cc.Configure(app.Config{
+		"strategy":      "tunnel",
+		"tunnel_target": "example.com:22",
+	})
+	assert.NoError(t, err)
+	tn := cc.current().strategies["tunnel"].(*tunnel)
+	assert.Equal(t, 5*time.Second, tn.timeout)
+}
+
+// connectProxy tunnels to the requested target after responding with headers
+func connectProxy(t *testing.T, headers string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	return serveConnectProxy(t, l, headers)
+}
+
+func serveConnectProxy(t *testing.T, l net.Listener, headers string) string {
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				target, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer target.Close()
+				conn.Write([]byte("HTTP/1.1 200 Connection established\r\n" + headers + "\r\n"))
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestTunnelConnectHeaders(t *testing.T) {
+	tn, err := configureTunnel(app.Config{
+		"tunnel_target": echoServer(t, "SSH-2.0-OpenSSH_8.9\r\n"),
+		"tunnel_expect": `^SSH-2\.0-`,
+		"timeout":       "1s",
+	})
+	assert.NoError(t, err)
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"tunnel": tn,
+		},
+	}
+	cc.use(checkerConfig{strategy: "tunnel"})
+	proxy := pmux.HttpProxy(connectProxy(t, "Via: 1.1 squid\r\nServer: squid/5.7\r\n"))
+	r := cc.Result(context.Background(), proxy)
+	assert.True(t, r.Ok(), r.Failure)
+	assert.Equal(t, "1.1 squid", r.ConnectHeaders.Get("Via"))
+	assert.Equal(t, "squid/5.7", r.ConnectHeaders.Get("Server"))
+}
+
+func TestConnectHeadersOfHttpsJudge(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("1.2.3.4"))
+	}))
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	cc := &configurableChecker{
+		strategies: map[string]Checker{
+			"simple": &simple{
+				ip:     "5.6.7.8",
+				page:   srv.URL,
+				roots:  roots,
+				client: &http.Client{Transport: pmux.ContextualHttpTransport()},
+			},
+		},
+	}
+	cc.use(checkerConfig{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	l = tls.NewListener(l, &tls.Config{
+		Certificates: srv.TLS.Certificates,
+	})
+	proxy := pmux.HttpsProxy(serveConnectProxy(t, l, "Via: 1.1 squid\r\n"))
+	r := cc.Result(context.Background(), proxy)
+	assert.True(t, r.Ok(), r.Failure)
+	assert.Equal(t, "1.1 squid", r.ConnectHeaders.Get("Via"))
+}
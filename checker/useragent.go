@@ -0,0 +1,57 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/corpix/uarand"
+)
+
+// userAgents is a curated pool of User-Agent headers to send with checks.
+// Empty pool falls back to the list embedded into uarand.
+type userAgents []string
+
+// randomAgent picks one of user_agents of the check
+func randomAgent(ctx context.Context) string {
+	return configured(ctx).agents.Random()
+}
+
+// parseUserAgents takes either a path to a file or an inline list, where
+// every user agent is on a separate line. User agents themselves contain
+// commas, so lines are the only sane separator.
+func parseUserAgents(raw string) (userAgents, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	if !strings.Contains(raw, "\n") {
+		_, err := os.Stat(raw)
+		if err == nil {
+			contents, err := ioutil.ReadFile(raw)
+			if err != nil {
+				return nil, fmt.Errorf("user agents: %w", err)
+			}
+			raw = string(contents)
+		}
+	}
+	var out userAgents
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, nil
+}
+
+func (ua userAgents) Random() string {
+	if len(ua) == 0 {
+		return uarand.GetRandom()
+	}
+	return ua[rand.Intn(len(ua))]
+}
@@ -0,0 +1,40 @@
+package checker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserAgentsInline(t *testing.T) {
+	ua, err := parseUserAgents(`
+Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko)
+# comments are skipped
+
+Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, userAgents{
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko)",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)",
+	}, ua)
+	assert.Contains(t, ua, ua.Random())
+}
+
+func TestParseUserAgentsFromFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "agents.txt")
+	err := os.WriteFile(file, []byte("a\nb\n"), 0600)
+	assert.NoError(t, err)
+
+	ua, err := parseUserAgents(file)
+	assert.NoError(t, err)
+	assert.Equal(t, userAgents{"a", "b"}, ua)
+}
+
+func TestUserAgentsFallback(t *testing.T) {
+	ua, err := parseUserAgents("")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ua.Random())
+}
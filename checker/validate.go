@@ -0,0 +1,113 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// JudgeFormat is how the judge reports this IP back
+type JudgeFormat struct {
+	// Format is either "ip" for raw IP judges, "json", or "text"
+	Format string
+	// Field is JSON path or text label, that holds this IP
+	Field       string `json:",omitempty"`
+	ContentType string `json:",omitempty"`
+}
+
+// ValidateJudge makes a direct request to the judge, without any proxy, and
+// confirms that it reports this IP back, so that custom judges could be
+// sanity-checked before they are enabled. Leak detection relies on it.
+func (cc *configurableChecker) ValidateJudge(ctx context.Context, url string) (*JudgeFormat, error) {
+	cfg := cc.current()
+	ctx = withConfig(ctx, cfg)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", randomAgent(ctx))
+	res, err := cfg.direct.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	body := string(raw)
+	contentType := res.Header.Get("Content-Type")
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status %d: %s", res.StatusCode, truncatedResponse(ctx, contentType, body))
+	}
+	ip := cfg.ip
+	format := detectFormat(body, ip)
+	if format == nil {
+		return nil, fmt.Errorf("no %s found: %s", ip, truncatedResponse(ctx, contentType, body))
+	}
+	format.ContentType = contentType
+	return format, nil
+}
+
+func detectFormat(body, ip string) *JudgeFormat {
+	trimmed := strings.TrimSpace(body)
+	if trimmed == ip {
+		return &JudgeFormat{Format: "ip"}
+	}
+	var decoded any
+	if json.Unmarshal([]byte(trimmed), &decoded) == nil {
+		field, ok := findJSON(decoded, ip, "")
+		if ok {
+			return &JudgeFormat{Format: "json", Field: field}
+		}
+		return nil
+	}
+	for _, line := range strings.Split(body, "\n") {
+		idx := strings.Index(line, ip)
+		if idx < 0 {
+			continue
+		}
+		label := strings.Trim(line[:idx], " \t:=\"'")
+		return &JudgeFormat{Format: "text", Field: label}
+	}
+	return nil
+}
+
+// findJSON returns dot-separated path to the value, that is the IP
+func findJSON(v any, ip, path string) (string, bool) {
+	join := func(k string) string {
+		if path == "" {
+			return k
+		}
+		return path + "." + k
+	}
+	switch x := v.(type) {
+	case string:
+		return path, strings.TrimSpace(x) == ip
+	case map[string]any:
+		// stable results for equal inputs
+		var keys []string
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			found, ok := findJSON(x[k], ip, join(k))
+			if ok {
+				return found, true
+			}
+		}
+	case []any:
+		for i, item := range x {
+			found, ok := findJSON(item, ip, join(fmt.Sprint(i)))
+			if ok {
+				return found, true
+			}
+		}
+	}
+	return "", false
+}
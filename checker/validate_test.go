@@ -0,0 +1,81 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateJudge(t *testing.T) {
+	for i, tt := range []struct {
+		body      string
+		status    int
+		expect    *JudgeFormat
+		expectErr string
+	}{
+		{
+			body:   "255.0.0.1\n",
+			expect: &JudgeFormat{Format: "ip", ContentType: "text/plain"},
+		},
+		{
+			body: `{"ip_addr": "255.0.0.1", "headers": {"ua": "x"}}`,
+			expect: &JudgeFormat{
+				Format:      "json",
+				Field:       "ip_addr",
+				ContentType: "text/plain",
+			},
+		},
+		{
+			body: `{"request": {"forwarded": ["1.1.1.1", "255.0.0.1"]}}`,
+			expect: &JudgeFormat{
+				Format:      "json",
+				Field:       "request.forwarded.1",
+				ContentType: "text/plain",
+			},
+		},
+		{
+			body: "user_agent: x\nip_addr: 255.0.0.1\n",
+			expect: &JudgeFormat{
+				Format:      "text",
+				Field:       "ip_addr",
+				ContentType: "text/plain",
+			},
+		},
+		{
+			body:      `{"ip": "1.2.3.4"}`,
+			expectErr: "no 255.0.0.1 found: {\n  \"ip\": \"1.2.3.4\"\n}",
+		},
+		{
+			body:      "nope",
+			status:    503,
+			expectErr: "status 503: nope",
+		},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			status := tt.status
+			if status == 0 {
+				status = 200
+			}
+			cc := &configurableChecker{
+				ip: "255.0.0.1",
+				client: staticResponseClient{
+					Response: http.Response{
+						StatusCode: status,
+						Header:     http.Header{"Content-Type": {"text/plain"}},
+						Body:       body(tt.body),
+					},
+				},
+			}
+			format, err := cc.ValidateJudge(context.Background(), "https://judge.local/")
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, format)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// warmPool keeps idle connections to the healthiest judges, so that direct
+// judge probes don't pay for TCP and TLS setup every time. Checks of
+// candidate proxies never use it and always get fresh connections.
+type warmPool struct {
+	sync.Mutex
+	client   httpClient
+	size     int
+	interval time.Duration
+	judges   map[string]bool
+}
+
+func configureWarmPool(conf app.Config, p *pac, tlsConfig *tls.Config) *warmPool {
+	size := conf.IntOr("warm_judges", 0)
+	if size <= 0 {
+		return nil
+	}
+	timeout := conf.DurOr("timeout", 5*time.Second)
+	interval := conf.DurOr("warm_interval", 30*time.Second)
+	if tlsConfig == nil {
+		tlsConfig = pmux.DefaultTlsConfig
+	}
+	transport := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        size,
+		MaxIdleConnsPerHost: 1,
+		// idle connections have to outlive a missed refresh
+		IdleConnTimeout: 3 * interval,
+	}
+	if p != nil {
+		transport.Proxy = p.proxyFor
+	}
+	return &warmPool{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		size:     size,
+		interval: interval,
+		judges:   map[string]bool{},
+	}
+}
+
+// clientFor returns the pooled client for warm judges and nil otherwise
+func (w *warmPool) clientFor(page string) httpClient {
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	if !w.judges[page] {
+		return nil
+	}
+	return w.client
+}
+
+// keep replaces warm judges with the fastest of the reachable ones
+func (w *warmPool) keep(reachable map[string]time.Duration) {
+	if w == nil {
+		return
+	}
+	var pages []string
+	for page := range reachable {
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return reachable[pages[i]] < reachable[pages[j]]
+	})
+	if len(pages) > w.size {
+		pages = pages[:w.size]
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.judges = map[string]bool{}
+	for _, page := range pages {
+		w.judges[page] = true
+	}
+}
+
+func (w *warmPool) drop(page string) {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.judges, page)
+}
+
+func (w *warmPool) pages() (out []string) {
+	w.Lock()
+	defer w.Unlock()
+	for page := range w.judges {
+		out = append(out, page)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// refreshWarm re-requests warm judges, so that idle connections to them
+// aren't closed, and drops the ones, that have stopped responding
+func (cc *configurableChecker) refreshWarm(ctx context.Context) {
+	w := cc.current().warm
+	if w == nil {
+		return
+	}
+	log := app.Log.From(ctx)
+	for _, page := range w.pages() {
+		err := cc.probeJudge(ctx, page)
+		if err != nil {
+			log.Debug().Err(err).Str("judge", page).Msg("warm judge dropped")
+			w.drop(page)
+		}
+	}
+}
+
+func (cc *configurableChecker) refreshWarmEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cc.refreshWarm(ctx)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarmPool(t *testing.T) {
+	assert.Nil(t, configureWarmPool(app.Config{}, nil, nil))
+	w := configureWarmPool(app.Config{"warm_judges": "2"}, nil, nil)
+	assert.Equal(t, 30*time.Second, w.interval)
+
+	w.keep(map[string]time.Duration{
+		"https://a/": 30 * time.Millisecond,
+		"https://b/": 10 * time.Millisecond,
+		"https://c/": 20 * time.Millisecond,
+	})
+	assert.Equal(t, []string{"https://b/", "https://c/"}, w.pages())
+	assert.NotNil(t, w.clientFor("https://b/"))
+	assert.Nil(t, w.clientFor("https://a/"))
+}
+
+func TestWarmJudgesAreProbedThroughPool(t *testing.T) {
+	var mu sync.Mutex
+	respond := func(b string, seen *[]string) clientFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			*seen = append(*seen, req.URL.String())
+			mu.Unlock()
+			return &http.Response{
+				StatusCode: 200,
+				Body:       body(b),
+			}, nil
+		}
+	}
+	var direct, warm []string
+	w := configureWarmPool(app.Config{"warm_judges": "1"}, nil, nil)
+	w.client = respond("blocked", &warm)
+	cc := &configurableChecker{
+		ip:        "255.0.0.1",
+		client:    respond("255.0.0.1", &direct),
+		readiness: &readiness{},
+	}
+	cc.use(checkerConfig{warm: w})
+	w.keep(map[string]time.Duration{"https://ifconfig.me/ip": time.Millisecond})
+
+	n := cc.ProbeJudges(context.Background())
+	assert.Equal(t, []string{"https://ifconfig.me/ip"}, warm)
+	assert.Equal(t, len(judges())-1, n)
+	assert.Len(t, direct, len(judges())-1)
+	assert.Len(t, w.pages(), 1, "fastest of the reachable is kept")
+
+	warm = nil
+	cc.refreshWarm(context.Background())
+	assert.Len(t, warm, 1)
+	assert.Empty(t, w.pages(), "failing judge is dropped")
+}
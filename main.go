@@ -37,6 +37,7 @@ func main() {
 		"dashboard": serve.NewDashboard,
 		"history":   history.NewHistory,
 		"ipinfo":    ipinfo.NewLookup,
+		"judge":     checker.NewJudge,
 		"mitm":      serve.NewMitmProxyServer,
 		"pool":      pool.NewPool,
 		"probe":     probe.NewProbe,
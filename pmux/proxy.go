@@ -1,6 +1,7 @@
 package pmux
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
 	"fmt"
@@ -30,20 +31,24 @@ const (
 	HTTPS
 	SOCKS4
 	SOCKS5
+	// SOCKS5 wrapped into TLS session to the proxy
+	SOCKS5TLS
 )
 
 var protoMap = map[string]proto{
-	"http":   HTTP,
-	"https":  HTTPS,
-	"socks4": SOCKS4,
-	"socks5": SOCKS5,
+	"http":       HTTP,
+	"https":      HTTPS,
+	"socks4":     SOCKS4,
+	"socks5":     SOCKS5,
+	"socks5+tls": SOCKS5TLS,
 }
 
 var reverseProtoMap = map[proto]string{
-	HTTP:   "http",
-	HTTPS:  "https",
-	SOCKS4: "socks4",
-	SOCKS5: "socks5",
+	HTTP:      "http",
+	HTTPS:     "https",
+	SOCKS4:    "socks4",
+	SOCKS5:    "socks5",
+	SOCKS5TLS: "socks5+tls",
 }
 
 // uint64 = uint32 + uint16 + uint16 (padding for alignment)
@@ -95,9 +100,29 @@ func (p Proxy) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`"%s"`, p.String())), nil
 }
 
+func (p *Proxy) UnmarshalJSON(b []byte) error {
+	raw := strings.Trim(string(b), `"`)
+	split := strings.SplitN(raw, "://", 2)
+	if len(split) != 2 {
+		return fmt.Errorf("invalid proxy: %s", raw)
+	}
+	_, ok := protoMap[split[0]]
+	if !ok {
+		return fmt.Errorf("invalid proxy: %s", raw)
+	}
+	*p = NewProxy(split[1], split[0])
+	if !p.Valid() {
+		return fmt.Errorf("invalid proxy: %s", raw)
+	}
+	return nil
+}
+
 type ckey int
 
-const proxyURL ckey = iota
+const (
+	proxyURL ckey = iota
+	dialTraceKey
+)
 
 func (p Proxy) InContext(ctx context.Context) context.Context {
 	return context.WithValue(ctx, proxyURL, p)
@@ -108,7 +133,7 @@ func (p Proxy) Valid() bool {
 }
 
 func (p Proxy) IsTunnel() bool {
-	return p.Proto() == SOCKS4 || p.Proto() == SOCKS5
+	return p.Proto() == SOCKS4 || p.Proto() == SOCKS5 || p.Proto() == SOCKS5TLS
 }
 
 func (p Proxy) Bucket(buckets int) int {
@@ -160,19 +185,110 @@ var DefaultDialer = &net.Dialer{
 	KeepAlive: 0,
 }
 
+var errTLSRequired = fmt.Errorf("proxy requires TLS, try socks5+tls")
+
+// negotiationDialer limits the time of SOCKS handshake, as plaintext attempt
+// against TLS-only proxy would otherwise hang until the request timeout
+type negotiationDialer struct {
+	ctx context.Context
+	tls bool
+	// connected is when TCP connection to the proxy got established
+	connected *time.Time
+}
+
+func (d negotiationDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := DefaultDialer.DialContext(d.ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if d.connected != nil {
+		*d.connected = time.Now()
+	}
+	conn.SetDeadline(time.Now().Add(DefaultDialer.Timeout))
+	if !d.tls {
+		return &plaintextSocks{Conn: conn}, nil
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		InsecureSkipVerify: true,
+	})
+	err = tlsConn.HandshakeContext(d.ctx)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tls to proxy: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// plaintextSocks detects TLS records coming back during SOCKS handshake
+type plaintextSocks struct {
+	net.Conn
+	replied bool
+}
+
+func (c *plaintextSocks) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if !c.replied && n > 0 {
+		c.replied = true
+		// 0x15 is TLS alert and 0x16 is TLS handshake record
+		if b[0] == 0x15 || b[0] == 0x16 {
+			return 0, errTLSRequired
+		}
+	}
+	if err != nil && !c.replied && os.IsTimeout(err) {
+		return n, fmt.Errorf("%w (proxy may require TLS)", err)
+	}
+	return n, err
+}
+
+func dialSocks(ctx context.Context, p Proxy, network, addr string) (net.Conn, error) {
+	var dialer proxy.Dialer
+	var err error
+	var connected time.Time
+	forward := negotiationDialer{
+		ctx:       ctx,
+		tls:       p.Proto() == SOCKS5TLS,
+		connected: &connected,
+	}
+	if p.Proto() == SOCKS5TLS {
+		dialer, err = proxy.SOCKS5("tcp", p.Address(), nil, forward)
+	} else {
+		dialer, err = proxy.FromURL(p.URL(), forward)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialer.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	// handshake is done
+	conn.SetDeadline(time.Time{})
+	dialTraceFrom(ctx).negotiated(connected)
+	return conn, nil
+}
+
 // experiment with net.Dialer.Control to bypass TCP fingerprinting
 // http://witch.valdikss.org.ru/
 // https://en.wikipedia.org/wiki/TCP/IP_stack_fingerprinting
 // https://stackoverflow.com/a/52426887/277035
 func dialProxiedConnection(ctx context.Context, network, addr string) (net.Conn, error) {
+	return dialProxiedTLS(ctx, network, addr, DefaultTlsConfig)
+}
+
+// DialTLSWith returns DialTLSContext for ContextualHttpTransport, that
+// handshakes with origins through tunnels using the config, e.g. with ALPN
+// protocols other than the default ones
+func DialTLSWith(config *tls.Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialProxiedTLS(ctx, network, addr, config)
+	}
+}
+
+func dialProxiedTLS(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
 	p := GetProxyFromContext(ctx)
 	switch p.Proto() {
-	case SOCKS4, SOCKS5:
-		dialer, err := proxy.FromURL(p.URL(), proxy.Direct)
-		if err != nil {
-			return nil, err
-		}
-		conn, err := dialer.Dial(network, addr)
+	case SOCKS4, SOCKS5, SOCKS5TLS:
+		conn, err := dialSocks(ctx, p, network, addr)
 		if err != nil {
 			return nil, fmt.Errorf("dial socks: %w", err)
 		}
@@ -181,19 +297,51 @@ func dialProxiedConnection(ctx context.Context, network, addr string) (net.Conn,
 			// TODO: figure out a better way of determining this
 			return conn, nil
 		}
-		return tls.Client(conn, DefaultTlsConfig), nil
-	case HTTPS:
-		conn, err := DefaultDialer.DialContext(ctx, network, addr)
+		return handshake(ctx, conn, addr, config)
+	case HTTP, HTTPS:
+		if p.Valid() && addr != p.Address() {
+			// HTTPS origins are tunneled here instead of net/http, so that
+			// negotiation with the proxy and handshake could be traced
+			conn, err := dialConnect(ctx, p, addr, p.Proto() == HTTPS)
+			if err != nil {
+				return nil, err
+			}
+			return handshake(ctx, conn, addr, config)
+		}
+		if p.Proto() == HTTPS {
+			// plain HTTP requests are forwarded by the proxy higher on the stack
+			conn, err := DefaultDialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, fmt.Errorf("dial https: %w", err)
+			}
+			return handshake(ctx, conn, addr, config)
+		}
+	}
+	// no proxy is specified
+	return DefaultDialer.DialContext(ctx, network, addr)
+}
+
+// handshake with the origin eagerly, so that it could be timed separately.
+// The host of addr is sent as SNI, as net/http would do, because origins
+// behind CDNs serve the default certificate otherwise.
+func handshake(ctx context.Context, conn net.Conn, addr string, config *tls.Config) (net.Conn, error) {
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
 		if err != nil {
-			return nil, fmt.Errorf("dial https: %w", err)
+			host = addr
 		}
-		return tls.Client(conn, DefaultTlsConfig), nil
-	default:
-		// use normal connection establishment in one of two cases:
-		// a) no proxy is specified
-		// b) HTTP proxy (handled higher on the stack)
-		return DefaultDialer.DialContext(ctx, network, addr)
+		config = config.Clone()
+		config.ServerName = host
+	}
+	start := time.Now()
+	tlsConn := tls.Client(conn, config)
+	err := tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
+	dialTraceFrom(ctx).handshaked(start)
+	return tlsConn, nil
 }
 
 func pickHttpProxyFromContext(r *http.Request) (*url.URL, error) {
@@ -201,8 +349,8 @@ func pickHttpProxyFromContext(r *http.Request) (*url.URL, error) {
 	if p == 0 {
 		return nil, nil
 	}
-	if p.IsTunnel() {
-		// handled in DialContext
+	if p.IsTunnel() || r.URL.Scheme == "https" {
+		// handled in DialTLSContext
 		return nil, nil
 	}
 	return p.URL(), nil
@@ -260,3 +408,92 @@ func Socks4Proxy(addr string) Proxy {
 func Socks5Proxy(addr string) Proxy {
 	return NewProxy(addr, "socks5")
 }
+
+// DialTunnel opens a raw tunnel to addr through the proxy, so that protocols
+// other than HTTP could be checked: SOCKS proxies connect natively, and HTTP
+// proxies are asked to CONNECT, over TLS to HTTPS ones.
+func DialTunnel(ctx context.Context, p Proxy, addr string) (net.Conn, error) {
+	if !p.IsTunnel() {
+		return dialConnect(ctx, p, addr, p.Proto() == HTTPS)
+	}
+	conn, err := dialSocks(ctx, p, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial socks: %w", err)
+	}
+	return conn, nil
+}
+
+// dialConnect asks the proxy to CONNECT, optionally talking TLS to the proxy
+// itself, as net/http does for HTTPS proxies
+func dialConnect(ctx context.Context, p Proxy, addr string, overTLS bool) (net.Conn, error) {
+	conn, err := DefaultDialer.DialContext(ctx, "tcp", p.Address())
+	if err != nil {
+		return nil, fmt.Errorf("dial connect: %w", err)
+	}
+	connected := time.Now()
+	conn.SetDeadline(connected.Add(DefaultDialer.Timeout))
+	if overTLS {
+		tlsConn := tls.Client(conn, &tls.Config{
+			InsecureSkipVerify: true,
+		})
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("tls to proxy: %w", err)
+		}
+		conn = tlsConn
+	}
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	err = req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	if res.StatusCode != 200 {
+		res.Body.Close()
+		conn.Close()
+		return nil, ConnectError{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     res.Header,
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	dialTraceFrom(ctx).negotiated(connected)
+	dialTraceFrom(ctx).connected(res.Header)
+	// body of the successful response is the tunnel itself, and servers
+	// speaking first may get their bytes buffered with the response
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// ConnectError is the refused CONNECT request, where status and headers of
+// the proxy tell its denials, like Squid ACLs, from failed upstreams
+type ConnectError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+}
+
+func (e ConnectError) Error() string {
+	return fmt.Sprintf("connect: %s", e.Status)
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
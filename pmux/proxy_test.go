@@ -2,9 +2,15 @@ package pmux
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,6 +48,18 @@ func TestProxyMarlshalJSON(t *testing.T) {
 	assert.Equal(t, `"socks4://1.2.3.4:56789"`, string(x))
 }
 
+func TestProxyUnmarshalJSON(t *testing.T) {
+	var p Proxy
+	err := p.UnmarshalJSON([]byte(`"socks5+tls://1.2.3.4:56789"`))
+	assert.NoError(t, err)
+	assert.Equal(t, NewProxy("1.2.3.4:56789", "socks5+tls"), p)
+
+	err = p.UnmarshalJSON([]byte(`"ftp://1.2.3.4:56789"`))
+	assert.EqualError(t, err, "invalid proxy: ftp://1.2.3.4:56789")
+	err = p.UnmarshalJSON([]byte(`"http://nope"`))
+	assert.EqualError(t, err, "invalid proxy: http://nope")
+}
+
 func TestGetProxyFromContext(t *testing.T) {
 	proxy := GetProxyFromContext(context.Background())
 	assert.Equal(t, Proxy(0), proxy)
@@ -82,11 +100,19 @@ func TestDialProxiedConnection_SOCKS(t *testing.T) {
 
 func TestPickProxyFromContext(t *testing.T) {
 	p := HttpProxy("127.0.0.1:0")
-	r := p.MustNewGetRequest("https://ifconfig.me")
+	r := p.MustNewGetRequest("http://ifconfig.me")
 	u, _ := pickHttpProxyFromContext(r)
 	assert.Equal(t, u.String(), p.String())
 }
 
+func TestPickProxyFromContext_Connect(t *testing.T) {
+	p := HttpProxy("127.0.0.1:0")
+	r := p.MustNewGetRequest("https://ifconfig.me")
+	u, err := pickHttpProxyFromContext(r)
+	assert.Nil(t, u)
+	assert.NoError(t, err)
+}
+
 func TestPickProxyFromContext_Tunnel(t *testing.T) {
 	p := Socks5Proxy("127.0.0.1:0")
 	r := p.MustNewGetRequest("https://ifconfig.me")
@@ -100,3 +126,197 @@ func TestPickProxyFromContext_NoProxy(t *testing.T) {
 	assert.Nil(t, u)
 	assert.NoError(t, err)
 }
+
+// serveSocks5 is a minimal no-auth SOCKS5 CONNECT server for tests
+func serveSocks5(t *testing.T, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			buf := make([]byte, 262)
+			// greeting: VER NMETHODS METHODS...
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			io.ReadFull(conn, buf[:buf[1]])
+			conn.Write([]byte{5, 0})
+			// request: VER CMD RSV ATYP=IPv4 ADDR PORT
+			if _, err := io.ReadFull(conn, buf[:10]); err != nil {
+				return
+			}
+			port := fmt.Sprint(int(buf[8])<<8 | int(buf[9]))
+			addr := net.JoinHostPort(net.IP(buf[4:8]).String(), port)
+			target, err := net.Dial("tcp", addr)
+			if err != nil {
+				conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+				return
+			}
+			defer target.Close()
+			conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+			go io.Copy(target, conn)
+			io.Copy(conn, target)
+		}(conn)
+	}
+}
+
+func tlsOnlyListener(t *testing.T) net.Listener {
+	certs := httptest.NewTLSServer(http.NotFoundHandler())
+	config := certs.TLS
+	certs.Close()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestSocks5OverTLS(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("through"))
+	}))
+	defer target.Close()
+
+	l := tlsOnlyListener(t)
+	go serveSocks5(t, l)
+
+	p := NewProxy(l.Addr().String(), "socks5+tls")
+	assert.Equal(t, SOCKS5TLS, p.Proto())
+	assert.True(t, p.IsTunnel())
+	assert.Equal(t, "socks5+tls://"+l.Addr().String(), p.String())
+
+	client := &http.Client{Transport: ContextualHttpTransport()}
+	res, err := client.Do(p.MustNewGetRequest(target.URL))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "through", string(body))
+}
+
+func TestPlaintextSocks5AgainstTLSFailsClearly(t *testing.T) {
+	timeout := DefaultDialer.Timeout
+	DefaultDialer.Timeout = 500 * time.Millisecond
+	defer func() {
+		DefaultDialer.Timeout = timeout
+	}()
+
+	l := tlsOnlyListener(t)
+	go serveSocks5(t, l)
+
+	p := Socks5Proxy(l.Addr().String())
+	start := time.Now()
+	_, err := dialProxiedConnection(p.InContext(context.Background()), "tcp", "127.0.0.1:443")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TLS")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestDialTLSWith(t *testing.T) {
+	target := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(r.Proto))
+	}))
+	target.EnableHTTP2 = true
+	target.StartTLS()
+	defer target.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go serveSocks5(t, l)
+
+	config := DefaultTlsConfig.Clone()
+	config.NextProtos = []string{"h2", "http/1.1"}
+	transport := ContextualHttpTransport()
+	transport.TLSClientConfig = config
+	transport.DialTLSContext = DialTLSWith(config)
+	transport.ForceAttemptHTTP2 = true
+	client := &http.Client{Transport: transport}
+	res, err := client.Do(Socks5Proxy(l.Addr().String()).MustNewGetRequest(target.URL))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "HTTP/2.0", string(body))
+	assert.Equal(t, "h2", res.TLS.NegotiatedProtocol)
+}
+
+// serveConnect is a minimal HTTP CONNECT proxy for tests
+func serveConnect(t *testing.T, l net.Listener) {
+	http.Serve(l, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			rw.WriteHeader(405)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			rw.Header().Set("X-Squid-Error", "ERR_CONNECT_FAIL 111")
+			rw.WriteHeader(502)
+			return
+		}
+		defer target.Close()
+		conn, _, err := rw.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\nVia: 1.1 squid\r\n\r\n"))
+		go io.Copy(target, conn)
+		io.Copy(conn, target)
+	}))
+}
+
+func TestDialTunnel(t *testing.T) {
+	banner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer banner.Close()
+	go func() {
+		for {
+			conn, err := banner.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-test\r\n"))
+			conn.Close()
+		}
+	}()
+	socks, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer socks.Close()
+	go serveSocks5(t, socks)
+	connect, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer connect.Close()
+	go serveConnect(t, connect)
+	connectTLS := tlsOnlyListener(t)
+	go serveConnect(t, connectTLS)
+
+	for i, p := range []Proxy{
+		Socks5Proxy(socks.Addr().String()),
+		HttpProxy(connect.Addr().String()),
+		HttpsProxy(connectTLS.Addr().String()),
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			conn, err := DialTunnel(context.Background(), p, banner.Addr().String())
+			assert.NoError(t, err)
+			defer conn.Close()
+			raw, err := io.ReadAll(conn)
+			assert.NoError(t, err)
+			assert.Equal(t, "SSH-2.0-test\r\n", string(raw))
+		})
+	}
+}
+
+func TestDialTunnelRefused(t *testing.T) {
+	connect, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer connect.Close()
+	go serveConnect(t, connect)
+
+	p := HttpProxy(connect.Addr().String())
+	_, err = DialTunnel(context.Background(), p, "127.0.0.1:1")
+	assert.EqualError(t, err, "connect: 502 Bad Gateway")
+	var refused ConnectError
+	assert.True(t, errors.As(err, &refused))
+	assert.Equal(t, 502, refused.StatusCode)
+	assert.Equal(t, "ERR_CONNECT_FAIL 111", refused.Header.Get("X-Squid-Error"))
+}
@@ -0,0 +1,54 @@
+package pmux
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DialTrace is a set of hooks into phases of connection setup through the
+// proxy, that httptrace cannot see, as pmux tunnels to HTTPS origins itself.
+// Any hook may be nil.
+type DialTrace struct {
+	// Negotiated receives the time between TCP connection to the proxy
+	// and the tunnel being ready, e.g. SOCKS handshake or CONNECT
+	Negotiated func(time.Duration)
+	// Handshaked receives the time of TLS handshake with the origin
+	Handshaked func(time.Duration)
+	// Connected receives headers of the successful response to CONNECT,
+	// which often identify the proxy software
+	Connected func(http.Header)
+}
+
+func WithDialTrace(ctx context.Context, t *DialTrace) context.Context {
+	return context.WithValue(ctx, dialTraceKey, t)
+}
+
+func dialTraceFrom(ctx context.Context) *DialTrace {
+	t, _ := ctx.Value(dialTraceKey).(*DialTrace)
+	if t == nil {
+		return &DialTrace{}
+	}
+	return t
+}
+
+func (t *DialTrace) negotiated(connected time.Time) {
+	if t.Negotiated == nil || connected.IsZero() {
+		return
+	}
+	t.Negotiated(time.Since(connected))
+}
+
+func (t *DialTrace) handshaked(start time.Time) {
+	if t.Handshaked == nil {
+		return
+	}
+	t.Handshaked(time.Since(start))
+}
+
+func (t *DialTrace) connected(h http.Header) {
+	if t.Connected == nil {
+		return
+	}
+	t.Connected(h)
+}
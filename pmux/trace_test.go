@@ -0,0 +1,170 @@
+package pmux
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialTrace(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("through"))
+	}))
+	defer target.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go serveSocks5(t, l)
+
+	var negotiated, handshaked time.Duration
+	p := Socks5Proxy(l.Addr().String())
+	req := p.MustNewGetRequest(target.URL)
+	req = req.WithContext(WithDialTrace(req.Context(), &DialTrace{
+		Negotiated: func(d time.Duration) {
+			negotiated = d
+		},
+		Handshaked: func(d time.Duration) {
+			handshaked = d
+		},
+	}))
+	client := &http.Client{Transport: ContextualHttpTransport()}
+	res, err := client.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "through", string(body))
+	assert.NotZero(t, negotiated)
+	assert.NotZero(t, handshaked)
+}
+
+func TestDialTraceConnected(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, err = http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\nVia: 1.1 squid\r\n\r\n"))
+	}()
+
+	var connected http.Header
+	ctx := WithDialTrace(context.Background(), &DialTrace{
+		Connected: func(h http.Header) {
+			connected = h
+		},
+	})
+	conn, err := DialTunnel(ctx, HttpProxy(l.Addr().String()), "example.com:443")
+	assert.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, "1.1 squid", connected.Get("Via"))
+}
+
+func TestDialTraceHttpProxy(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("through"))
+	}))
+	defer target.Close()
+
+	for i, proto := range []string{"http", "https"} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			defer l.Close()
+			addr := l.Addr().String()
+			if proto == "https" {
+				l = tls.NewListener(l, &tls.Config{
+					Certificates: target.TLS.Certificates,
+				})
+			}
+			go serveConnect(t, l)
+
+			var negotiated, handshaked time.Duration
+			var connected http.Header
+			p := NewProxy(addr, proto)
+			req := p.MustNewGetRequest(target.URL)
+			req = req.WithContext(WithDialTrace(req.Context(), &DialTrace{
+				Negotiated: func(d time.Duration) {
+					negotiated = d
+				},
+				Handshaked: func(d time.Duration) {
+					handshaked = d
+				},
+				Connected: func(h http.Header) {
+					connected = h
+				},
+			}))
+			client := &http.Client{Transport: ContextualHttpTransport()}
+			res, err := client.Do(req)
+			assert.NoError(t, err)
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			assert.Equal(t, "through", string(body))
+			assert.NotZero(t, negotiated)
+			assert.NotZero(t, handshaked)
+			assert.Equal(t, "1.1 squid", connected.Get("Via"))
+		})
+	}
+}
+
+func TestHandshakeSendsServerName(t *testing.T) {
+	names := make(chan string, 1)
+	target := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("through"))
+	}))
+	target.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			names <- hello.ServerName
+			return nil, nil
+		},
+	}
+	target.StartTLS()
+	defer target.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, err = http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		// the proxy resolves the judge to the target
+		upstream, err := net.Dial("tcp", target.Listener.Addr().String())
+		if err != nil {
+			return
+		}
+		defer upstream.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}()
+
+	p := HttpProxy(l.Addr().String())
+	res, err := (&http.Client{Transport: ContextualHttpTransport()}).Do(
+		p.MustNewGetRequest("https://judge.example.com/ip"))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "judge.example.com", <-names)
+}
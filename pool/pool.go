@@ -251,7 +251,7 @@ func (pool *Pool) HttpGet(r *http.Request) (any, error) {
 				https++
 			case pmux.SOCKS4:
 				socks4++
-			case pmux.SOCKS5:
+			case pmux.SOCKS5, pmux.SOCKS5TLS:
 				socks5++
 			}
 			if v.Ok {